@@ -0,0 +1,260 @@
+package accounts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/rates"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+// the balance of an account is the running balance of its last ledger entry
+const selectAccountsQuery = "SELECT accounts.id, accounts.name, accounts.currency, COALESCE((SELECT balance FROM transactions_with_balances WHERE transactions_with_balances.account = accounts.id ORDER BY transactions_with_balances.id DESC LIMIT 1), 0), accounts.created_at FROM accounts"
+
+func scanAccount(rows *sql.Rows) (types.Account, error) {
+	account := types.Account{}
+	err := rows.Scan(&account.Id, &account.Name, &account.Currency, &account.Balance, &account.CreatedAt)
+	return account, err
+}
+
+func retrieveAccount(db *sql.DB, accountId int) (types.Account, error) {
+	account := types.Account{}
+	rows, err := db.Query(fmt.Sprintf("%v WHERE accounts.id='%v';", selectAccountsQuery, accountId))
+	if err != nil {
+		return account, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		account, err = scanAccount(rows)
+		if err != nil {
+			return account, err
+		}
+	}
+	return account, nil
+}
+
+// GetAccounts lists the accounts with their balances, with valuation=USD the
+// balances are also given in USD at the rate in force today
+func GetAccounts(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	valuation, message := rates.ParseValuation(r)
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+	accounts := []types.Account{}
+	db := database.ConnectDB()
+	defer db.Close()
+	rows, err := db.Query(selectAccountsQuery + " ORDER BY accounts.id;")
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		accounts = append(accounts, account)
+	}
+	if valuation {
+		err = rates.ValueAccounts(db, accounts)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+	json_accounts, err := json.Marshal(accounts)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json_accounts)
+}
+
+func CreateAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account := types.Account{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &account)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con una cuenta")
+		return
+	}
+	if account.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Debe especificar el nombre de la cuenta")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	currency, err := ledger.LookupCurrency(db, account.Currency)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if currency.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La moneda %v no está registrada", account.Currency)
+		return
+	}
+
+	var insertedId int
+	insertAccountQuery := fmt.Sprintf("INSERT INTO accounts (name, currency) VALUES ('%v', '%v') RETURNING id;", account.Name, account.Currency)
+	err = db.QueryRow(insertAccountQuery).Scan(&insertedId)
+	if err != nil {
+		if err.Error() == "pq: duplicate key value violates unique constraint \"accounts_name_key\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "El nombre de la cuenta ya ha sido utilizado")
+			return
+		}
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	insertedAccount, err := retrieveAccount(db, insertedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(insertedAccount)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// PatchAccount only renames the account, its currency can not change once
+// it has ledger entries in it
+func PatchAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	accountId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if accountId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Id de cuenta no válido")
+		return
+	}
+	account := types.Account{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &account)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data enviada no corresponde con una cuenta")
+		return
+	}
+	if account.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Debe especificar el nombre de la cuenta")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	var updatedId int
+	updateAccountQuery := fmt.Sprintf("UPDATE accounts SET name='%v' WHERE id='%v' RETURNING id;", account.Name, accountId)
+	err = db.QueryRow(updateAccountQuery).Scan(&updatedId)
+	if err != nil && err != sql.ErrNoRows {
+		if err.Error() == "pq: duplicate key value violates unique constraint \"accounts_name_key\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "El nombre de la cuenta ya ha sido utilizado")
+			return
+		}
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if updatedId == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta con el id %v no existe", accountId)
+		return
+	}
+
+	updatedAccount, err := retrieveAccount(db, updatedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(updatedAccount)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func DeleteAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	accountId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if accountId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Id de cuenta no válido")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	deletedId := types.IdResponse{}
+	err = db.QueryRow(fmt.Sprintf("DELETE FROM accounts WHERE id='%v' RETURNING id;", accountId)).Scan(&deletedId.Id)
+	if err != nil && err != sql.ErrNoRows {
+		if err.Error() == "pq: update or delete on table \"accounts\" violates foreign key constraint \"transactions_with_balances_account_fkey\" on table \"transactions_with_balances\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La cuenta que intenta borrar tiene una o mas transacciones asociadas por lo que no puede ser eliminada")
+			return
+		}
+		if err.Error() == "pq: update or delete on table \"accounts\" violates foreign key constraint \"pending_transactions_account_fkey\" on table \"pending_transactions\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La cuenta que intenta borrar tiene una o mas transacciones pendientes asociadas por lo que no puede ser eliminada")
+			return
+		}
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	if deletedId.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta con el id %v no existe", accountId)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	response, err := json.Marshal(deletedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Write(response)
+}
@@ -0,0 +1,136 @@
+package accounts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"testing"
+
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestGetAccounts(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/accounts", GetAccounts)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/accounts", nil)
+
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing for an array of accounts")
+	accounts := []types.Account{}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	err = json.Unmarshal(body, &accounts)
+	if err != nil {
+		t.Error("Response body does not contain an array of type Account")
+	}
+	for _, account := range accounts {
+		if account.Balance.Sign() < 0 {
+			t.Errorf("account %v has a negative balance %v", account.Id, account.Balance)
+		}
+	}
+}
+
+func TestCreateAndDeleteAccount(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/accounts", CreateAccount)
+	router.DELETE("/accounts/:id", DeleteAccount)
+
+	accountName := utils.RandStringBytes(10)
+	bodyString := fmt.Sprintf(`
+		{
+			"Name": "%v",
+			"Currency": "VES"
+		}
+	`, accountName)
+	rr := testutils.MakeRequest(t, router, "POST", "/accounts", json.RawMessage(bodyString))
+
+	t.Log("testing Ok status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	createdAccount := types.Account{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdAccount)
+	if err != nil {
+		t.Fatal("Response body does not contain an Account type")
+	}
+	if createdAccount.Name != accountName {
+		t.Errorf("createdAccount.Name = %v, want %v", createdAccount.Name, accountName)
+	}
+	if !createdAccount.Balance.IsZero() {
+		t.Errorf("createdAccount.Balance = %v, want 0.00", createdAccount.Balance)
+	}
+
+	t.Log("testing delete account")
+	rr = testutils.MakeRequest(t, router, "DELETE", fmt.Sprintf("/accounts/%v", createdAccount.Id), nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+}
+
+func TestCreateAccountWithBadCurrency(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/accounts", CreateAccount)
+
+	bodyString := `
+		{
+			"Name": "cuenta en moneda desconocida",
+			"Currency": "XYZ"
+		}
+	`
+	rr := testutils.MakeRequest(t, router, "POST", "/accounts", json.RawMessage(bodyString))
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "La moneda XYZ no está registrada"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
+}
+
+func TestDeleteAccountWithTransactions(t *testing.T) {
+	router := httprouter.New()
+	router.DELETE("/accounts/:id", DeleteAccount)
+
+	rr := testutils.MakeRequest(t, router, "DELETE", "/accounts/1", nil)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "La cuenta que intenta borrar tiene una o mas transacciones asociadas por lo que no puede ser eliminada"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
+}
+
+func TestGetAccountsWithWrongValuation(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/accounts", GetAccounts)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/accounts?valuation=EUR", nil)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "Solo se acepta la valoración en USD"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
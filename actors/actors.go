@@ -1,23 +1,61 @@
 package actors
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"time"
 
 	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
 	"example.com/backend_gandola_soft/types"
 	"example.com/backend_gandola_soft/utils"
 	"github.com/julienschmidt/httprouter"
 )
 
+const selectActorsQuery = "SELECT id, type, name, national_id, address, notes, COALESCE(license_number, ''), COALESCE(license_expiry::TEXT, ''), COALESCE(phone, ''), special_taxpayer, created_at FROM actors"
+
+const returningActorColumns = "RETURNING id, type, name, national_id, address, notes, COALESCE(license_number, ''), COALESCE(license_expiry::TEXT, ''), COALESCE(phone, ''), special_taxpayer, created_at"
+
+func scanActor(rows *sql.Rows, actor *types.Actor) error {
+	return rows.Scan(&actor.Id, &actor.Type, &actor.Name, &actor.NationalId, &actor.Address, &actor.Notes, &actor.LicenseNumber, &actor.LicenseExpiry, &actor.Phone, &actor.SpecialTaxpayer, &actor.CreatedAt)
+}
+
+// validateActorType checks the type of the actor and the fields that only
+// drivers have, it returns a non empty message when the actor is not valid
+func validateActorType(actor *types.Actor) string {
+	if actor.Type != "personnel" && actor.Type != "third" && actor.Type != "mine" && actor.Type != "contractee" && actor.Type != "driver" {
+		return "Debe especificar el tipo de actor, el cual puede ser 'personal', 'tercero', 'mina', 'contratante' o 'conductor'"
+	}
+	if actor.Type != "mine" && actor.Type != "contractee" {
+		actor.SpecialTaxpayer = false
+	}
+	if actor.Type != "driver" {
+		actor.LicenseNumber = ""
+		actor.LicenseExpiry = ""
+		actor.Phone = ""
+		return ""
+	}
+	if actor.LicenseNumber == "" {
+		return "Debe especificar el número de licencia del conductor"
+	}
+	if actor.LicenseExpiry != "" {
+		_, err := time.Parse(types.DateFormat, actor.LicenseExpiry)
+		if err != nil {
+			return "La fecha de vencimiento de la licencia no tiene un formato válido"
+		}
+	}
+	return ""
+}
+
 func GetActors(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	actors := []types.Actor{}
 	db := database.ConnectDB()
 	defer db.Close()
-	rows, err := db.Query("SELECT * FROM actors ORDER BY id ASC;")
+	rows, err := db.Query(selectActorsQuery + " ORDER BY id ASC;")
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
@@ -25,7 +63,7 @@ func GetActors(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	defer rows.Close()
 	for rows.Next() {
 		actor := types.Actor{}
-		err = rows.Scan(&actor.Id, &actor.Type, &actor.Name, &actor.NationalId, &actor.Address, &actor.Notes, &actor.CreatedAt)
+		err = scanActor(rows, &actor)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
@@ -45,7 +83,35 @@ func GetCompanies(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	actors := []types.Actor{}
 	db := database.ConnectDB()
 	defer db.Close()
-	rows, err := db.Query("SELECT * FROM actors WHERE type='mine' OR type='contractee' ORDER BY id ASC;")
+	rows, err := db.Query(selectActorsQuery + " WHERE type='mine' OR type='contractee' ORDER BY id ASC;")
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		actor := types.Actor{}
+		err = scanActor(rows, &actor)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		actors = append(actors, actor)
+	}
+	json_actors, err := json.Marshal(actors)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json_actors)
+}
+
+func GetDrivers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	actors := []types.Actor{}
+	db := database.ConnectDB()
+	defer db.Close()
+	rows, err := db.Query(selectActorsQuery + " WHERE type='driver' ORDER BY id ASC;")
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
@@ -53,7 +119,7 @@ func GetCompanies(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	defer rows.Close()
 	for rows.Next() {
 		actor := types.Actor{}
-		err = rows.Scan(&actor.Id, &actor.Type, &actor.Name, &actor.NationalId, &actor.Address, &actor.Notes, &actor.CreatedAt)
+		err = scanActor(rows, &actor)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
@@ -83,9 +149,9 @@ func CreateActor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		fmt.Fprintf(w, "La data recibida no es del tipo Actor")
 		return
 	}
-	if actor.Type != "personnel" && actor.Type != "third" && actor.Type != "mine" && actor.Type != "contractee" {
+	if message := validateActorType(&actor); message != "" {
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Debe especificar el tipo de actor, el cual puede ser 'personal', 'tercero', 'mina' o 'contratante'")
+		fmt.Fprint(w, message)
 		return
 	}
 	if actor.Name == "" {
@@ -96,7 +162,7 @@ func CreateActor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	db := database.ConnectDB()
 	defer db.Close()
 
-	insertActorQuery := fmt.Sprintf("INSERT INTO actors (type, name, national_id, address, notes) VALUES ('%v', '%v', '%v', '%v', '%v') RETURNING id, type, name, national_id, address, notes, created_at;", actor.Type, actor.Name, actor.NationalId, actor.Address, actor.Notes)
+	insertActorQuery := fmt.Sprintf("INSERT INTO actors (type, name, national_id, address, notes, license_number, license_expiry, phone, special_taxpayer) VALUES ('%v', '%v', '%v', '%v', '%v', %v, %v, %v, '%v') %v;", actor.Type, actor.Name, actor.NationalId, actor.Address, actor.Notes, ledger.Nullable(actor.LicenseNumber), ledger.Nullable(actor.LicenseExpiry), ledger.Nullable(actor.Phone), actor.SpecialTaxpayer, returningActorColumns)
 
 	rows, err := db.Query(insertActorQuery)
 	if err != nil {
@@ -115,7 +181,7 @@ func CreateActor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 	for rows.Next() {
-		err = rows.Scan(&actor.Id, &actor.Type, &actor.Name, &actor.NationalId, &actor.Address, &actor.Notes, &actor.CreatedAt)
+		err = scanActor(rows, &actor)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
@@ -160,9 +226,9 @@ func PatchActor(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		fmt.Fprintf(w, "La data enviada con corresponde con un actor parcial")
 		return
 	}
-	if actor.Type != "personnel" && actor.Type != "third" && actor.Type != "mine" && actor.Type != "contractee" {
+	if message := validateActorType(&actor); message != "" {
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Debe especificar el tipo de actor, el cual puede ser 'personal', 'tercero', 'mina' o 'contratante'")
+		fmt.Fprint(w, message)
 		return
 	}
 	if actor.Name == "" {
@@ -175,7 +241,7 @@ func PatchActor(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	defer db.Close()
 
 	var updatedActor types.Actor
-	patchActorQuery := fmt.Sprintf("UPDATE actors SET type='%v', name='%v', national_id='%v', address='%v', notes='%v' WHERE id='%v' RETURNING id, type, name, national_id, address, notes, created_at;", actor.Type, actor.Name, actor.NationalId, actor.Address, actor.Notes, actorId)
+	patchActorQuery := fmt.Sprintf("UPDATE actors SET type='%v', name='%v', national_id='%v', address='%v', notes='%v', license_number=%v, license_expiry=%v, phone=%v, special_taxpayer='%v' WHERE id='%v' %v;", actor.Type, actor.Name, actor.NationalId, actor.Address, actor.Notes, ledger.Nullable(actor.LicenseNumber), ledger.Nullable(actor.LicenseExpiry), ledger.Nullable(actor.Phone), actor.SpecialTaxpayer, actorId, returningActorColumns)
 	actorRow, err := db.Query(patchActorQuery)
 	if err != nil {
 		if err.Error() == "pq: duplicate key value violates unique constraint \"actors_name_key\"" {
@@ -188,7 +254,7 @@ func PatchActor(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 	defer actorRow.Close()
 	for actorRow.Next() {
-		err = actorRow.Scan(&updatedActor.Id, &updatedActor.Type, &updatedActor.Name, &updatedActor.NationalId, &updatedActor.Address, &updatedActor.Notes, &updatedActor.CreatedAt)
+		err = scanActor(actorRow, &updatedActor)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
@@ -215,7 +281,7 @@ func GetLastActor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	db := database.ConnectDB()
 	defer db.Close()
-	query := "SELECT * FROM actors ORDER BY id DESC LIMIT 1;"
+	query := selectActorsQuery + " ORDER BY id DESC LIMIT 1;"
 	rows, err := db.Query(query)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -224,7 +290,7 @@ func GetLastActor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	defer rows.Close()
 	for rows.Next() {
-		err = rows.Scan(&lastActor.Id, &lastActor.Type, &lastActor.Name, &lastActor.NationalId, &lastActor.Address, &lastActor.Notes, &lastActor.CreatedAt)
+		err = scanActor(rows, &lastActor)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"example.com/backend_gandola_soft/testutils"
 	"example.com/backend_gandola_soft/types"
 	"example.com/backend_gandola_soft/utils"
 	"github.com/julienschmidt/httprouter"
@@ -79,6 +80,36 @@ func TestGetCompanies(t *testing.T) {
 	}
 }
 
+func TestGetDrivers(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/drivers", GetDrivers)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/drivers", nil)
+
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing for an array of drivers")
+	drivers := []types.Actor{}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+
+	err = json.Unmarshal(body, &drivers)
+	if err != nil {
+		t.Error("Response body does not contain an array of type Actor")
+	}
+	for _, driver := range drivers {
+		if driver.Type != "driver" {
+			t.Errorf("driver.Type = %v, want driver", driver.Type)
+		}
+	}
+}
+
 func TestCreateActor(t *testing.T) {
 	router := httprouter.New()
 	router.POST("/actors", CreateActor)
@@ -122,6 +153,78 @@ func TestCreateActor(t *testing.T) {
 	}
 }
 
+func TestCreateDriver(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/actors", CreateActor)
+
+	actorName := utils.RandStringBytes(8)
+	bodyString := fmt.Sprintf(`
+		{
+			"Type": "driver",
+			"Name": "%v",
+			"LicenseNumber": "V-123456",
+			"LicenseExpiry": "2030-01-31",
+			"Phone": "0414-1234567"
+		}
+	`, actorName)
+	rr := testutils.MakeRequest(t, router, "POST", "/actors", json.RawMessage(bodyString))
+	t.Log("testing Ok status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing create driver success")
+	requestResponse := types.Actor{}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	err = json.Unmarshal(body, &requestResponse)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Response body does not contain an Actor type")
+	}
+
+	if requestResponse.LicenseNumber != "V-123456" {
+		t.Errorf("requestResponse.LicenseNumber = %v, want %v", requestResponse.LicenseNumber, "V-123456")
+	}
+	if requestResponse.LicenseExpiry != "2030-01-31" {
+		t.Errorf("requestResponse.LicenseExpiry = %v, want %v", requestResponse.LicenseExpiry, "2030-01-31")
+	}
+	if requestResponse.Phone != "0414-1234567" {
+		t.Errorf("requestResponse.Phone = %v, want %v", requestResponse.Phone, "0414-1234567")
+	}
+}
+
+func TestCreateDriverWithoutLicense(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/actors", CreateActor)
+
+	actorName := utils.RandStringBytes(8)
+	bodyString := fmt.Sprintf(`
+		{
+			"Type": "driver",
+			"Name": "%v"
+		}
+	`, actorName)
+	rr := testutils.MakeRequest(t, router, "POST", "/actors", json.RawMessage(bodyString))
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	wanted := "Debe especificar el número de licencia del conductor"
+	if string(body) != wanted {
+		t.Errorf("reponse = %v, wanted %v", string(body), wanted)
+	}
+}
+
 func TestCreateActorWithoutName(t *testing.T) {
 	router := httprouter.New()
 	router.POST("/actors", CreateActor)
@@ -292,7 +395,7 @@ func TestCreateActorWithBadType(t *testing.T) {
 		log.Fatal(err)
 		t.Error("Could not read body of response")
 	}
-	wanted := "Debe especificar el tipo de actor, el cual puede ser 'personal', 'tercero', 'mina' o 'contratante'"
+	wanted := "Debe especificar el tipo de actor, el cual puede ser 'personal', 'tercero', 'mina', 'contratante' o 'conductor'"
 	if string(body) != wanted {
 		t.Errorf("reponse = %v, wanted %v", string(body), wanted)
 	}
@@ -759,7 +862,7 @@ func TestPatchActorWrongType(t *testing.T) {
 		log.Fatal(err)
 		t.Error("Could not read body of response")
 	}
-	wanted := "Debe especificar el tipo de actor, el cual puede ser 'personal', 'tercero', 'mina' o 'contratante'"
+	wanted := "Debe especificar el tipo de actor, el cual puede ser 'personal', 'tercero', 'mina', 'contratante' o 'conductor'"
 	if string(body2) != wanted {
 		t.Errorf("response = %v, wanted %v", string(body2), wanted)
 	}
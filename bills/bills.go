@@ -1,6 +1,7 @@
 package bills
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -10,29 +11,224 @@ import (
 	"time"
 
 	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/pdf"
+	"example.com/backend_gandola_soft/settings"
+	"example.com/backend_gandola_soft/trips"
 	"example.com/backend_gandola_soft/types"
 	"example.com/backend_gandola_soft/utils"
 	"github.com/julienschmidt/httprouter"
 )
 
+// SelectBillsQuery lists the bills with their company and the balances of
+// their payments, callers append their own WHERE and ORDER BY clauses and
+// read rows with ScanBill
+const SelectBillsQuery = "SELECT bills.id, code, url, date, company, name, national_id, subtotal, iva_rate, iva_withholding_rate, islr_withholding_rate, iva, iva_withholding, islr_withholding, total, net, currency, paid, outstanding, charged, bills.created_at FROM bills_with_balances AS bills INNER JOIN actors ON bills.company = actors.id"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func ScanBill(row scanner) (types.Bill, error) {
+	bill := types.Bill{}
+	err := row.Scan(&bill.Id, &bill.Code, &bill.Url, &bill.Date, &bill.Company.Id, &bill.Company.Name, &bill.Company.NationalId, &bill.Subtotal, &bill.IvaRate, &bill.IvaWithholdingRate, &bill.IslrWithholdingRate, &bill.Iva, &bill.IvaWithholding, &bill.IslrWithholding, &bill.Total, &bill.Net, &bill.Currency, &bill.Paid, &bill.Outstanding, &bill.Charged, &bill.CreatedAt)
+	bill.Date = strings.Split(bill.Date, "T")[0]
+	return bill, err
+}
+
+// loadBill returns the bill with its trips and payments, the Id of the
+// returned bill is zero when it does not exist
+func loadBill(db *sql.DB, billId int) (types.Bill, error) {
+	bill, err := ScanBill(db.QueryRow(fmt.Sprintf("%v WHERE bills.id='%v';", SelectBillsQuery, billId)))
+	if err == sql.ErrNoRows {
+		return types.Bill{}, nil
+	}
+	if err != nil {
+		return bill, err
+	}
+
+	bill.Items = []types.BillItem{}
+	itemRows, err := db.Query(fmt.Sprintf("SELECT id, description, quantity, unit, unit_price, amount, COALESCE(trip, 0) FROM bill_items WHERE bill='%v' ORDER BY id;", bill.Id))
+	if err != nil {
+		return bill, err
+	}
+	defer itemRows.Close()
+	for itemRows.Next() {
+		item := types.BillItem{}
+		if err := itemRows.Scan(&item.Id, &item.Description, &item.Quantity, &item.Unit, &item.UnitPrice, &item.Amount, &item.Trip); err != nil {
+			return bill, err
+		}
+		bill.Items = append(bill.Items, item)
+	}
+
+	bill.Trips, err = trips.GetTripsByBill(db, bill.Id)
+	if err != nil {
+		return bill, err
+	}
+
+	bill.Payments = []types.TransactionWithBalance{}
+	rows, err := db.Query(fmt.Sprintf("%v WHERE transactions_with_balances.bill='%v' ORDER BY transactions_with_balances.id;", ledger.SelectTransactionsQuery, bill.Id))
+	if err != nil {
+		return bill, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		payment, err := ledger.ScanTransaction(rows)
+		if err != nil {
+			return bill, err
+		}
+		bill.Payments = append(bill.Payments, payment)
+	}
+	return bill, rows.Err()
+}
+
+// computeBillTotals sets the amount of every item and the taxes of the bill
+// with the given rates, which are kept on the bill. Without items the
+// subtotal is taken as sent. The IVA is charged on the subtotal, special
+// taxpayers withhold part of the IVA and the ISLR on the subtotal, and every
+// amount is rounded to the decimals of the currency.
+func computeBillTotals(bill *types.Bill, settings types.Settings, specialTaxpayer bool, precision int) {
+	if len(bill.Items) > 0 {
+		bill.Subtotal = money.Money{}
+		for i := range bill.Items {
+			item := &bill.Items[i]
+			item.Amount = item.UnitPrice.Times(item.Quantity).Round(precision)
+			bill.Subtotal = bill.Subtotal.Add(item.Amount)
+		}
+	}
+	bill.IvaRate = settings.IvaRate
+	bill.IvaWithholdingRate = settings.IvaWithholdingRate
+	bill.IslrWithholdingRate = settings.IslrWithholdingRate
+	bill.Iva = bill.Subtotal.Percent(settings.IvaRate).Round(precision)
+	bill.IvaWithholding = money.Money{}
+	bill.IslrWithholding = money.Money{}
+	if specialTaxpayer {
+		bill.IvaWithholding = bill.Iva.Percent(settings.IvaWithholdingRate).Round(precision)
+		bill.IslrWithholding = bill.Subtotal.Percent(settings.IslrWithholdingRate).Round(precision)
+	}
+	bill.Total = bill.Subtotal.Add(bill.Iva)
+	bill.Net = bill.Total.Sub(bill.IvaWithholding).Sub(bill.IslrWithholding)
+}
+
+// billRates returns the tax rates of a bill, the ones sent in the body
+// replace the given ones and the rest are kept. It returns a message for the
+// client when a sent rate is not valid.
+func billRates(body []byte, rates types.Settings) (types.Settings, string) {
+	sent := struct {
+		IvaRate             *money.Money
+		IvaWithholdingRate  *money.Money
+		IslrWithholdingRate *money.Money
+	}{}
+	json.Unmarshal(body, &sent)
+	if sent.IvaRate != nil {
+		rates.IvaRate = *sent.IvaRate
+	}
+	if sent.IvaWithholdingRate != nil {
+		rates.IvaWithholdingRate = *sent.IvaWithholdingRate
+	}
+	if sent.IslrWithholdingRate != nil {
+		rates.IslrWithholdingRate = *sent.IslrWithholdingRate
+	}
+	hundred := money.FromInt(100)
+	for _, rate := range []money.Money{rates.IvaRate, rates.IvaWithholdingRate, rates.IslrWithholdingRate} {
+		if rate.Sign() < 0 || rate.Cmp(hundred) > 0 {
+			return rates, "Las tasas de la factura deben estar entre 0 y 100"
+		}
+	}
+	return rates, ""
+}
+
+// prepareBill defaults the currency of the bill to USD, validates its items
+// and computes its totals with the given rates, it returns a message for the
+// client when the bill is not valid
+func prepareBill(db *sql.DB, bill *types.Bill, specialTaxpayer bool, rates types.Settings) (string, error) {
+	if bill.Currency == "" {
+		bill.Currency = "USD"
+	}
+	currency, err := ledger.LookupCurrency(db, bill.Currency)
+	if err != nil {
+		return "", err
+	}
+	if currency.Code == "" {
+		return fmt.Sprintf("La moneda %v no está registrada", bill.Currency), nil
+	}
+
+	for _, item := range bill.Items {
+		if strings.TrimSpace(item.Description) == "" {
+			return "Cada línea de la factura debe poseer una descripción", nil
+		}
+		if item.Quantity.Sign() <= 0 {
+			return "La cantidad de cada línea de la factura debe ser mayor a cero (0)", nil
+		}
+		if item.UnitPrice.Sign() < 0 {
+			return "El precio unitario de una línea de la factura no puede ser negativo", nil
+		}
+		if !item.UnitPrice.Fits(currency.Precision) {
+			return fmt.Sprintf("El monto excede los %v decimales de la moneda %v", currency.Precision, currency.Code), nil
+		}
+		if item.Trip == 0 {
+			continue
+		}
+		var tripId int
+		err := db.QueryRow(fmt.Sprintf("SELECT id FROM trips WHERE id='%v';", item.Trip)).Scan(&tripId)
+		if err == sql.ErrNoRows {
+			return fmt.Sprintf("El viaje con el id %v no existe", item.Trip), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	// the total is computed from the items or the subtotal, a bill that only
+	// sends its total would be saved with a zero total
+	if len(bill.Items) == 0 && bill.Subtotal.IsZero() && !bill.Total.IsZero() {
+		return "Debe especificar las líneas o la base imponible de la factura, el total se calcula a partir de ellas", nil
+	}
+	if bill.Subtotal.Sign() < 0 {
+		return "La base imponible de la factura no puede ser negativa", nil
+	}
+	if !bill.Subtotal.Fits(currency.Precision) {
+		return fmt.Sprintf("El monto excede los %v decimales de la moneda %v", currency.Precision, currency.Code), nil
+	}
+
+	computeBillTotals(bill, rates, specialTaxpayer, currency.Precision)
+	if bill.Total.Cmp(types.MaxTransactionAmount) > 0 {
+		return "El total de la factura excede el máximo permitido", nil
+	}
+	return "", nil
+}
+
+// saveBillItems replaces the items of the bill
+func saveBillItems(tx *sql.Tx, billId int, items []types.BillItem) error {
+	_, err := tx.Exec(fmt.Sprintf("DELETE FROM bill_items WHERE bill='%v';", billId))
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO bill_items (bill, description, quantity, unit, unit_price, amount, trip) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', %v);", billId, item.Description, item.Quantity, item.Unit, item.UnitPrice, item.Amount, ledger.Nullable(item.Trip)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func GetBills(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	bills :=[]types.Bill{}
 	db := database.ConnectDB();
 	defer db.Close();
-	rows, err := db.Query("SELECT bills.id, code, url, date, charged, company, name, national_id, bills.created_at FROM bills INNER JOIN actors ON bills.company = actors.id;")
+	rows, err := db.Query(SelectBillsQuery + ";")
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
-		bill := types.Bill{}
-	  err = rows.Scan(&bill.Id, &bill.Code, &bill.Url, &bill.Date, &bill.Charged, &bill.Company.Id, &bill.Company.Name, &bill.Company.NationalId, &bill.CreatedAt)
+	  bill, err := ScanBill(rows)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
-		bill.Date = strings.Split(bill.Date, "T")[0]
 		bills = append(bills, bill)
 	}
 	json_bills, err := json.Marshal(bills)
@@ -44,6 +240,44 @@ func GetBills(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	w.Write(json_bills)
 }
 
+func GetBill(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestedId := ps.ByName("id")
+	billId, err := strconv.Atoi(requestedId)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if billId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id de la factura debe ser mayor a cero")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	bill, err := loadBill(db, billId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	if bill.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La factura con el id %v no existe", billId)
+		return
+	}
+
+	response, err := json.Marshal(bill)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
 func CreateBill(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	bill := types.Bill{}
 	body, err := ioutil.ReadAll(r.Body)
@@ -77,7 +311,8 @@ func CreateBill(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	var companyId int
 	var companyType string
-	getCompanyIdQuery := fmt.Sprintf("SELECT id, type FROM actors WHERE id=%v;", bill.Company.Id)
+	var specialTaxpayer bool
+	getCompanyIdQuery := fmt.Sprintf("SELECT id, type, special_taxpayer FROM actors WHERE id=%v;", bill.Company.Id)
 	companyIdRow, err := db.Query(getCompanyIdQuery)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -85,7 +320,7 @@ func CreateBill(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 	defer companyIdRow.Close()
 	for companyIdRow.Next() {
-		err = companyIdRow.Scan(&companyId, &companyType)
+		err = companyIdRow.Scan(&companyId, &companyType, &specialTaxpayer)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
@@ -104,10 +339,33 @@ func CreateBill(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
+	// new bills take the rates in force unless the body sends its own
+	rates, err := settings.Load(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	rates, message := billRates(body, rates)
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+	message, err = prepareBill(db, &bill, specialTaxpayer, rates)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
 	var insertedId int
 	var insertBillQuery string
 	if  bill.Date == "" {
-		insertBillQuery = fmt.Sprintf("INSERT INTO bills (code, url, company, charged) VALUES ('%v', '%v', '%v', '%v') RETURNING id;", bill.Code, bill.Url, bill.Company.Id, bill.Charged)
+		insertBillQuery = fmt.Sprintf("INSERT INTO bills (code, url, company, subtotal, iva_rate, iva_withholding_rate, islr_withholding_rate, iva, iva_withholding, islr_withholding, total, currency) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", bill.Code, bill.Url, bill.Company.Id, bill.Subtotal, bill.IvaRate, bill.IvaWithholdingRate, bill.IslrWithholdingRate, bill.Iva, bill.IvaWithholding, bill.IslrWithholding, bill.Total, bill.Currency)
 	} else {
 		_, err := time.Parse(types.DateFormat, bill.Date)
 		if err != nil {
@@ -115,39 +373,37 @@ func CreateBill(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 			fmt.Fprintf(w, "La fecha de la factura no tiene un formato válido")
 			return
 		}
-		insertBillQuery = fmt.Sprintf("INSERT INTO bills (code, url, date, company, charged) VALUES ('%v', '%v', '%v', '%v', '%v') RETURNING id;", bill.Code, bill.Url, bill.Date, bill.Company.Id, bill.Charged)
+		insertBillQuery = fmt.Sprintf("INSERT INTO bills (code, url, date, company, subtotal, iva_rate, iva_withholding_rate, islr_withholding_rate, iva, iva_withholding, islr_withholding, total, currency) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", bill.Code, bill.Url, bill.Date, bill.Company.Id, bill.Subtotal, bill.IvaRate, bill.IvaWithholdingRate, bill.IslrWithholdingRate, bill.Iva, bill.IvaWithholding, bill.IslrWithholding, bill.Total, bill.Currency)
 	}
 
-	rowsInsertedId, err := db.Query(insertBillQuery)
+	tx, err := db.Begin()
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rowsInsertedId.Close()
-	for rowsInsertedId.Next() {
-		err = rowsInsertedId.Scan(&insertedId)
-		if err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
-	}
+	defer tx.Rollback()
 
-	insertedBill := types.Bill{}
-	retrieveBillQuery := fmt.Sprintf("SELECT bills.id, code, url, date, charged, company, name, national_id, bills.created_at FROM bills INNER JOIN actors ON bills.company = actors.id WHERE bills.id='%v';", insertedId)
-	rowsRetreivedBill, err := db.Query(retrieveBillQuery)
+	err = tx.QueryRow(insertBillQuery).Scan(&insertedId)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rowsRetreivedBill.Close()
-	for rowsRetreivedBill.Next() {
-		err = rowsRetreivedBill.Scan(&insertedBill.Id, &insertedBill.Code, &insertedBill.Url, &insertedBill.Date, &insertedBill.Charged, &insertedBill.Company.Id, &insertedBill.Company.Name, &insertedBill.Company.NationalId, &insertedBill.CreatedAt)
-		if err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
+	err = saveBillItems(tx, insertedId, bill.Items)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	insertedBill, err := loadBill(db, insertedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
 	}
-	insertedBill.Date = strings.Split(insertedBill.Date, "T")[0]
 
 	response, err := json.Marshal(insertedBill)
 	if err != nil {
@@ -203,7 +459,8 @@ func PatchBill(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	var companyId int
 	var companyType string
-	getCompanyIdQuery := fmt.Sprintf("SELECT id, type FROM actors WHERE id=%v;", newBill.Company.Id)
+	var specialTaxpayer bool
+	getCompanyIdQuery := fmt.Sprintf("SELECT id, type, special_taxpayer FROM actors WHERE id=%v;", newBill.Company.Id)
 	companyIdRow, err := db.Query(getCompanyIdQuery)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -211,7 +468,7 @@ func PatchBill(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 	defer companyIdRow.Close()
 	for companyIdRow.Next() {
-		err = companyIdRow.Scan(&companyId, &companyType)
+		err = companyIdRow.Scan(&companyId, &companyType, &specialTaxpayer)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
@@ -229,11 +486,73 @@ func PatchBill(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		fmt.Fprintf(w, "La compañía especificada no es mina o contratante")
 		return
 	}
-	
+
+	// the bill is locked so no payment can be linked to it while what is
+	// owed is compared with what has been paid
+	tx, err := db.Begin()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
+
+	var currentCompany int
+	var currentCurrency string
+	storedRates := types.Settings{}
+	err = tx.QueryRow(fmt.Sprintf("SELECT company, currency, iva_rate, iva_withholding_rate, islr_withholding_rate FROM bills WHERE id='%v' FOR UPDATE;", billsId)).Scan(&currentCompany, &currentCurrency, &storedRates.IvaRate, &storedRates.IvaWithholdingRate, &storedRates.IslrWithholdingRate)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La factura solicitada no existe")
+		return
+	}
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	// the bill keeps the rates it was issued with, a change of the rates in
+	// the settings does not re-tax it unless the body sends new rates
+	rates, message := billRates(body, storedRates)
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+	message, err = prepareBill(db, &newBill, specialTaxpayer, rates)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	var paid money.Money
+	var payments int
+	err = tx.QueryRow(fmt.Sprintf("SELECT paid, (SELECT COUNT(*) FROM transactions_with_balances WHERE bill='%v' AND reversed=FALSE) FROM bills_with_balances WHERE id='%v';", billsId, billsId)).Scan(&paid, &payments)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	if payments > 0 && (newBill.Company.Id != currentCompany || newBill.Currency != currentCurrency) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se puede cambiar la compañía ni la moneda de una factura con pagos")
+		return
+	}
+
+	if newBill.Net.Cmp(paid) < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El monto a cobrar de la factura no puede ser menor a lo cobrado (%v)", paid)
+		return
+	}
+
 	var updatedId int
 	var updateBillQuery string
 	if newBill.Date == "" {
-		updateBillQuery = fmt.Sprintf("UPDATE bills SET code='%v', url='%v', company='%v', charged='%v' WHERE id='%v' RETURNING id;", newBill.Code, newBill.Url, newBill.Company.Id, newBill.Charged, billsId)
+		updateBillQuery = fmt.Sprintf("UPDATE bills SET code='%v', url='%v', company='%v', subtotal='%v', iva_rate='%v', iva_withholding_rate='%v', islr_withholding_rate='%v', iva='%v', iva_withholding='%v', islr_withholding='%v', total='%v', currency='%v' WHERE id='%v' RETURNING id;", newBill.Code, newBill.Url, newBill.Company.Id, newBill.Subtotal, newBill.IvaRate, newBill.IvaWithholdingRate, newBill.IslrWithholdingRate, newBill.Iva, newBill.IvaWithholding, newBill.IslrWithholding, newBill.Total, newBill.Currency, billsId)
 	} else {
 		_, err := time.Parse(types.DateFormat, newBill.Date)
 		if err != nil {
@@ -241,46 +560,30 @@ func PatchBill(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 			fmt.Fprintf(w, "La fecha de la factura no tiene un formato válido")
 			return
 		}
-		updateBillQuery = fmt.Sprintf("UPDATE bills SET code='%v', url='%v', date='%v', company='%v', charged='%v' WHERE id='%v' RETURNING id;", newBill.Code, newBill.Url, newBill.Date, newBill.Company.Id, newBill.Charged, billsId)
+		updateBillQuery = fmt.Sprintf("UPDATE bills SET code='%v', url='%v', date='%v', company='%v', subtotal='%v', iva_rate='%v', iva_withholding_rate='%v', islr_withholding_rate='%v', iva='%v', iva_withholding='%v', islr_withholding='%v', total='%v', currency='%v' WHERE id='%v' RETURNING id;", newBill.Code, newBill.Url, newBill.Date, newBill.Company.Id, newBill.Subtotal, newBill.IvaRate, newBill.IvaWithholdingRate, newBill.IslrWithholdingRate, newBill.Iva, newBill.IvaWithholding, newBill.IslrWithholding, newBill.Total, newBill.Currency, billsId)
 	}
 
-	rowsUpdatedId, err := db.Query(updateBillQuery)
+	err = tx.QueryRow(updateBillQuery).Scan(&updatedId)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rowsUpdatedId.Close()
-	for rowsUpdatedId.Next() {
-		err = rowsUpdatedId.Scan(&updatedId)
-		if err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
-	}
-
-	if updatedId == 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "La factura solicitada no existe")
+	err = saveBillItems(tx, updatedId, newBill.Items)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
 		return
 	}
-
-	updatedBill := types.Bill{}
-	retrieveBillQuery := fmt.Sprintf("SELECT bills.id, code, url, date, charged, company, name, national_id, bills.created_at FROM bills INNER JOIN actors ON bills.company = actors.id WHERE bills.id='%v';", updatedId)
-	rowsRetreivedBill, err := db.Query(retrieveBillQuery)
+	err = tx.Commit()
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
 
-	defer rowsRetreivedBill.Close()
-	for rowsRetreivedBill.Next() {
-		err = rowsRetreivedBill.Scan(&updatedBill.Id, &updatedBill.Code, &updatedBill.Url, &updatedBill.Date, &updatedBill.Charged, &updatedBill.Company.Id, &updatedBill.Company.Name, &updatedBill.Company.NationalId, &updatedBill.CreatedAt)
-		if err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
+	updatedBill, err := loadBill(db, updatedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
 	}
-	updatedBill.Date = strings.Split(updatedBill.Date, "T")[0]
 	response, err := json.Marshal(updatedBill)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -315,6 +618,16 @@ func DeleteBill(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	query := fmt.Sprintf("DELETE FROM bills WHERE id='%v' RETURNING id;", id)
 	rows, err := db.Query(query)
 	if err != nil {
+		if err.Error() == "pq: update or delete on table \"bills\" violates foreign key constraint \"trips_bill_fkey\" on table \"trips\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La factura que intenta borrar tiene uno o mas viajes asociados por lo que no puede ser eliminada")
+			return
+		}
+		if err.Error() == "pq: update or delete on table \"bills\" violates foreign key constraint \"transactions_with_balances_bill_fkey\" on table \"transactions_with_balances\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La factura que intenta borrar tiene uno o mas pagos asociados por lo que no puede ser eliminada")
+			return
+		}
 		utils.SendInternalServerError(err, w)
 		return
 	}
@@ -342,6 +655,588 @@ func DeleteBill(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Write(response)
 }
 
+func AttachTrip(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	billId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	tripId, err := strconv.Atoi(ps.ByName("trip_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro trip_id debe ser un número")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	var existingBillId int
+	getBillIdQuery := fmt.Sprintf("SELECT id FROM bills WHERE id='%v';", billId)
+	billIdRow, err := db.Query(getBillIdQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer billIdRow.Close()
+	for billIdRow.Next() {
+		if err := billIdRow.Scan(&existingBillId); err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	if existingBillId == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La factura con el id %v no existe", billId)
+		return
+	}
+
+	var attachedId int
+	attachQuery := fmt.Sprintf("UPDATE trips SET bill='%v', status='billed', billed_at=CURRENT_TIMESTAMP WHERE id='%v' AND bill IS NULL AND status='delivered' RETURNING id;", billId, tripId)
+	attachRow, err := db.Query(attachQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer attachRow.Close()
+	for attachRow.Next() {
+		if err := attachRow.Scan(&attachedId); err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	if attachedId == 0 {
+		var tripStatus string
+		var tripBill int
+		getTripQuery := fmt.Sprintf("SELECT status, COALESCE(bill, 0) FROM trips WHERE id='%v';", tripId)
+		tripRow, err := db.Query(getTripQuery)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		defer tripRow.Close()
+		for tripRow.Next() {
+			if err := tripRow.Scan(&tripStatus, &tripBill); err != nil {
+				utils.SendInternalServerError(err, w)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		if tripStatus == "" {
+			fmt.Fprintf(w, "El viaje con el id %v no existe", tripId)
+			return
+		}
+		if tripBill != 0 {
+			fmt.Fprintf(w, "El viaje con el id %v ya fue facturado en la factura %v", tripId, tripBill)
+			return
+		}
+		fmt.Fprintf(w, "Solo los viajes entregados pueden asociarse a una factura")
+		return
+	}
+
+	billTrips, err := trips.GetTripsByBill(db, billId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(billTrips)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func DetachTrip(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	billId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	tripId, err := strconv.Atoi(ps.ByName("trip_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro trip_id debe ser un número")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	var detachedId int
+	detachQuery := fmt.Sprintf("UPDATE trips SET bill=NULL, status='delivered', billed_at=NULL WHERE id='%v' AND bill='%v' RETURNING id;", tripId, billId)
+	detachRow, err := db.Query(detachQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer detachRow.Close()
+	for detachRow.Next() {
+		if err := detachRow.Scan(&detachedId); err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	if detachedId == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El viaje con el id %v no pertenece a la factura %v", tripId, billId)
+		return
+	}
+
+	billTrips, err := trips.GetTripsByBill(db, billId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(billTrips)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// AttachPayment registers an executed input of the company of the bill as a
+// payment of it, the payments of a bill can not exceed its total
+func AttachPayment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	billId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	transactionId, err := strconv.Atoi(ps.ByName("transaction_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro transaction_id debe ser un número")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
+
+	var company int
+	var currency string
+	err = tx.QueryRow(fmt.Sprintf("SELECT company, currency FROM bills WHERE id='%v' FOR UPDATE;", billId)).Scan(&company, &currency)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La factura con el id %v no existe", billId)
+		return
+	}
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	// locking the transaction waits for a reverse that is being executed
+	payment := types.TransactionWithBalance{}
+	var transferId int
+	var paymentBill int
+	err = tx.QueryRow(fmt.Sprintf("SELECT type, currency, amount, actor, COALESCE(reverses, 0), reversed, COALESCE(transfer, 0), COALESCE(bill, 0) FROM transactions_with_balances WHERE id='%v' FOR UPDATE;", transactionId)).Scan(&payment.Type, &payment.Currency, &payment.Amount, &payment.Actor.Id, &payment.Reverses, &payment.Reversed, &transferId, &paymentBill)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción con el id %v no existe", transactionId)
+		return
+	}
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	if payment.Type != "input" || transferId != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Solo los ingresos pueden registrarse como pagos de una factura")
+		return
+	}
+	if payment.Reverses != 0 || payment.Reversed {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Una transacción revertida o un reverso no pueden registrarse como pagos de una factura")
+		return
+	}
+	if paymentBill != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción con el id %v ya está asociada a la factura %v", transactionId, paymentBill)
+		return
+	}
+	if payment.Actor.Id != company {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El pago debe provenir de la compañía de la factura")
+		return
+	}
+	if payment.Currency != currency {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La moneda del pago debe ser la moneda de la factura (%v)", currency)
+		return
+	}
+
+	var outstanding money.Money
+	err = tx.QueryRow(fmt.Sprintf("SELECT outstanding FROM bills_with_balances WHERE id='%v';", billId)).Scan(&outstanding)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if payment.Amount.Cmp(outstanding) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El pago excede el saldo pendiente de la factura (%v)", outstanding)
+		return
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("UPDATE transactions_with_balances SET bill='%v' WHERE id='%v';", billId, transactionId))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	bill, err := loadBill(db, billId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(bill)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// DetachPayment removes a payment from the bill, the transaction remains in
+// the ledger
+func DetachPayment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	billId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	transactionId, err := strconv.Atoi(ps.ByName("transaction_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro transaction_id debe ser un número")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	var detachedId int
+	detachQuery := fmt.Sprintf("UPDATE transactions_with_balances SET bill=NULL WHERE id='%v' AND bill='%v' RETURNING id;", transactionId, billId)
+	err = db.QueryRow(detachQuery).Scan(&detachedId)
+	if err == sql.ErrNoRows {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción con el id %v no es un pago de la factura %v", transactionId, billId)
+		return
+	}
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	bill, err := loadBill(db, billId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(bill)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// layout of the invoice, in points from the top left corner
+const (
+	invoiceLeft   = 50.0
+	invoiceRight  = pdf.PageWidth - 50.0
+	invoiceTop    = 60.0
+	invoiceBottom = pdf.PageHeight - 60.0
+	invoiceLine   = 15.0
+	invoiceFont   = 9.0
+)
+
+// invoiceItemColumns are the left edge of the description and the right
+// edges of the quantity, unit, unit price and amount columns
+var invoiceItemColumns = []float64{invoiceLeft, 340, 400, 480, invoiceRight}
+
+// invoiceTotal is a row of the totals below the items, the amounts the
+// company pays are bold
+type invoiceTotal struct {
+	label  string
+	amount string
+	bold   bool
+}
+
+// invoicePDF lays out the bill as an invoice headed by the data of our
+// company, the items continue on new pages when they do not fit in one
+func invoicePDF(bill types.Bill, company types.Settings, address string) *pdf.Document {
+	document := pdf.New()
+	document.AddPage()
+
+	y := invoiceTop
+	document.Text(invoiceLeft, y, 14, true, company.CompanyName)
+	document.TextRight(invoiceRight, y, 14, true, "FACTURA")
+	y += invoiceLine
+	if company.CompanyNationalId != "" {
+		document.Text(invoiceLeft, y, invoiceFont, false, "RIF: "+company.CompanyNationalId)
+	}
+	document.TextRight(invoiceRight, y, invoiceFont, false, "N° "+bill.Code)
+	y += invoiceLine
+	document.Text(invoiceLeft, y, invoiceFont, false, pdf.Truncate(company.CompanyAddress, 80))
+	document.TextRight(invoiceRight, y, invoiceFont, false, "Fecha: "+bill.Date)
+	if company.CompanyPhone != "" {
+		y += invoiceLine
+		document.Text(invoiceLeft, y, invoiceFont, false, "Teléfono: "+company.CompanyPhone)
+	}
+
+	y += invoiceLine * 2
+	document.Rect(invoiceLeft, y-11, invoiceRight-invoiceLeft, invoiceLine*3+4)
+	for _, line := range [][]string{
+		{"Cliente:", bill.Company.Name},
+		{"RIF:", bill.Company.NationalId},
+		{"Dirección:", pdf.Truncate(address, 80)},
+	} {
+		document.Text(invoiceLeft+6, y, invoiceFont, true, line[0])
+		document.Text(invoiceLeft+60, y, invoiceFont, false, line[1])
+		y += invoiceLine
+	}
+
+	itemsHeader := func() {
+		y += invoiceLine
+		document.Text(invoiceItemColumns[0], y, invoiceFont, true, "Descripción")
+		for i, title := range []string{"Cantidad", "Unidad", "Precio unitario", "Monto"} {
+			document.TextRight(invoiceItemColumns[i+1], y, invoiceFont, true, title)
+		}
+		document.Line(invoiceLeft, y+4, invoiceRight, y+4)
+	}
+	itemsHeader()
+
+	items := bill.Items
+	if len(items) == 0 {
+		items = []types.BillItem{{Description: "Servicio de transporte", Quantity: money.MustParseQuantity("1"), UnitPrice: bill.Subtotal, Amount: bill.Subtotal}}
+	}
+	for _, item := range items {
+		y += invoiceLine
+		if y > invoiceBottom {
+			document.AddPage()
+			y = invoiceTop
+			itemsHeader()
+			y += invoiceLine
+		}
+		document.Text(invoiceItemColumns[0], y, invoiceFont, false, pdf.Truncate(item.Description, 55))
+		document.TextRight(invoiceItemColumns[1], y, invoiceFont, false, item.Quantity.String())
+		document.TextRight(invoiceItemColumns[2], y, invoiceFont, false, pdf.Truncate(item.Unit, 10))
+		document.TextRight(invoiceItemColumns[3], y, invoiceFont, false, item.UnitPrice.String())
+		document.TextRight(invoiceItemColumns[4], y, invoiceFont, false, item.Amount.String())
+	}
+
+	totals := []invoiceTotal{
+		{"Base imponible", bill.Subtotal.String(), false},
+		{fmt.Sprintf("IVA %v%%", bill.IvaRate), bill.Iva.String(), false},
+		{"Total " + bill.Currency, bill.Total.String(), true},
+	}
+	if !bill.IvaWithholding.IsZero() || !bill.IslrWithholding.IsZero() {
+		totals = append(totals,
+			invoiceTotal{"Retención de IVA", bill.IvaWithholding.Neg().String(), false},
+			invoiceTotal{"Retención de ISLR", bill.IslrWithholding.Neg().String(), false},
+			invoiceTotal{"Neto a cobrar " + bill.Currency, bill.Net.String(), true},
+		)
+	}
+	if y+invoiceLine*float64(len(totals)+1) > invoiceBottom {
+		document.AddPage()
+		y = invoiceTop
+	}
+	document.Line(invoiceLeft, y+4, invoiceRight, y+4)
+	y += invoiceLine
+	for _, total := range totals {
+		document.TextRight(invoiceItemColumns[3], y, invoiceFont, total.bold, total.label)
+		document.TextRight(invoiceItemColumns[4], y, invoiceFont, total.bold, total.amount)
+		y += invoiceLine
+	}
+	return document
+}
+
+// GetBillPDF renders the bill as an invoice ready to be printed or sent to
+// the company
+func GetBillPDF(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	billId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if billId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id de la factura debe ser mayor a cero")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	bill, err := loadBill(db, billId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if bill.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La factura con el id %v no existe", billId)
+		return
+	}
+
+	company, err := settings.Load(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	var address string
+	err = db.QueryRow(fmt.Sprintf("SELECT COALESCE(address, '') FROM actors WHERE id='%v';", bill.Company.Id)).Scan(&address)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=factura_%v.pdf", bill.Id))
+	err = invoicePDF(bill, company, address).Write(w)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+	}
+}
+
+// agingBuckets are the ranges of days used by the aging report
+var agingBuckets = []string{"0-30", "31-60", "61-90", "90+"}
+
+func agingBucket(days int) int {
+	switch {
+	case days <= 30:
+		return 0
+	case days <= 60:
+		return 1
+	case days <= 90:
+		return 2
+	}
+	return 3
+}
+
+// GetAging groups what is owed on the bills that are not fully charged per
+// company and currency by the age of the bills on the given date, today by
+// default. Filtering by company drills down into the bills of each bucket,
+// and the bucket parameter keeps only the bills of one range.
+func GetAging(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	date := query.Get("date")
+	if date == "" {
+		date = time.Now().Format(types.DateFormat)
+	}
+	asOf, err := time.Parse(types.DateFormat, date)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La fecha del reporte no tiene un formato válido")
+		return
+	}
+	conditions := []string{"bills.outstanding > 0", fmt.Sprintf("bills.date <= '%v'", date)}
+
+	companyId := 0
+	if company := query.Get("company"); company != "" {
+		companyId, err = strconv.Atoi(company)
+		if err != nil || companyId <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Id de compañía no válido")
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("bills.company='%v'", companyId))
+	}
+
+	bucket := -1
+	if requested := query.Get("bucket"); requested != "" {
+		for i, name := range agingBuckets {
+			if name == requested {
+				bucket = i
+			}
+		}
+		if bucket == -1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "El rango solo puede ser '0-30', '31-60', '61-90' o '90+'")
+			return
+		}
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	report := []types.AgingBalance{}
+	rows, err := db.Query(fmt.Sprintf("%v WHERE %v ORDER BY actors.name, bills.company, bills.currency, bills.date, bills.id;", SelectBillsQuery, strings.Join(conditions, " AND ")))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		bill, err := ScanBill(rows)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		billDate, err := time.Parse(types.DateFormat, bill.Date)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		index := agingBucket(int(asOf.Sub(billDate).Hours() / 24))
+		if bucket != -1 && index != bucket {
+			continue
+		}
+
+		last := len(report) - 1
+		if last < 0 || report[last].Company.Id != bill.Company.Id || report[last].Currency != bill.Currency {
+			balance := types.AgingBalance{Company: bill.Company, Currency: bill.Currency}
+			for _, name := range agingBuckets {
+				balance.Buckets = append(balance.Buckets, types.AgingBucket{Range: name, Bills: []types.Bill{}})
+			}
+			report = append(report, balance)
+			last++
+		}
+		balance := &report[last]
+		balance.Buckets[index].Outstanding = balance.Buckets[index].Outstanding.Add(bill.Outstanding)
+		balance.Total = balance.Total.Add(bill.Outstanding)
+		if companyId != 0 {
+			balance.Buckets[index].Bills = append(balance.Buckets[index].Bills, bill)
+		}
+	}
+
+	response, err := json.Marshal(report)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
 func GetLastBillId(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	lastBillId := types.IdResponse{
 		Id: -1,
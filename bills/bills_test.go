@@ -1,6 +1,7 @@
 package bills
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -11,6 +12,10 @@ import (
 	"testing"
 	"time"
 
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/transactions"
+	"example.com/backend_gandola_soft/trips"
 	"example.com/backend_gandola_soft/types"
 	"github.com/julienschmidt/httprouter"
 )
@@ -326,7 +331,7 @@ func TestPatchBill(t *testing.T) {
 	newBill.Url = "new_photo.jpg"
 	newBill.Date = time.Now().Local().Format(types.DateFormat)
 	newBill.Company.Id = 2
-	newBill.Charged = true
+	newBill.Subtotal = money.MustParse("100")
 	newBillJson, err := json.Marshal(newBill)
 	if err != nil {
 		t.Error("Could not marshal new bill into json")
@@ -396,7 +401,7 @@ func TestPatchBillBadDate(t *testing.T) {
 	newBill.Url = "new_photo.jpg"
 	newBill.Date = "bad date"
 	newBill.Company.Id = 2
-	newBill.Charged = true
+	newBill.Subtotal = money.MustParse("100")
 	newBillJson, err := json.Marshal(newBill)
 	if err != nil {
 		t.Error("Could not marshal new bill into json")
@@ -465,7 +470,7 @@ func TestPatchBillNoCompany(t *testing.T) {
 	newBill.Code = "1234"
 	newBill.Url = "new_photo.jpg"
 	newBill.Date = time.Now().Local().Format(types.DateFormat)
-	newBill.Charged = true
+	newBill.Subtotal = money.MustParse("100")
 	newBillJson, err := json.Marshal(newBill)
 	if err != nil {
 		t.Error("Could not marshal new bill into json")
@@ -534,7 +539,7 @@ func TestPatchBillBadCompanyType(t *testing.T) {
 	newBill.Url = "new_photo.jpg"
 	newBill.Company.Id = 1
 	newBill.Date = time.Now().Local().Format(types.DateFormat)
-	newBill.Charged = true
+	newBill.Subtotal = money.MustParse("100")
 	newBillJson, err := json.Marshal(newBill)
 	if err != nil {
 		t.Error("Could not marshal new bill into json")
@@ -604,7 +609,7 @@ func TestPatchBillNonExistingCompany(t *testing.T) {
 	newBill.Url = "new_photo.jpg"
 	newBill.Date = time.Now().Local().Format(types.DateFormat)
 	newBill.Company.Id = 9999
-	newBill.Charged = true
+	newBill.Subtotal = money.MustParse("100")
 	newBillJson, err := json.Marshal(newBill)
 	if err != nil {
 		t.Error("Could not marshal new bill into json")
@@ -645,7 +650,7 @@ func TestPatchBillBadId(t *testing.T) {
 	newBill.Code = "1234"
 	newBill.Url = "new_photo.jpg"
 	newBill.Date = time.Now().Local().Format(types.DateFormat)
-	newBill.Charged = true
+	newBill.Subtotal = money.MustParse("100")
 	newBillJson, err := json.Marshal(newBill)
 	if err != nil {
 		t.Error("Could not marshal new bill into json")
@@ -687,7 +692,7 @@ func TestPatchBillNonExistingId(t *testing.T) {
 	newBill.Url = "new_photo.jpg"
 	newBill.Date = time.Now().Local().Format(types.DateFormat)
 	newBill.Company.Id = 2
-	newBill.Charged = true
+	newBill.Subtotal = money.MustParse("100")
 	newBillJson, err := json.Marshal(newBill)
 	if err != nil {
 		t.Error("Could not marshal new bill into json")
@@ -845,4 +850,510 @@ func TestDeleteBillBadId(t *testing.T) {
 	if response != wanted {
 		t.Errorf("response = '%v', want = '%v'", response, wanted)
 	}
-}
\ No newline at end of file
+}
+func TestGetBill(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/bills/:id", GetBill)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/bills/1", nil)
+
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing for a bill with its trips")
+	bill := types.Bill{}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	err = json.Unmarshal(body, &bill)
+	if err != nil {
+		t.Error("Response body does not contain a Bill type")
+	}
+	if bill.Id != 1 {
+		t.Errorf("bill.Id = %v, want %v", bill.Id, 1)
+	}
+	if bill.Trips == nil {
+		t.Error("bill.Trips should be an array")
+	}
+}
+
+func TestAttachTripToBill(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/bills", CreateBill)
+	router.GET("/bills/:id", GetBill)
+	router.PATCH("/bills/:id", PatchBill)
+	router.PUT("/bills/:id/trips/:trip_id", AttachTrip)
+	router.DELETE("/bills/:id/trips/:trip_id", DetachTrip)
+	router.PUT("/bills/:id/payments/:transaction_id", AttachPayment)
+	router.POST("/transactions", transactions.CreateTransaction)
+	router.POST("/trips", trips.CreateTrip)
+	router.PUT("/trips/:id/load", trips.LoadTrip)
+	router.PUT("/trips/:id/start", trips.StartTrip)
+	router.PUT("/trips/:id/deliver", trips.DeliverTrip)
+
+	newBill := types.Bill{}
+	newBill.Code = "trip-bill"
+	newBill.Company.Id = 2
+	rr := testutils.MakeRequest(t, router, "POST", "/bills", newBill)
+	createdBill := types.Bill{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdBill)
+	if err != nil {
+		t.Error("Response body does not contain a Bill type")
+	}
+
+	newTrip := types.Trip{}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 3
+	newTrip.Truck.Id = 1
+	newTrip.Cargo = "arena"
+	newTrip.Amount = 20
+	newTrip.Unit = "metros"
+	rr = testutils.MakeRequest(t, router, "POST", "/trips", newTrip)
+	createdTrip := types.Trip{}
+	err = json.Unmarshal(rr.Body.Bytes(), &createdTrip)
+	if err != nil {
+		t.Error("Response body does not contain a Trip type")
+	}
+
+	attachUrl := fmt.Sprintf("/bills/%v/trips/%v", createdBill.Id, createdTrip.Id)
+	t.Log("testing a trip that was not delivered can not be attached")
+	rr = testutils.MakeRequest(t, router, "PUT", attachUrl, nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "Solo los viajes entregados pueden asociarse a una factura"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', want = '%v'", rr.Body.String(), wanted)
+	}
+
+	for _, action := range []string{"load", "start", "deliver"} {
+		testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/trips/%v/%v", createdTrip.Id, action), nil)
+	}
+
+	t.Log("testing a delivered trip can be attached")
+	rr = testutils.MakeRequest(t, router, "PUT", attachUrl, nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing the same trip can not be billed twice")
+	rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/bills/1/trips/%v", createdTrip.Id), nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted = fmt.Sprintf("El viaje con el id %v ya fue facturado en la factura %v", createdTrip.Id, createdBill.Id)
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', want = '%v'", rr.Body.String(), wanted)
+	}
+
+	t.Log("testing trips of a charged bill are paid")
+	createdBill.Subtotal = money.MustParse("80")
+	rr = testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/bills/%v", createdBill.Id), createdBill)
+	patchedBill := types.Bill{}
+	err = json.Unmarshal(rr.Body.Bytes(), &patchedBill)
+	if err != nil {
+		t.Error("Response body does not contain a Bill type")
+	}
+	payment := createPayment(t, router, createdBill.Company.Id, patchedBill.Net.String())
+	testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/bills/%v/payments/%v", createdBill.Id, payment.Id), nil)
+	rr = testutils.MakeRequest(t, router, "GET", fmt.Sprintf("/bills/%v", createdBill.Id), nil)
+	billWithTrips := types.Bill{}
+	err = json.Unmarshal(rr.Body.Bytes(), &billWithTrips)
+	if err != nil {
+		t.Error("Response body does not contain a Bill type")
+	}
+	if len(billWithTrips.Trips) != 1 {
+		t.Fatalf("len(billWithTrips.Trips) = %v, want %v", len(billWithTrips.Trips), 1)
+	}
+	if !billWithTrips.Trips[0].Paid {
+		t.Errorf("billWithTrips.Trips[0].Paid = %v, want %v", billWithTrips.Trips[0].Paid, true)
+	}
+	if billWithTrips.Trips[0].Status != "billed" {
+		t.Errorf("billWithTrips.Trips[0].Status = %v, want %v", billWithTrips.Trips[0].Status, "billed")
+	}
+
+	t.Log("testing a trip can be detached from its bill")
+	rr = testutils.MakeRequest(t, router, "DELETE", attachUrl, nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+}
+
+func createPayment(t *testing.T, router *httprouter.Router, company int, amount string) types.TransactionWithBalance {
+	transaction := types.TransactionWithBalance{}
+	transaction.Type = "input"
+	transaction.Currency = "USD"
+	transaction.Amount = money.MustParse(amount)
+	transaction.Description = "bill payment"
+	transaction.Actor.Id = company
+	transaction.Account.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/transactions", transaction)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdTransaction := types.TransactionWithBalance{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdTransaction)
+	if err != nil {
+		t.Fatal("Response body does not contain a TransactionWithBalance type")
+	}
+	return createdTransaction
+}
+
+func TestBillPayments(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/bills", CreateBill)
+	router.PATCH("/bills/:id", PatchBill)
+	router.PUT("/bills/:id/payments/:transaction_id", AttachPayment)
+	router.DELETE("/bills/:id/payments/:transaction_id", DetachPayment)
+	router.POST("/transactions", transactions.CreateTransaction)
+
+	newBill := types.Bill{}
+	newBill.Code = "payments-bill"
+	newBill.Company.Id = 2
+	newBill.Subtotal = money.MustParse("100")
+	rr := testutils.MakeRequest(t, router, "POST", "/bills", newBill)
+	createdBill := types.Bill{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+	if createdBill.Currency != "USD" || !createdBill.Outstanding.Equal(createdBill.Net) {
+		t.Errorf("bill = %v %v outstanding, want USD %v", createdBill.Currency, createdBill.Outstanding, createdBill.Net)
+	}
+
+	t.Log("testing a partial payment reduces the outstanding balance")
+	first := createPayment(t, router, 2, "60")
+	rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/bills/%v/payments/%v", createdBill.Id, first.Id), nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	paidBill := types.Bill{}
+	err = json.Unmarshal(rr.Body.Bytes(), &paidBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+	outstanding := createdBill.Net.Sub(first.Amount)
+	if !paidBill.Outstanding.Equal(outstanding) || paidBill.Charged || len(paidBill.Payments) != 1 {
+		t.Errorf("bill outstanding = %v charged = %v payments = %v, want %v false 1", paidBill.Outstanding, paidBill.Charged, len(paidBill.Payments), outstanding)
+	}
+
+	t.Log("testing a payment can not exceed the outstanding balance")
+	second := createPayment(t, router, 2, createdBill.Net.String())
+	rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/bills/%v/payments/%v", createdBill.Id, second.Id), nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := fmt.Sprintf("El pago excede el saldo pendiente de la factura (%v)", outstanding)
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', want = '%v'", rr.Body.String(), wanted)
+	}
+
+	t.Log("testing what is owed can not be lower than what was paid")
+	createdBill.Subtotal = money.MustParse("50")
+	rr = testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/bills/%v", createdBill.Id), createdBill)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+
+	t.Log("testing the bill is charged once the payments cover what is owed")
+	createdBill.Subtotal = money.MustParse("200")
+	rr = testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/bills/%v", createdBill.Id), createdBill)
+	err = json.Unmarshal(rr.Body.Bytes(), &paidBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+	last := createPayment(t, router, 2, paidBill.Outstanding.String())
+	rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/bills/%v/payments/%v", createdBill.Id, last.Id), nil)
+	err = json.Unmarshal(rr.Body.Bytes(), &paidBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+	if !paidBill.Outstanding.IsZero() || !paidBill.Charged {
+		t.Errorf("bill outstanding = %v charged = %v, want 0.00 true", paidBill.Outstanding, paidBill.Charged)
+	}
+
+	t.Log("testing a detached payment is owed again")
+	rr = testutils.MakeRequest(t, router, "DELETE", fmt.Sprintf("/bills/%v/payments/%v", createdBill.Id, first.Id), nil)
+	err = json.Unmarshal(rr.Body.Bytes(), &paidBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+	if !paidBill.Outstanding.Equal(first.Amount) || paidBill.Charged {
+		t.Errorf("bill outstanding = %v charged = %v, want %v false", paidBill.Outstanding, paidBill.Charged, first.Amount)
+	}
+}
+
+func TestAttachPaymentFromAnotherActor(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/bills", CreateBill)
+	router.PUT("/bills/:id/payments/:transaction_id", AttachPayment)
+	router.POST("/transactions", transactions.CreateTransaction)
+
+	newBill := types.Bill{}
+	newBill.Code = "foreign-payment"
+	newBill.Company.Id = 2
+	newBill.Subtotal = money.MustParse("100")
+	rr := testutils.MakeRequest(t, router, "POST", "/bills", newBill)
+	createdBill := types.Bill{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+
+	payment := createPayment(t, router, 1, "10")
+	rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/bills/%v/payments/%v", createdBill.Id, payment.Id), nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "El pago debe provenir de la compañía de la factura"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', want = '%v'", rr.Body.String(), wanted)
+	}
+}
+
+func TestGetAging(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/bills", CreateBill)
+	router.GET("/reports/aging", GetAging)
+
+	newBill := types.Bill{}
+	newBill.Code = "aging-bill"
+	newBill.Company.Id = 2
+	newBill.Date = time.Now().AddDate(0, 0, -45).Format(types.DateFormat)
+	newBill.Subtotal = money.MustParse("75")
+	rr := testutils.MakeRequest(t, router, "POST", "/bills", newBill)
+	createdBill := types.Bill{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+
+	rr = testutils.MakeRequest(t, router, "GET", "/reports/aging?company=2&bucket=31-60", nil)
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	report := []types.AgingBalance{}
+	err = json.Unmarshal(rr.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatal("Response body does not contain an array of type AgingBalance")
+	}
+
+	t.Log("testing the bill is listed in the 31-60 bucket of its company")
+	found := false
+	for _, balance := range report {
+		if balance.Company.Id != 2 || balance.Currency != "USD" {
+			continue
+		}
+		if !balance.Buckets[0].Outstanding.IsZero() {
+			t.Errorf("0-30 bucket = %v, want 0.00 when filtering by 31-60", balance.Buckets[0].Outstanding)
+		}
+		for _, bill := range balance.Buckets[1].Bills {
+			found = found || bill.Id == createdBill.Id
+		}
+	}
+	if !found {
+		t.Errorf("bill %v is not in the 31-60 bucket", createdBill.Id)
+	}
+}
+
+func TestGetAgingWithBadBucket(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/reports/aging", GetAging)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/reports/aging?bucket=10-20", nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "El rango solo puede ser '0-30', '31-60', '61-90' o '90+'"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', want = '%v'", rr.Body.String(), wanted)
+	}
+}
+
+func TestCreateBillWithItems(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/bills", CreateBill)
+
+	newBill := types.Bill{}
+	newBill.Code = "items-bill"
+	newBill.Company.Id = 2
+	newBill.Subtotal = money.MustParse("1")
+	newBill.Items = []types.BillItem{
+		{Description: "flete de arena", Quantity: money.MustParseQuantity("2.5"), Unit: "viajes", UnitPrice: money.MustParse("120")},
+		{Description: "peaje", Quantity: money.MustParseQuantity("1"), UnitPrice: money.MustParse("15.25")},
+	}
+	rr := testutils.MakeRequest(t, router, "POST", "/bills", newBill)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdBill := types.Bill{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+
+	t.Log("testing the subtotal is the sum of the items")
+	if len(createdBill.Items) != 2 {
+		t.Fatalf("len(createdBill.Items) = %v, want 2", len(createdBill.Items))
+	}
+	if !createdBill.Items[0].Amount.Equal(money.MustParse("300")) {
+		t.Errorf("item amount = %v, want 300.00", createdBill.Items[0].Amount)
+	}
+	if !createdBill.Subtotal.Equal(money.MustParse("315.25")) {
+		t.Errorf("subtotal = %v, want 315.25", createdBill.Subtotal)
+	}
+	if !createdBill.Total.Equal(createdBill.Subtotal.Add(createdBill.Iva)) {
+		t.Errorf("total = %v, want subtotal plus IVA", createdBill.Total)
+	}
+}
+
+func TestCreateBillWithItemWithoutDescription(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/bills", CreateBill)
+
+	newBill := types.Bill{}
+	newBill.Code = "items-bill"
+	newBill.Company.Id = 2
+	newBill.Items = []types.BillItem{{Quantity: money.MustParseQuantity("1"), UnitPrice: money.MustParse("10")}}
+	rr := testutils.MakeRequest(t, router, "POST", "/bills", newBill)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "Cada línea de la factura debe poseer una descripción"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', want = '%v'", rr.Body.String(), wanted)
+	}
+}
+
+func TestCreateBillWithOnlyTotal(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/bills", CreateBill)
+
+	newBill := types.Bill{}
+	newBill.Code = "total-bill"
+	newBill.Company.Id = 2
+	newBill.Total = money.MustParse("100")
+	rr := testutils.MakeRequest(t, router, "POST", "/bills", newBill)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "Debe especificar las líneas o la base imponible de la factura, el total se calcula a partir de ellas"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', want = '%v'", rr.Body.String(), wanted)
+	}
+}
+
+func TestPatchBillKeepsItsRates(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/bills", CreateBill)
+	router.PATCH("/bills/:id", PatchBill)
+
+	newBill := types.Bill{}
+	newBill.Code = "rates-bill"
+	newBill.Company.Id = 2
+	newBill.Subtotal = money.MustParse("100")
+	newBill.IvaRate = money.MustParse("8")
+	rr := testutils.MakeRequest(t, router, "POST", "/bills", newBill)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdBill := types.Bill{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+	if createdBill.Iva.String() != "8.00" {
+		t.Fatalf("iva = %v, want 8.00 with the rate sent", createdBill.Iva)
+	}
+
+	t.Log("testing a patch without rates keeps the ones of the bill")
+	body := map[string]interface{}{"Code": "rates-bill-2", "Company": map[string]int{"Id": 2}, "Subtotal": "100"}
+	rr = testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/bills/%v", createdBill.Id), body)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	patchedBill := types.Bill{}
+	err = json.Unmarshal(rr.Body.Bytes(), &patchedBill)
+	if err != nil {
+		t.Fatal("Response body does not contain a Bill type")
+	}
+	if !patchedBill.IvaRate.Equal(money.MustParse("8")) || patchedBill.Iva.String() != "8.00" {
+		t.Errorf("iva rate/iva = %v/%v, want 8.00/8.00", patchedBill.IvaRate, patchedBill.Iva)
+	}
+}
+
+func TestComputeBillTotals(t *testing.T) {
+	rates := types.Settings{IvaRate: money.MustParse("16"), IvaWithholdingRate: money.MustParse("75"), IslrWithholdingRate: money.MustParse("3")}
+	bill := types.Bill{Items: []types.BillItem{{Quantity: money.MustParseQuantity("3"), UnitPrice: money.MustParse("333.33")}}}
+
+	t.Log("testing an ordinary taxpayer pays the total")
+	computeBillTotals(&bill, rates, false, 2)
+	if bill.Subtotal.String() != "999.99" || bill.Iva.String() != "160.00" || bill.Total.String() != "1159.99" {
+		t.Errorf("subtotal/iva/total = %v/%v/%v, want 999.99/160.00/1159.99", bill.Subtotal, bill.Iva, bill.Total)
+	}
+	if !bill.Net.Equal(bill.Total) {
+		t.Errorf("net = %v, want %v", bill.Net, bill.Total)
+	}
+
+	t.Log("testing a special taxpayer withholds IVA and ISLR")
+	computeBillTotals(&bill, rates, true, 2)
+	if bill.IvaWithholding.String() != "120.00" || bill.IslrWithholding.String() != "30.00" || bill.Net.String() != "1009.99" {
+		t.Errorf("withholdings/net = %v/%v/%v, want 120.00/30.00/1009.99", bill.IvaWithholding, bill.IslrWithholding, bill.Net)
+	}
+
+	t.Log("testing the amounts are rounded to the decimals of the currency")
+	bill = types.Bill{Subtotal: money.MustParse("1003")}
+	computeBillTotals(&bill, rates, true, 0)
+	if bill.Iva.String() != "160.00" || bill.IvaWithholding.String() != "120.00" || bill.IslrWithholding.String() != "30.00" {
+		t.Errorf("iva/withholdings = %v/%v/%v, want 160.00/120.00/30.00", bill.Iva, bill.IvaWithholding, bill.IslrWithholding)
+	}
+}
+
+func TestGetBillPDF(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/bills/:id/pdf", GetBillPDF)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/bills/1/pdf", nil)
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/pdf" {
+		t.Errorf("content type = %v, want application/pdf", contentType)
+	}
+	if !strings.HasPrefix(rr.Body.String(), "%PDF-") {
+		t.Error("response is not a PDF document")
+	}
+}
+
+func TestInvoicePDF(t *testing.T) {
+	company := types.Settings{CompanyName: "Transporte Gandola", CompanyNationalId: "J-00000000-0"}
+	bill := types.Bill{Code: "0001", Date: "2022-01-15", Currency: "USD"}
+	bill.Company.Name = "Compañía cero"
+	for i := 0; i < 60; i++ {
+		bill.Items = append(bill.Items, types.BillItem{Description: "flete", Quantity: money.MustParseQuantity("1"), UnitPrice: money.FromInt(10), Amount: money.FromInt(10)})
+	}
+	computeBillTotals(&bill, types.Settings{IvaRate: money.FromInt(16), IvaWithholdingRate: money.FromInt(75), IslrWithholdingRate: money.FromInt(3)}, true, 2)
+
+	document := invoicePDF(bill, company, "Ciudad Bolívar")
+	t.Log("testing that the items overflow to a second page")
+	if document.Pages() < 2 {
+		t.Errorf("pages = %v, want at least 2", document.Pages())
+	}
+	out := &bytes.Buffer{}
+	if err := document.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("testing that the withholdings and the net are printed")
+	for _, text := range []string{"(FACTURA)", "(Neto a cobrar USD)", "(" + bill.Net.String() + ")"} {
+		if !bytes.Contains(out.Bytes(), []byte(text)) {
+			t.Errorf("invoice does not contain %v", text)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package categories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+const selectCategoriesQuery = "SELECT id, name, COALESCE(parent, 0), created_at FROM categories"
+
+// totals of the transactions without a category are reported under this name
+const uncategorizedName = "Sin categoría"
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadCategories returns every category by id, without children
+func loadCategories(q querier) (map[int]types.Category, error) {
+	categories := map[int]types.Category{}
+	rows, err := q.Query(selectCategoriesQuery + ";")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		category := types.Category{}
+		err = rows.Scan(&category.Id, &category.Name, &category.Parent, &category.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		categories[category.Id] = category
+	}
+	return categories, nil
+}
+
+// tree nests the categories under their parents, starting from parentId and
+// sorted by name on every level
+func tree(categories map[int]types.Category, parentId int) []types.Category {
+	children := []types.Category{}
+	for _, category := range categories {
+		if category.Parent == parentId {
+			category.Children = tree(categories, category.Id)
+			children = append(children, category)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return strings.ToLower(children[i].Name) < strings.ToLower(children[j].Name)
+	})
+	return children
+}
+
+// GetCategories returns the top level categories with their subcategories
+func GetCategories(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	db := database.ConnectDB()
+	defer db.Close()
+	categories, err := loadCategories(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	json_categories, err := json.Marshal(tree(categories, 0))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json_categories)
+}
+
+func readCategory(r *http.Request, category *types.Category) string {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "No se pudo leer el cuerpo de la petición"
+	}
+	err = json.Unmarshal(body, category)
+	if err != nil {
+		return "La data recibida no corresponde con una categoría"
+	}
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return "La categoría debe poseer un nombre"
+	}
+	if category.Parent < 0 {
+		return "La categoría padre especificada no existe"
+	}
+	return ""
+}
+
+// saveError turns the constraint violations of an insert or update of a
+// category into a message for the client
+func saveError(err error, category types.Category) string {
+	switch err.Error() {
+	case "pq: duplicate key value violates unique constraint \"categories_parent_name_key\"":
+		return fmt.Sprintf("Ya existe una categoría llamada %v en ese nivel", category.Name)
+	case "pq: insert or update on table \"categories\" violates foreign key constraint \"categories_parent_fkey\"":
+		return "La categoría padre especificada no existe"
+	}
+	return ""
+}
+
+func CreateCategory(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	category := types.Category{}
+	if message := readCategory(r, &category); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	insertCategoryQuery := fmt.Sprintf("INSERT INTO categories (name, parent) VALUES ('%v', %v) RETURNING id, name, COALESCE(parent, 0), created_at;", category.Name, ledger.Nullable(category.Parent))
+	insertedCategory := types.Category{}
+	err := db.QueryRow(insertCategoryQuery).Scan(&insertedCategory.Id, &insertedCategory.Name, &insertedCategory.Parent, &insertedCategory.CreatedAt)
+	if err != nil {
+		if message := saveError(err, category); message != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, message)
+			return
+		}
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	insertedCategory.Children = []types.Category{}
+
+	response, err := json.Marshal(insertedCategory)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// PatchCategory renames a category or moves it under another parent, a
+// category can not be moved under itself or any of its subcategories
+func PatchCategory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	categoryId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil || categoryId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Id de categoría no válido")
+		return
+	}
+	category := types.Category{}
+	if message := readCategory(r, &category); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	categories, err := loadCategories(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if _, found := categories[categoryId]; !found {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La categoría con el id %v no existe", categoryId)
+		return
+	}
+	for ancestor := category.Parent; ancestor != 0; ancestor = categories[ancestor].Parent {
+		if ancestor == categoryId {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Una categoría no puede ser subcategoría de sí misma ni de sus subcategorías")
+			return
+		}
+		if _, found := categories[ancestor]; !found {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La categoría padre especificada no existe")
+			return
+		}
+	}
+
+	updateQuery := fmt.Sprintf("UPDATE categories SET name='%v', parent=%v WHERE id='%v';", category.Name, ledger.Nullable(category.Parent), categoryId)
+	_, err = db.Exec(updateQuery)
+	if err != nil {
+		if message := saveError(err, category); message != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, message)
+			return
+		}
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	categories, err = loadCategories(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	updatedCategory := categories[categoryId]
+	updatedCategory.Children = tree(categories, categoryId)
+	response, err := json.Marshal(updatedCategory)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// DeleteCategory removes a category without subcategories nor transactions
+func DeleteCategory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	categoryId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil || categoryId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Id de categoría no válido")
+		return
+	}
+	db := database.ConnectDB()
+	defer db.Close()
+
+	deletedId := types.IdResponse{}
+	err = db.QueryRow(fmt.Sprintf("DELETE FROM categories WHERE id='%v' RETURNING id;", categoryId)).Scan(&deletedId.Id)
+	if err != nil && err != sql.ErrNoRows {
+		switch err.Error() {
+		case "pq: update or delete on table \"categories\" violates foreign key constraint \"categories_parent_fkey\" on table \"categories\"":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La categoría que intenta borrar tiene subcategorías por lo que no puede ser eliminada")
+			return
+		case "pq: update or delete on table \"categories\" violates foreign key constraint \"transactions_with_balances_category_fkey\" on table \"transactions_with_balances\"",
+			"pq: update or delete on table \"categories\" violates foreign key constraint \"pending_transactions_category_fkey\" on table \"pending_transactions\"":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La categoría que intenta borrar tiene una o mas transacciones asociadas por lo que no puede ser eliminada")
+			return
+		}
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if deletedId.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La categoría con el id %v no existe", categoryId)
+		return
+	}
+
+	response, err := json.Marshal(deletedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// periodFormats are the postgres formats of the periods the category totals
+// can be grouped by, the empty period covers the whole date range
+var periodFormats = map[string]string{
+	"":      "",
+	"month": "YYYY-MM",
+	"year":  "YYYY",
+}
+
+type totalKey struct {
+	category int
+	period   string
+	currency string
+}
+
+// GetCategoryTotals returns what was received and spent under every category
+// between the from and to dates, grouped by period=month or period=year. The
+// totals of a category include those of its subcategories. Transfers between
+// accounts and reversed transactions are left out.
+func GetCategoryTotals(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	conditions := []string{"transfer IS NULL", "reverses IS NULL", "reversed = FALSE", "amount > 0"}
+	from := query.Get("from")
+	if from != "" {
+		if _, err := time.Parse(types.DateFormat, from); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La fecha de inicio no tiene un formato válido")
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("executed::date >= '%v'", from))
+	}
+	to := query.Get("to")
+	if to != "" {
+		if _, err := time.Parse(types.DateFormat, to); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La fecha de fin no tiene un formato válido")
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("executed::date <= '%v'", to))
+	}
+	if from != "" && to != "" && to < from {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La fecha de fin es anterior a la fecha de inicio")
+		return
+	}
+	format, valid := periodFormats[query.Get("period")]
+	if !valid {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El periodo solo puede ser 'month' o 'year'")
+		return
+	}
+	period := "''"
+	if format != "" {
+		period = fmt.Sprintf("to_char(executed, '%v')", format)
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	categories, err := loadCategories(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	totalsQuery := fmt.Sprintf("SELECT COALESCE(category, 0), %v, currency, COALESCE(SUM(amount) FILTER (WHERE type = 'input'), 0), COALESCE(SUM(amount) FILTER (WHERE type = 'output'), 0) FROM transactions_with_balances WHERE %v GROUP BY 1, 2, 3;", period, strings.Join(conditions, " AND "))
+	rows, err := db.Query(totalsQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+
+	// the totals of every category are added to all of its ancestors
+	totals := map[totalKey]*types.CategoryTotal{}
+	for rows.Next() {
+		var categoryId int
+		var period, currency string
+		var input, output money.Money
+		err = rows.Scan(&categoryId, &period, &currency, &input, &output)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		for id := categoryId; ; id = categories[id].Parent {
+			key := totalKey{id, period, currency}
+			total, found := totals[key]
+			if !found {
+				total = &types.CategoryTotal{Period: period, Currency: currency}
+				total.Category.Id = id
+				total.Category.Name = uncategorizedName
+				if id != 0 {
+					total.Category.Name = categories[id].Name
+					total.Parent = categories[id].Parent
+				}
+				totals[key] = total
+			}
+			total.Input = total.Input.Add(input)
+			total.Output = total.Output.Add(output)
+			total.Net = total.Input.Sub(total.Output)
+			if id == 0 || categories[id].Parent == 0 {
+				break
+			}
+		}
+	}
+
+	report := []types.CategoryTotal{}
+	for _, total := range totals {
+		report = append(report, *total)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Period != report[j].Period {
+			return report[i].Period < report[j].Period
+		}
+		if report[i].Category.Id != report[j].Category.Id {
+			return report[i].Category.Id < report[j].Category.Id
+		}
+		return report[i].Currency < report[j].Currency
+	})
+
+	response, err := json.Marshal(report)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
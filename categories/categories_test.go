@@ -0,0 +1,246 @@
+package categories
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/transactions"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+func createCategory(t *testing.T, router *httprouter.Router, parent int) types.Category {
+	category := types.Category{Name: utils.RandStringBytes(10), Parent: parent}
+	rr := testutils.MakeRequest(t, router, "POST", "/categories", category)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdCategory := types.Category{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdCategory)
+	if err != nil {
+		t.Fatal("Response body does not contain an object of type Category")
+	}
+	return createdCategory
+}
+
+func TestGetCategories(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/categories", GetCategories)
+	router.POST("/categories", CreateCategory)
+
+	parent := createCategory(t, router, 0)
+	child := createCategory(t, router, parent.Id)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/categories", nil)
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing that the subcategory is nested under its parent")
+	categories := []types.Category{}
+	err := json.Unmarshal(rr.Body.Bytes(), &categories)
+	if err != nil {
+		t.Fatal("Response body does not contain an array of type Category")
+	}
+	found := false
+	for _, category := range categories {
+		if category.Id == child.Id {
+			t.Errorf("subcategory %v is listed as a top level category", child.Id)
+		}
+		if category.Id == parent.Id {
+			found = len(category.Children) == 1 && category.Children[0].Id == child.Id
+		}
+	}
+	if !found {
+		t.Errorf("category %v should have the subcategory %v", parent.Id, child.Id)
+	}
+}
+
+func TestCreateCategoryWithoutName(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/categories", CreateCategory)
+
+	rr := testutils.MakeRequest(t, router, "POST", "/categories", types.Category{Name: "  "})
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La categoría debe poseer un nombre"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestPatchCategoryUnderItsSubcategory(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/categories", CreateCategory)
+	router.PATCH("/categories/:id", PatchCategory)
+
+	parent := createCategory(t, router, 0)
+	child := createCategory(t, router, parent.Id)
+
+	parent.Parent = child.Id
+	rr := testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/categories/%v", parent.Id), parent)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "Una categoría no puede ser subcategoría de sí misma ni de sus subcategorías"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestDeleteCategoryWithSubcategories(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/categories", CreateCategory)
+	router.DELETE("/categories/:id", DeleteCategory)
+
+	parent := createCategory(t, router, 0)
+	createCategory(t, router, parent.Id)
+
+	rr := testutils.MakeRequest(t, router, "DELETE", fmt.Sprintf("/categories/%v", parent.Id), nil)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La categoría que intenta borrar tiene subcategorías por lo que no puede ser eliminada"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestGetCategoryTotals(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/categories", CreateCategory)
+	router.POST("/transactions", transactions.CreateTransaction)
+	router.GET("/reports/categories", GetCategoryTotals)
+
+	parent := createCategory(t, router, 0)
+	child := createCategory(t, router, parent.Id)
+
+	t.Log("registering an input on the parent and an output on the subcategory")
+	for _, entry := range []struct {
+		transactionType string
+		amount          string
+		category        int
+	}{{"input", "30", parent.Id}, {"output", "12.5", child.Id}} {
+		transaction := types.TransactionWithBalance{}
+		transaction.Type = entry.transactionType
+		transaction.Currency = "USD"
+		transaction.Amount = money.MustParse(entry.amount)
+		transaction.Description = "category totals"
+		transaction.Actor.Id = 1
+		transaction.Account.Id = 1
+		transaction.Category.Id = entry.category
+		rr := testutils.MakeRequest(t, router, "POST", "/transactions", transaction)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+		}
+	}
+
+	rr := testutils.MakeRequest(t, router, "GET", "/reports/categories", nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	totals := []types.CategoryTotal{}
+	err := json.Unmarshal(rr.Body.Bytes(), &totals)
+	if err != nil {
+		t.Fatal("Response body does not contain an array of type CategoryTotal")
+	}
+
+	t.Log("testing that the parent includes the totals of its subcategory")
+	found := 0
+	for _, total := range totals {
+		if total.Currency != "USD" {
+			continue
+		}
+		switch total.Category.Id {
+		case parent.Id:
+			found++
+			if !total.Input.Equal(money.MustParse("30")) || !total.Output.Equal(money.MustParse("12.5")) || !total.Net.Equal(money.MustParse("17.5")) {
+				t.Errorf("parent totals = %v/%v/%v, want 30.00/12.50/17.50", total.Input, total.Output, total.Net)
+			}
+		case child.Id:
+			found++
+			if !total.Input.IsZero() || !total.Output.Equal(money.MustParse("12.5")) {
+				t.Errorf("subcategory totals = %v/%v, want 0.00/12.50", total.Input, total.Output)
+			}
+			if total.Parent != parent.Id {
+				t.Errorf("subcategory parent = %v, want %v", total.Parent, parent.Id)
+			}
+		}
+	}
+	if found != 2 {
+		t.Errorf("found %v category totals, want 2", found)
+	}
+}
+
+func TestGetCategoryTotalsWithBadPeriod(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/reports/categories", GetCategoryTotals)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/reports/categories?period=week", nil)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "El periodo solo puede ser 'month' o 'year'"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestPatchTransactionDescriptionKeepsCategory(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/categories", CreateCategory)
+	router.POST("/transactions", transactions.CreateTransaction)
+	router.PATCH("/transactions/:id", transactions.PatchTransaction)
+
+	category := createCategory(t, router, 0)
+	transaction := types.TransactionWithBalance{}
+	transaction.Type = "input"
+	transaction.Currency = "USD"
+	transaction.Amount = money.MustParse("3")
+	transaction.Description = "categorized transaction"
+	transaction.Actor.Id = 1
+	transaction.Account.Id = 1
+	transaction.Category.Id = category.Id
+	rr := testutils.MakeRequest(t, router, "POST", "/transactions", transaction)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdTransaction := types.TransactionWithBalance{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdTransaction)
+	if err != nil {
+		t.Fatal("Response body does not contain a TransactionWithBalance type")
+	}
+
+	t.Log("testing a patch with only the description keeps the category")
+	body := map[string]string{"Description": "categorized transaction patched"}
+	rr = testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/transactions/%v", createdTransaction.Id), body)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	patchedTransaction := types.TransactionWithBalance{}
+	err = json.Unmarshal(rr.Body.Bytes(), &patchedTransaction)
+	if err != nil {
+		t.Fatal("Response body does not contain a TransactionWithBalance type")
+	}
+	if patchedTransaction.Description != body["Description"] {
+		t.Errorf("Description = %v, want %v", patchedTransaction.Description, body["Description"])
+	}
+	if patchedTransaction.Category.Id != category.Id {
+		t.Errorf("Category.Id = %v, want %v", patchedTransaction.Category.Id, category.Id)
+	}
+}
@@ -0,0 +1,210 @@
+package currencies
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+const selectCurrenciesQuery = "SELECT code, name, symbol, precision, created_at FROM currencies"
+
+func GetCurrencies(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	currencies := []types.Currency{}
+	db := database.ConnectDB()
+	defer db.Close()
+	rows, err := db.Query(selectCurrenciesQuery + " ORDER BY code;")
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		currency := types.Currency{}
+		err := rows.Scan(&currency.Code, &currency.Name, &currency.Symbol, &currency.Precision, &currency.CreatedAt)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		currencies = append(currencies, currency)
+	}
+	json_currencies, err := json.Marshal(currencies)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json_currencies)
+}
+
+func validateCurrency(currency *types.Currency) string {
+	currency.Name = strings.TrimSpace(currency.Name)
+	currency.Symbol = strings.TrimSpace(currency.Symbol)
+	if currency.Name == "" {
+		return "Debe especificar el nombre de la moneda"
+	}
+	if currency.Symbol == "" {
+		return "Debe especificar el símbolo de la moneda"
+	}
+	if currency.Precision < 0 || currency.Precision > money.Decimals {
+		return fmt.Sprintf("La precisión de la moneda debe estar entre 0 y %v decimales", money.Decimals)
+	}
+	return ""
+}
+
+func CreateCurrency(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	currency := types.Currency{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &currency)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con una moneda")
+		return
+	}
+	currency.Code = strings.ToUpper(strings.TrimSpace(currency.Code))
+	if !ledger.CurrencyCode.MatchString(currency.Code) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El código de la moneda debe poseer tres letras")
+		return
+	}
+	if message := validateCurrency(&currency); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	insertCurrencyQuery := fmt.Sprintf("INSERT INTO currencies (code, name, symbol, precision) VALUES ('%v', '%v', '%v', '%v');", currency.Code, currency.Name, currency.Symbol, currency.Precision)
+	_, err = db.Exec(insertCurrencyQuery)
+	if err != nil {
+		if err.Error() == "pq: duplicate key value violates unique constraint \"currencies_pkey\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La moneda %v ya está registrada", currency.Code)
+			return
+		}
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	insertedCurrency, err := ledger.LookupCurrency(db, currency.Code)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(insertedCurrency)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// PatchCurrency changes the name and the symbol of a currency, its precision
+// can only change while it has no ledger entries
+func PatchCurrency(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	code := strings.ToUpper(ps.ByName("code"))
+	if !ledger.CurrencyCode.MatchString(code) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El código de la moneda debe poseer tres letras")
+		return
+	}
+	currency := types.Currency{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &currency)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data enviada no corresponde con una moneda")
+		return
+	}
+	if message := validateCurrency(&currency); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	current, err := ledger.LookupCurrency(db, code)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if current.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La moneda %v no está registrada", code)
+		return
+	}
+	if current.Precision != currency.Precision {
+		var entries int
+		err = db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM transactions_with_balances WHERE currency='%v';", code)).Scan(&entries)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		if entries > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "No se puede cambiar la precisión de la moneda %v porque ya posee transacciones", code)
+			return
+		}
+	}
+
+	_, err = db.Exec(fmt.Sprintf("UPDATE currencies SET name='%v', symbol='%v', precision='%v' WHERE code='%v';", currency.Name, currency.Symbol, currency.Precision, code))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	updatedCurrency, err := ledger.LookupCurrency(db, code)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(updatedCurrency)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// GetBalances returns the current balance of every currency across all the
+// accounts
+func GetBalances(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	db := database.ConnectDB()
+	defer db.Close()
+	balances, err := ledger.CurrentBalances(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(balances)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -0,0 +1,92 @@
+package currencies
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"testing"
+
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestGetCurrencies(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/currencies", GetCurrencies)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/currencies", nil)
+
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing that the seeded currencies are listed")
+	currencies := []types.Currency{}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	err = json.Unmarshal(body, &currencies)
+	if err != nil {
+		t.Fatal("Response body does not contain an array of type Currency")
+	}
+	codes := map[string]bool{}
+	for _, currency := range currencies {
+		codes[currency.Code] = true
+	}
+	for _, code := range []string{"USD", "VES", "EUR", "COP"} {
+		if !codes[code] {
+			t.Errorf("currency %v should be registered", code)
+		}
+	}
+}
+
+func TestCreateCurrencyWithBadCode(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/currencies", CreateCurrency)
+
+	bodyString := `
+		{
+			"Code": "EURO",
+			"Name": "Euro",
+			"Symbol": "€",
+			"Precision": 2
+		}
+	`
+	rr := testutils.MakeRequest(t, router, "POST", "/currencies", json.RawMessage(bodyString))
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "El código de la moneda debe poseer tres letras"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
+}
+
+func TestGetBalances(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/balances", GetBalances)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/balances", nil)
+
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+	balances := []types.CurrencyBalance{}
+	err := json.Unmarshal(rr.Body.Bytes(), &balances)
+	if err != nil {
+		t.Fatal("Response body does not contain an array of type CurrencyBalance")
+	}
+	for _, balance := range balances {
+		if balance.Balance.Sign() < 0 {
+			t.Errorf("currency %v has a negative balance %v", balance.Currency, balance.Balance)
+		}
+	}
+}
@@ -5,9 +5,12 @@ CREATE DATABASE gandola_soft;
 \c gandola_soft;
 
 CREATE TYPE transaction_type AS ENUM ('output', 'input');
-CREATE TYPE currency_type AS ENUM('USD', 'VES');
 CREATE TYPE urgency_type AS ENUM('low', 'medium', 'high', 'critical');
 CREATE TYPE actor_type AS ENUM('personnel', 'third', 'mine', 'contractee', 'driver');
+CREATE TYPE trip_status AS ENUM('planned', 'loading', 'in_transit', 'delivered', 'billed');
+CREATE TYPE pay_rule_type AS ENUM('per_trip', 'per_unit', 'bill_percentage');
+CREATE TYPE pending_status AS ENUM('draft', 'submitted', 'approved', 'rejected', 'executed');
+CREATE TYPE frequency_type AS ENUM('weekly', 'biweekly', 'monthly', 'yearly');
 CREATE EXTENSION CITEXT;
 -- tipos de actores:
 --   - El empleado: Luis D, papa, yo, Niliberto
@@ -22,25 +25,91 @@ CREATE TABLE actors (
   national_id TEXT,
   address TEXT,
   notes TEXT,
+  license_number TEXT,
+  license_expiry DATE,
+  phone TEXT,
+  special_taxpayer BOOLEAN NOT NULL DEFAULT FALSE,
   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
 INSERT INTO actors (type, name, national_id, address, notes) VALUES ('third', 'Externo', 'no id', 'no address', 'no notes');
 INSERT INTO actors (type, name, national_id, address, notes) VALUES ('contractee', 'Compañía cero', 'no id', 'no address', 'no notes');
-INSERT INTO actors (type, name, national_id, address, notes) VALUES ('driver', 'Conductor cero', 'no id', 'no address', 'no notes');
+INSERT INTO actors (type, name, national_id, address, notes, license_number) VALUES ('driver', 'Conductor cero', 'no id', 'no address', 'no notes', 'no license');
 
+-- monedas aceptadas, precision es la cantidad de decimales de sus montos
+CREATE TABLE currencies (
+  code TEXT PRIMARY KEY CHECK (code ~ '^[A-Z]{3}$'),
+  name TEXT NOT NULL,
+  symbol TEXT NOT NULL,
+  precision INT NOT NULL DEFAULT 2 CHECK (precision BETWEEN 0 AND 2),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO currencies (code, name, symbol, precision) VALUES ('USD', 'Dólar estadounidense', '$', 2);
+INSERT INTO currencies (code, name, symbol, precision) VALUES ('VES', 'Bolívar', 'Bs.', 2);
+INSERT INTO currencies (code, name, symbol, precision) VALUES ('EUR', 'Euro', '€', 2);
+INSERT INTO currencies (code, name, symbol, precision) VALUES ('COP', 'Peso colombiano', 'COL$', 0);
+
+-- configuracion de la empresa, la tabla tiene una sola fila. Los datos de la
+-- empresa encabezan las facturas y las tasas son porcentajes: el IVA sobre la
+-- base imponible, la retencion de IVA sobre el IVA y la retencion de ISLR
+-- sobre la base imponible. Las transacciones pendientes cuyo monto en USD
+-- supera approval_threshold necesitan dos aprobaciones
+CREATE TABLE settings (
+  id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+  company_name TEXT NOT NULL DEFAULT '',
+  company_national_id TEXT NOT NULL DEFAULT '',
+  company_address TEXT NOT NULL DEFAULT '',
+  company_phone TEXT NOT NULL DEFAULT '',
+  iva_rate DECIMAL(5,2) NOT NULL DEFAULT 16 CHECK (iva_rate BETWEEN 0 AND 100),
+  iva_withholding_rate DECIMAL(5,2) NOT NULL DEFAULT 75 CHECK (iva_withholding_rate BETWEEN 0 AND 100),
+  islr_withholding_rate DECIMAL(5,2) NOT NULL DEFAULT 3 CHECK (islr_withholding_rate BETWEEN 0 AND 100),
+  approval_threshold DECIMAL(17,2) NOT NULL DEFAULT 1000 CHECK (approval_threshold >= 0),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO settings DEFAULT VALUES;
+
+-- lo cobrado de una factura se obtiene de sus pagos en bills_with_balances,
+-- total es la base imponible mas el IVA y a los contribuyentes especiales se
+-- les cobra el total menos las retenciones
 CREATE TABLE bills (
   id SERIAL PRIMARY KEY,
   code TEXT NOT NULL,
   url TEXT NOT NULL,
   date DATE DEFAULT CURRENT_DATE,
   company INT REFERENCES actors(id) ON DELETE RESTRICT NOT NULL,
-  charged BOOLEAN NOT NULL DEFAULT FALSE,
+  subtotal DECIMAL(17,2) CHECK (subtotal >= 0) NOT NULL DEFAULT 0,
+  iva_rate DECIMAL(5,2) NOT NULL DEFAULT 0,
+  iva_withholding_rate DECIMAL(5,2) NOT NULL DEFAULT 0,
+  islr_withholding_rate DECIMAL(5,2) NOT NULL DEFAULT 0,
+  iva DECIMAL(17,2) NOT NULL DEFAULT 0,
+  iva_withholding DECIMAL(17,2) NOT NULL DEFAULT 0,
+  islr_withholding DECIMAL(17,2) NOT NULL DEFAULT 0,
+  total DECIMAL(17,2) CHECK (total >= 0) NOT NULL DEFAULT 0,
+  currency TEXT REFERENCES currencies(code) ON DELETE RESTRICT NOT NULL DEFAULT 'USD',
   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
 INSERT INTO bills (code, url, company) VALUES (1, 'url', 2);
 
+-- facturas recibidas de los terceros: frenos, cauchos, repuestos. Lo pagado
+-- sale de los egresos enlazados en payables_with_balances y lo programado de
+-- las transacciones pendientes que aun no se ejecutan
+CREATE TABLE payables (
+  id SERIAL PRIMARY KEY,
+  code TEXT NOT NULL,
+  supplier INT REFERENCES actors(id) ON DELETE RESTRICT NOT NULL,
+  description TEXT NOT NULL,
+  amount DECIMAL(17,2) CHECK (amount > 0) NOT NULL,
+  currency TEXT REFERENCES currencies(code) ON DELETE RESTRICT NOT NULL DEFAULT 'USD',
+  date DATE NOT NULL DEFAULT CURRENT_DATE,
+  due_date DATE NOT NULL,
+  url TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CHECK (due_date >= date)
+);
+
 CREATE TABLE trucks (
   id SERIAL PRIMARY KEY,
   name TEXT UNIQUE NOT NULL,
@@ -61,6 +130,33 @@ INSERT INTO trucks (name, data) VALUES ('segundo camion', 'bla bla \n bla bla bl
 
 INSERT INTO truck_photos (truck, url) VALUES ('1', 'url_1'), ('1', 'url_2');
 
+-- una regla de pago aplica a un conductor, a una ruta (origen y destino) o a ambos,
+-- al liquidar un viaje se usa la regla mas especifica
+CREATE TABLE pay_rules (
+  id SERIAL PRIMARY KEY,
+  driver INT REFERENCES actors(id) ON DELETE RESTRICT,
+  origin INT REFERENCES actors(id) ON DELETE RESTRICT,
+  destination INT REFERENCES actors(id) ON DELETE RESTRICT,
+  type pay_rule_type NOT NULL,
+  currency TEXT REFERENCES currencies(code) ON DELETE RESTRICT NOT NULL,
+  rate DECIMAL(17,2) CHECK (rate >= 0) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CHECK ((origin IS NULL) = (destination IS NULL)),
+  CHECK (driver IS NOT NULL OR origin IS NOT NULL)
+);
+
+CREATE TABLE settlements (
+  id SERIAL PRIMARY KEY,
+  driver INT REFERENCES actors(id) ON DELETE RESTRICT NOT NULL,
+  date_from DATE NOT NULL,
+  date_to DATE NOT NULL,
+  currency TEXT REFERENCES currencies(code) ON DELETE RESTRICT NOT NULL,
+  earned DECIMAL(17,2) NOT NULL,
+  advances DECIMAL(17,2) NOT NULL,
+  balance DECIMAL(17,2) CHECK (balance >= 0) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 CREATE TABLE trips (
   id SERIAL PRIMARY KEY,
   date DATE DEFAULT CURRENT_DATE,
@@ -73,41 +169,184 @@ CREATE TABLE trips (
   truck INT REFERENCES trucks(id) ON DELETE RESTRICT NOT NULL,
   bill INT REFERENCES bills(id) ON DELETE RESTRICT,
   voucher_url TEXT,
-  complete BOOLEAN NOT NULL DEFAULT FALSE,
+  status trip_status NOT NULL DEFAULT 'planned',
+  loading_at TIMESTAMP WITH TIME ZONE,
+  started_at TIMESTAMP WITH TIME ZONE,
+  delivered_at TIMESTAMP WITH TIME ZONE,
+  billed_at TIMESTAMP WITH TIME ZONE,
+  settlement INT REFERENCES settlements(id) ON DELETE RESTRICT,
   notes TEXT,
   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
 INSERT INTO trips (origin, destination, cargo, amount, unit, driver, truck, voucher_url, notes) VALUES (1, 1, 'piedra', 25, 'metros', 3, 1, 'no_image', 'notes');
 
+CREATE TABLE bill_items (
+  id SERIAL PRIMARY KEY,
+  bill INT REFERENCES bills(id) ON DELETE CASCADE NOT NULL,
+  description TEXT NOT NULL,
+  quantity DECIMAL(17,3) CHECK (quantity > 0) NOT NULL,
+  unit TEXT NOT NULL DEFAULT '',
+  unit_price DECIMAL(17,2) CHECK (unit_price >= 0) NOT NULL,
+  amount DECIMAL(17,2) NOT NULL,
+  trip INT REFERENCES trips(id) ON DELETE SET NULL
+);
+
+-- cada cuenta guarda dinero en una sola moneda: caja chica, bancos, zelle
+CREATE TABLE accounts (
+  id SERIAL PRIMARY KEY,
+  name CITEXT NOT NULL UNIQUE,
+  currency TEXT REFERENCES currencies(code) ON DELETE RESTRICT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO accounts (name, currency) VALUES ('Caja chica USD', 'USD');
+INSERT INTO accounts (name, currency) VALUES ('Caja chica VES', 'VES');
+
+-- tasas de cambio en unidades de la moneda por cada USD, rigen desde su fecha
+-- hasta la siguiente de la misma moneda
+CREATE TABLE exchange_rates (
+  id SERIAL PRIMARY KEY,
+  date DATE NOT NULL,
+  currency TEXT REFERENCES currencies(code) ON DELETE RESTRICT NOT NULL DEFAULT 'VES' CHECK (currency != 'USD'),
+  rate DECIMAL(22,6) CHECK (rate > 0) NOT NULL,
+  source TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (date, currency, source)
+);
+
+-- categorias de ingresos y egresos: combustible, peajes, reparaciones, sueldos,
+-- una categoria sin padre es de primer nivel
+CREATE TABLE categories (
+  id SERIAL PRIMARY KEY,
+  name CITEXT NOT NULL,
+  parent INT REFERENCES categories(id) ON DELETE RESTRICT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CHECK (parent != id)
+);
+
+CREATE UNIQUE INDEX categories_parent_name_key ON categories (COALESCE(parent, 0), name);
+
+-- una transferencia mueve dinero entre dos cuentas con dos asientos enlazados,
+-- si las monedas son distintas la tasa es la cantidad de la otra moneda por
+-- cada USD, o lo recibido por cada unidad enviada si ninguna es USD
+CREATE TABLE transfers (
+  id SERIAL PRIMARY KEY,
+  from_account INT REFERENCES accounts(id) ON DELETE RESTRICT NOT NULL,
+  to_account INT REFERENCES accounts(id) ON DELETE RESTRICT NOT NULL,
+  amount DECIMAL(17,2) CHECK (amount > 0) NOT NULL,
+  to_amount DECIMAL(17,2) CHECK (to_amount > 0) NOT NULL,
+  rate DECIMAL(22,6) CHECK (rate > 0) NOT NULL,
+  description TEXT NOT NULL,
+  actor INT REFERENCES actors(id) ON DELETE RESTRICT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CHECK (from_account != to_account)
+);
+
 CREATE TABLE transactions_with_balances (
   id SERIAL PRIMARY KEY,
   type transaction_type NOT NULL,
-  currency currency_type NOT NULL,
+  currency TEXT REFERENCES currencies(code) ON DELETE RESTRICT NOT NULL,
   amount DECIMAL(17,2) CHECK (amount >= 0) NOT NULL,
   description TEXT NOT NULL,
-  USD_balance DECIMAL(22,2) CHECK (USD_balance >= 0) NOT NULL,
-  VES_balance DECIMAL(22,2) CHECK (VES_balance >= 0) NOT NULL,
+  currency_balance DECIMAL(22,2) CHECK (currency_balance >= 0) NOT NULL,
+  account INT REFERENCES accounts(id) ON DELETE RESTRICT NOT NULL,
+  balance DECIMAL(22,2) CHECK (balance >= 0) NOT NULL,
   actor INT REFERENCES actors(id) ON DELETE RESTRICT NOT NULL,
+  settlement INT REFERENCES settlements(id) ON DELETE RESTRICT,
+  reverses INT REFERENCES transactions_with_balances(id) ON DELETE RESTRICT UNIQUE,
+  reversed BOOLEAN NOT NULL DEFAULT FALSE,
+  transfer INT REFERENCES transfers(id) ON DELETE RESTRICT,
+  category INT REFERENCES categories(id) ON DELETE RESTRICT,
+  bill INT REFERENCES bills(id) ON DELETE RESTRICT,
+  payable INT REFERENCES payables(id) ON DELETE RESTRICT,
   executed TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
-INSERT INTO transactions_with_balances (type, currency, amount, description, USD_balance, VES_balance, actor)
-  VALUES ('input', 'USD', '0', 'transaction zero', '0', '0', '1');
+-- el balance de una moneda es el currency_balance de su ultimo asiento
+CREATE INDEX transactions_with_balances_currency_idx ON transactions_with_balances (currency, id);
+
+INSERT INTO transactions_with_balances (type, currency, amount, description, currency_balance, account, balance, actor)
+  VALUES ('input', 'USD', '0', 'transaction zero', '0', '1', '0', '1');
+
+-- los pagos de una factura son los ingresos enlazados a ella que no fueron
+-- revertidos, net es lo que se cobra despues de las retenciones y una factura
+-- esta cobrada cuando no queda saldo pendiente
+CREATE VIEW bills_with_balances AS
+  SELECT bills.*, bills.total - bills.iva_withholding - bills.islr_withholding AS net, COALESCE(payments.paid, 0) AS paid,
+    bills.total - bills.iva_withholding - bills.islr_withholding - COALESCE(payments.paid, 0) AS outstanding,
+    (bills.total > 0 AND COALESCE(payments.paid, 0) >= bills.total - bills.iva_withholding - bills.islr_withholding) AS charged
+  FROM bills LEFT JOIN (
+    SELECT bill, SUM(amount) AS paid FROM transactions_with_balances WHERE bill IS NOT NULL AND reversed = FALSE GROUP BY bill
+  ) AS payments ON payments.bill = bills.id;
+
+-- plantillas de transacciones que se repiten: sueldos, alquiler, seguros. El
+-- servidor crea una transaccion pendiente por cada fecha desde start_date
+-- hasta end_date, last_date es la ultima fecha ya creada
+CREATE TABLE recurring_transactions (
+  id SERIAL PRIMARY KEY,
+  type transaction_type NOT NULL,
+  currency TEXT REFERENCES currencies(code) ON DELETE RESTRICT NOT NULL,
+  amount DECIMAL(17,2) CHECK (amount > 0) NOT NULL,
+  description TEXT NOT NULL,
+  account INT REFERENCES accounts(id) ON DELETE RESTRICT NOT NULL,
+  actor INT REFERENCES actors(id) ON DELETE RESTRICT NOT NULL,
+  category INT REFERENCES categories(id) ON DELETE RESTRICT,
+  frequency frequency_type NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE,
+  last_date DATE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CHECK (end_date >= start_date)
+);
 
 CREATE TABLE pending_transactions (
   id SERIAL PRIMARY KEY,
   type transaction_type NOT NULL,
-  currency currency_type NOT NULL,
+  currency TEXT REFERENCES currencies(code) ON DELETE RESTRICT NOT NULL,
   amount DECIMAL(17,2) CHECK (amount >= 0) NOT NULL,
   description TEXT NOT NULL,
+  account INT REFERENCES accounts(id) ON DELETE RESTRICT NOT NULL,
   actor INT REFERENCES actors(id) ON DELETE RESTRICT NOT NULL,
-  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+  settlement INT REFERENCES settlements(id) ON DELETE RESTRICT,
+  category INT REFERENCES categories(id) ON DELETE RESTRICT,
+  payable INT REFERENCES payables(id) ON DELETE RESTRICT,
+  due_date DATE,
+  status pending_status NOT NULL DEFAULT 'draft',
+  recurring INT REFERENCES recurring_transactions(id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (recurring, due_date)
+);
+
+INSERT INTO pending_transactions (type, currency, amount, description, account, actor) 
+  VALUES ('input', 'USD', '0', 'pending transaction zero', '1', '1');
+
+-- historial de una transaccion pendiente: quien la envio, aprobo, rechazo o
+-- ejecuto y cuando. Al ejecutarse el historial pasa al asiento del libro
+CREATE TABLE pending_transaction_steps (
+  id SERIAL PRIMARY KEY,
+  pending_transaction INT REFERENCES pending_transactions(id) ON DELETE CASCADE,
+  transaction INT REFERENCES transactions_with_balances(id) ON DELETE CASCADE,
+  status pending_status NOT NULL,
+  actor INT REFERENCES actors(id) ON DELETE RESTRICT,
+  notes TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CHECK (pending_transaction IS NOT NULL OR transaction IS NOT NULL)
 );
 
-INSERT INTO pending_transactions (type, currency, amount, description, actor) 
-  VALUES ('input', 'USD', '0', 'pending transaction zero', '1');
+-- los pagos de una cuenta por pagar son los egresos enlazados a ella que no
+-- fueron revertidos y lo programado son sus transacciones pendientes que no
+-- fueron rechazadas, lo pagado mas lo programado nunca excede el monto
+CREATE VIEW payables_with_balances AS
+  SELECT payables.*, COALESCE(payments.paid, 0) AS paid, COALESCE(scheduled_payments.scheduled, 0) AS scheduled,
+    payables.amount - COALESCE(payments.paid, 0) AS outstanding,
+    (COALESCE(payments.paid, 0) >= payables.amount) AS paid_off
+  FROM payables LEFT JOIN (
+    SELECT payable, SUM(amount) AS paid FROM transactions_with_balances WHERE payable IS NOT NULL AND reversed = FALSE GROUP BY payable
+  ) AS payments ON payments.payable = payables.id LEFT JOIN (
+    SELECT payable, SUM(amount) AS scheduled FROM pending_transactions WHERE payable IS NOT NULL AND status <> 'rejected' GROUP BY payable
+  ) AS scheduled_payments ON scheduled_payments.payable = payables.id;
 
 CREATE TABLE notes (
   id SERIAL PRIMARY KEY,
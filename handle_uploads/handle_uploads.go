@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"example.com/backend_gandola_soft/database"
 	"example.com/backend_gandola_soft/types"
 	"example.com/backend_gandola_soft/utils"
 	"github.com/julienschmidt/httprouter"
@@ -133,3 +136,152 @@ func UploadTrucksPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(response)
 }
+
+func UploadTripVoucher(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id del viaje debe ser mayor a cero")
+		return
+	}
+
+	fileName, ok := replaceImage(w, r, "trips", "voucher_url", "public/trips", fmt.Sprintf("guia_%v", id), id)
+	if !ok {
+		return
+	}
+	if fileName == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El viaje con el id %v no existe", id)
+		return
+	}
+
+	fmt.Fprint(w, fileName)
+}
+
+func UploadPayable(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id de la cuenta por pagar debe ser mayor a cero")
+		return
+	}
+
+	fileName, ok := replaceImage(w, r, "payables", "url", "public/payables", fmt.Sprintf("proveedor_%v", id), id)
+	if !ok {
+		return
+	}
+	if fileName == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta por pagar con el id %v no existe", id)
+		return
+	}
+
+	fmt.Fprint(w, fileName)
+}
+
+// replaceImage saves the image of the request in directory and points the
+// column of the row with the given id to it. The image is written under a
+// unique name so the previous one stays untouched until the row points to the
+// new file, only then it is removed. The file name is empty when the row does
+// not exist, ok is false when a response was already sent
+func replaceImage(w http.ResponseWriter, r *http.Request, table string, column string, directory string, prefix string, id int) (string, bool) {
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return "", false
+	}
+	defer file.Close()
+
+	validImage := false
+	extension := strings.ToLower(filepath.Ext(header.Filename))
+	for _, v := range types.ImageTypes {
+		if extension == v {
+			validImage = true
+			break
+		}
+	}
+	if !validImage {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El archivo del tipo %v no es una imagen reconocida", extension)
+		return "", false
+	}
+
+	err = os.MkdirAll(directory, 0755)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return "", false
+	}
+
+	date := time.Now()
+	year, month, day := date.Local().Date()
+	name := fmt.Sprintf("%v_*_%v-%v-%v%v", prefix, month, day, year, extension)
+
+	tempFile, err := ioutil.TempFile(directory, name)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return "", false
+	}
+	defer tempFile.Close()
+	fileName := tempFile.Name()
+
+	_, err = io.Copy(tempFile, file)
+	if err != nil {
+		os.Remove(fileName)
+		utils.SendInternalServerError(err, w)
+		return "", false
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	var updatedId int
+	var oldFile string
+	updateQuery := fmt.Sprintf("UPDATE %[1]v SET %[2]v='%[3]v' FROM (SELECT id, COALESCE(%[2]v, '') AS %[2]v FROM %[1]v WHERE id='%[4]v' FOR UPDATE) AS old WHERE %[1]v.id = old.id RETURNING %[1]v.id, old.%[2]v;", table, column, fileName, id)
+	rows, err := db.Query(updateQuery)
+	if err != nil {
+		os.Remove(fileName)
+		utils.SendInternalServerError(err, w)
+		return "", false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&updatedId, &oldFile); err != nil {
+			os.Remove(fileName)
+			utils.SendInternalServerError(err, w)
+			return "", false
+		}
+	}
+
+	if updatedId == 0 {
+		os.Remove(fileName)
+		return "", true
+	}
+
+	if oldFile != fileName {
+		RemoveUpload(oldFile, directory)
+	}
+
+	return fileName, true
+}
+
+// RemoveUpload deletes a file saved in directory by the upload handlers, any
+// other value such as a placeholder is left alone
+func RemoveUpload(fileName string, directory string) {
+	if !strings.HasPrefix(fileName, directory+"/") {
+		return
+	}
+	err := os.Remove(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
+}
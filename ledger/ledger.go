@@ -0,0 +1,325 @@
+package ledger
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/types"
+)
+
+// SelectTransactionsQuery lists the ledger entries with their actor, callers
+// append their own WHERE and ORDER BY clauses and read rows with ScanTransaction
+const SelectTransactionsQuery = "SELECT transactions_with_balances.id, transactions_with_balances.type, transactions_with_balances.currency, transactions_with_balances.amount, transactions_with_balances.description, transactions_with_balances.currency_balance, accounts.id, accounts.name, transactions_with_balances.balance, COALESCE(transactions_with_balances.reverses, 0), transactions_with_balances.reversed, COALESCE(transactions_with_balances.transfer, 0), transactions_with_balances.executed, transactions_with_balances.created_at, actors.id, actors.name, COALESCE(categories.id, 0), COALESCE(categories.name, '') FROM transactions_with_balances INNER JOIN actors ON transactions_with_balances.actor = actors.id INNER JOIN accounts ON transactions_with_balances.account = accounts.id LEFT JOIN categories ON transactions_with_balances.category = categories.id"
+
+// SelectPendingTransactionsQuery is the SelectTransactionsQuery counterpart
+// for pending transactions, rows are read with ScanPendingTransaction
+const SelectPendingTransactionsQuery = "SELECT pending_transactions.id, pending_transactions.type, pending_transactions.currency, pending_transactions.amount, pending_transactions.description, pending_transactions.created_at, accounts.id, accounts.name, actors.id, actors.name, COALESCE(categories.id, 0), COALESCE(categories.name, ''), COALESCE(pending_transactions.payable, 0), COALESCE(TO_CHAR(pending_transactions.due_date, 'YYYY-MM-DD'), ''), pending_transactions.status FROM pending_transactions INNER JOIN actors ON pending_transactions.actor = actors.id INNER JOIN accounts ON pending_transactions.account = accounts.id LEFT JOIN categories ON pending_transactions.category = categories.id"
+
+// SelectStepsQuery lists the approval history of pending transactions and of
+// the ledger entries they became, rows are read with ScanStep
+const SelectStepsQuery = "SELECT pending_transaction_steps.id, COALESCE(pending_transaction_steps.pending_transaction, 0), COALESCE(pending_transaction_steps.transaction, 0), pending_transaction_steps.status, COALESCE(actors.id, 0), COALESCE(actors.name, ''), pending_transaction_steps.notes, pending_transaction_steps.created_at FROM pending_transaction_steps LEFT JOIN actors ON pending_transaction_steps.actor = actors.id"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// SelectTransfersQuery lists the transfers with both accounts and the actor,
+// rows are read with ScanTransfer
+const SelectTransfersQuery = "SELECT transfers.id, from_accounts.id, from_accounts.name, from_accounts.currency, to_accounts.id, to_accounts.name, to_accounts.currency, transfers.amount, transfers.to_amount, transfers.rate, transfers.description, actors.id, actors.name, transfers.created_at FROM transfers INNER JOIN accounts AS from_accounts ON transfers.from_account = from_accounts.id INNER JOIN accounts AS to_accounts ON transfers.to_account = to_accounts.id INNER JOIN actors ON transfers.actor = actors.id"
+
+func ScanTransaction(row scanner) (types.TransactionWithBalance, error) {
+	transaction := types.TransactionWithBalance{}
+	var transferId int
+	err := row.Scan(&transaction.Id, &transaction.Type, &transaction.Currency, &transaction.Amount, &transaction.Description, &transaction.CurrencyBalance, &transaction.Account.Id, &transaction.Account.Name, &transaction.Balance, &transaction.Reverses, &transaction.Reversed, &transferId, &transaction.Executed, &transaction.CreatedAt, &transaction.Actor.Id, &transaction.Actor.Name, &transaction.Category.Id, &transaction.Category.Name)
+	if transferId != 0 {
+		transaction.Transfer = &types.Transfer{Id: transferId}
+	}
+	return transaction, err
+}
+
+func ScanTransfer(row scanner) (types.Transfer, error) {
+	transfer := types.Transfer{}
+	err := row.Scan(&transfer.Id, &transfer.From.Id, &transfer.From.Name, &transfer.From.Currency, &transfer.To.Id, &transfer.To.Name, &transfer.To.Currency, &transfer.Amount, &transfer.ToAmount, &transfer.Rate, &transfer.Description, &transfer.Actor.Id, &transfer.Actor.Name, &transfer.CreatedAt)
+	return transfer, err
+}
+
+func ScanPendingTransaction(row scanner) (types.PendingTransaction, error) {
+	transaction := types.PendingTransaction{}
+	err := row.Scan(&transaction.Id, &transaction.Type, &transaction.Currency, &transaction.Amount, &transaction.Description, &transaction.CreatedAt, &transaction.Account.Id, &transaction.Account.Name, &transaction.Actor.Id, &transaction.Actor.Name, &transaction.Category.Id, &transaction.Category.Name, &transaction.Payable, &transaction.DueDate, &transaction.Status)
+	return transaction, err
+}
+
+// ScanStep also returns the id of the pending transaction the step belongs
+// to, which is zero once it was executed
+func ScanStep(row scanner) (types.PendingStep, int, error) {
+	step := types.PendingStep{}
+	var pendingId int
+	err := row.Scan(&step.Id, &pendingId, &step.Transaction, &step.Status, &step.Actor.Id, &step.Actor.Name, &step.Notes, &step.CreatedAt)
+	return step, pendingId, err
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// CollapseTransfers folds both entries of every transfer into the later one,
+// which holds the balances after the whole operation, so each transfer is
+// listed once with type "transfer" and its details
+func CollapseTransfers(q querier, transactions []types.TransactionWithBalance) ([]types.TransactionWithBalance, error) {
+	lastEntries := map[int]int{}
+	transferIds := []string{}
+	for _, transaction := range transactions {
+		if transaction.Transfer == nil {
+			continue
+		}
+		lastEntry, seen := lastEntries[transaction.Transfer.Id]
+		if !seen {
+			transferIds = append(transferIds, fmt.Sprintf("'%v'", transaction.Transfer.Id))
+		}
+		if transaction.Id > lastEntry {
+			lastEntries[transaction.Transfer.Id] = transaction.Id
+		}
+	}
+	if len(transferIds) == 0 {
+		return transactions, nil
+	}
+
+	transfers := map[int]types.Transfer{}
+	rows, err := q.Query(fmt.Sprintf("%v WHERE transfers.id IN (%v);", SelectTransfersQuery, strings.Join(transferIds, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		transfer, err := ScanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers[transfer.Id] = transfer
+	}
+
+	collapsed := []types.TransactionWithBalance{}
+	for _, transaction := range transactions {
+		if transaction.Transfer != nil {
+			if lastEntries[transaction.Transfer.Id] != transaction.Id {
+				continue
+			}
+			transfer := transfers[transaction.Transfer.Id]
+			transaction.Type = "transfer"
+			transaction.Transfer = &transfer
+		}
+		collapsed = append(collapsed, transaction)
+	}
+	return collapsed, nil
+}
+
+// AttachSteps loads the history of every pending transaction, so the Steps
+// are filled wherever pending transactions are returned
+func AttachSteps(q querier, transactions []types.PendingTransaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	ids := []string{}
+	positions := map[int]int{}
+	for i := range transactions {
+		transactions[i].Steps = []types.PendingStep{}
+		ids = append(ids, fmt.Sprintf("'%v'", transactions[i].Id))
+		positions[transactions[i].Id] = i
+	}
+	rows, err := q.Query(fmt.Sprintf("%v WHERE pending_transaction_steps.pending_transaction IN (%v) ORDER BY pending_transaction_steps.id;", SelectStepsQuery, strings.Join(ids, ", ")))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		step, pendingId, err := ScanStep(rows)
+		if err != nil {
+			return err
+		}
+		transaction := &transactions[positions[pendingId]]
+		transaction.Steps = append(transaction.Steps, step)
+	}
+	return rows.Err()
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// CurrencyCode is the format of the currency codes, codes that do not match it
+// are never registered
+var CurrencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// LookupCurrency returns the currency with the given code, the Code of the
+// returned currency is empty when it is not registered
+func LookupCurrency(q rowQuerier, code string) (types.Currency, error) {
+	currency := types.Currency{}
+	if !CurrencyCode.MatchString(code) {
+		return currency, nil
+	}
+	err := q.QueryRow(fmt.Sprintf("SELECT code, name, symbol, precision, created_at FROM currencies WHERE code='%v';", code)).Scan(&currency.Code, &currency.Name, &currency.Symbol, &currency.Precision, &currency.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return types.Currency{}, err
+	}
+	return currency, nil
+}
+
+// CheckCurrency validates that the currency is registered and that the amount
+// does not have more decimals than it allows, it returns a message for the
+// client when they are not valid
+func CheckCurrency(q rowQuerier, code string, amount money.Money) (string, error) {
+	currency, err := LookupCurrency(q, code)
+	if err != nil {
+		return "", err
+	}
+	if currency.Code == "" {
+		return fmt.Sprintf("La moneda %v no está registrada", code), nil
+	}
+	if !amount.Fits(currency.Precision) {
+		return fmt.Sprintf("El monto excede los %v decimales de la moneda %v", currency.Precision, currency.Code), nil
+	}
+	return "", nil
+}
+
+// AccountCurrency returns the currency of the account or an empty string
+// when the account does not exist
+func AccountCurrency(q rowQuerier, accountId int) (string, error) {
+	var currency string
+	err := q.QueryRow(fmt.Sprintf("SELECT currency FROM accounts WHERE id='%v';", accountId)).Scan(&currency)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return currency, nil
+}
+
+// CheckCategory validates the optional category of a transaction, it returns
+// a message for the client when the category does not exist
+func CheckCategory(q rowQuerier, categoryId int) (string, error) {
+	if categoryId == 0 {
+		return "", nil
+	}
+	if categoryId < 0 {
+		return "La categoría especificada no existe", nil
+	}
+	var id int
+	err := q.QueryRow(fmt.Sprintf("SELECT id FROM categories WHERE id='%v';", categoryId)).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if id == 0 {
+		return "La categoría especificada no existe", nil
+	}
+	return "", nil
+}
+
+// Nullable is the SQL value of an optional id or text, NULL when it is zero or
+// empty
+func Nullable(value interface{}) string {
+	if value == 0 || value == "" {
+		return "NULL"
+	}
+	return fmt.Sprintf("'%v'", value)
+}
+
+// Begin opens a DB transaction that holds the ledger lock. Every operation
+// that reads the last balance and writes a new one, or rewinds the ledger,
+// must run inside it so two requests can never compute their balances from
+// the same last row. Reads are not blocked by the lock.
+func Begin(db *sql.DB) (*sql.Tx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("LOCK TABLE transactions_with_balances IN EXCLUSIVE MODE;")
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	_, err = tx.Exec("SAVEPOINT ledger;")
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Discard undoes everything tx did since Begin while keeping the ledger
+// lock, and gives back the ids taken by the entries it inserted. Sequences
+// are not rolled back with the transaction, so a failed or dry run insert
+// would otherwise leave a gap in the ledger ids. It also works after a
+// statement failed and aborted tx.
+func Discard(tx *sql.Tx) error {
+	_, err := tx.Exec("ROLLBACK TO SAVEPOINT ledger;")
+	if err != nil {
+		return err
+	}
+	return rewindSequence(tx)
+}
+
+// LastCurrencyBalance returns the running balance of the currency across
+// every account after its last ledger entry
+func LastCurrencyBalance(tx *sql.Tx, currency string) (money.Money, error) {
+	var balance money.Money
+	err := tx.QueryRow(fmt.Sprintf("SELECT currency_balance FROM transactions_with_balances WHERE currency='%v' ORDER BY id DESC LIMIT 1;", currency)).Scan(&balance)
+	if err != nil && err != sql.ErrNoRows {
+		return balance, err
+	}
+	return balance, nil
+}
+
+// CurrentBalances returns the balance of every currency after the last
+// ledger entry
+func CurrentBalances(q querier) ([]types.CurrencyBalance, error) {
+	return balancesWhere(q, "")
+}
+
+// BalancesAt returns the balance of every currency right after the ledger
+// entry with the given id, a zero id gives the opening balances
+func BalancesAt(q querier, transactionId int) ([]types.CurrencyBalance, error) {
+	return balancesWhere(q, fmt.Sprintf(" AND transactions_with_balances.id <= '%v'", transactionId))
+}
+
+func balancesWhere(q querier, condition string) ([]types.CurrencyBalance, error) {
+	balances := []types.CurrencyBalance{}
+	rows, err := q.Query(fmt.Sprintf("SELECT currencies.code, currencies.symbol, COALESCE((SELECT currency_balance FROM transactions_with_balances WHERE transactions_with_balances.currency = currencies.code%v ORDER BY transactions_with_balances.id DESC LIMIT 1), 0) FROM currencies ORDER BY currencies.code;", condition))
+	if err != nil {
+		return balances, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		balance := types.CurrencyBalance{}
+		if err := rows.Scan(&balance.Currency, &balance.Symbol, &balance.Balance); err != nil {
+			return balances, err
+		}
+		balances = append(balances, balance)
+	}
+	return balances, nil
+}
+
+// LastAccountBalance returns the running balance of the account after its
+// last ledger entry, accounts without entries have a zero balance
+func LastAccountBalance(tx *sql.Tx, accountId int) (money.Money, error) {
+	var balance money.Money
+	err := tx.QueryRow(fmt.Sprintf("SELECT balance FROM transactions_with_balances WHERE account='%v' ORDER BY id DESC LIMIT 1;", accountId)).Scan(&balance)
+	if err != nil && err != sql.ErrNoRows {
+		return balance, err
+	}
+	return balance, nil
+}
+
+// rewindSequence makes the next ledger id follow the last remaining entry
+func rewindSequence(tx *sql.Tx) error {
+	_, err := tx.Exec("SELECT setval('transactions_with_balances_id_seq', (SELECT MAX(id) FROM transactions_with_balances));")
+	return err
+}
+
+// Apply returns the balance after a transaction of the given type and amount
+func Apply(balance money.Money, transactionType string, amount money.Money) money.Money {
+	if transactionType == "output" {
+		return balance.Sub(amount)
+	}
+	return balance.Add(amount)
+}
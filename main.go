@@ -3,13 +3,25 @@ package main
 import (
 	"log"
 	"net/http"
+	"time"
 
+	"example.com/backend_gandola_soft/accounts"
 	"example.com/backend_gandola_soft/actors"
 	"example.com/backend_gandola_soft/bills"
+	"example.com/backend_gandola_soft/categories"
+	"example.com/backend_gandola_soft/currencies"
 	"example.com/backend_gandola_soft/handle_uploads"
 	"example.com/backend_gandola_soft/notes"
+	"example.com/backend_gandola_soft/payables"
 	"example.com/backend_gandola_soft/pending_transactions"
+	"example.com/backend_gandola_soft/rates"
+	"example.com/backend_gandola_soft/recurring"
+	"example.com/backend_gandola_soft/settings"
+	"example.com/backend_gandola_soft/settlements"
+	"example.com/backend_gandola_soft/statements"
 	"example.com/backend_gandola_soft/transactions"
+	"example.com/backend_gandola_soft/transfers"
+	"example.com/backend_gandola_soft/trips"
 	"example.com/backend_gandola_soft/trucks"
 
 	"github.com/julienschmidt/httprouter"
@@ -31,20 +43,62 @@ func main() {
 	router.GET("/transactions", CustomOptions(transactions.GetTransactions))
 	router.POST("/transactions", CustomOptions(transactions.CreateTransaction))
 	router.PATCH("/transactions/:id", CustomOptions(transactions.PatchTransaction))
-	router.DELETE("/transactions", CustomOptions(transactions.DeleteLastTransaction))
-	router.PUT("/transactions", CustomOptions(transactions.UnexecuteLastTransaction))
+	router.GET("/transactions/:id/steps", CustomOptions(transactions.GetTransactionSteps))
+	router.POST("/transactions/:id/reverse", CustomOptions(transactions.ReverseTransaction))
+
+	router.GET("/transfers", CustomOptions(transfers.GetTransfers))
+	router.POST("/transfers", CustomOptions(transfers.CreateTransfer))
 
 	router.GET("/pending_transactions", CustomOptions(pending_transactions.GetPendingTransactions))
+	router.GET("/pending_transactions/calendar", CustomOptions(pending_transactions.GetCalendar))
+	router.GET("/pending_transactions/projection", CustomOptions(pending_transactions.GetProjection))
 	router.POST("/pending_transactions", CustomOptions(pending_transactions.CreatePendingTransaction))
 	router.PATCH("/pending_transactions/:id", CustomOptions(pending_transactions.PatchPendingTransaction))
 	router.DELETE("/pending_transactions/:id", CustomOptions(pending_transactions.DeletePendingTransaction))
+	// also serves PUT /pending_transactions/execute for batches
 	router.PUT("/pending_transactions/:id", CustomOptions(pending_transactions.ExecutePendingTransaction))
+	router.PUT("/pending_transactions/:id/submit", CustomOptions(pending_transactions.SubmitPendingTransaction))
+	router.PUT("/pending_transactions/:id/approve", CustomOptions(pending_transactions.ApprovePendingTransaction))
+	router.PUT("/pending_transactions/:id/reject", CustomOptions(pending_transactions.RejectPendingTransaction))
+
+	router.GET("/recurring_transactions", CustomOptions(recurring.GetRecurringTransactions))
+	router.POST("/recurring_transactions", CustomOptions(recurring.CreateRecurringTransaction))
+	router.PATCH("/recurring_transactions/:id", CustomOptions(recurring.PatchRecurringTransaction))
+	router.DELETE("/recurring_transactions/:id", CustomOptions(recurring.DeleteRecurringTransaction))
+	router.POST("/recurring_transactions/materialize", CustomOptions(recurring.MaterializeRecurringTransactions))
+
+	router.GET("/categories", CustomOptions(categories.GetCategories))
+	router.POST("/categories", CustomOptions(categories.CreateCategory))
+	router.PATCH("/categories/:id", CustomOptions(categories.PatchCategory))
+	router.DELETE("/categories/:id", CustomOptions(categories.DeleteCategory))
+	router.GET("/reports/categories", CustomOptions(categories.GetCategoryTotals))
+	router.GET("/reports/aging", CustomOptions(bills.GetAging))
+
+	router.GET("/currencies", CustomOptions(currencies.GetCurrencies))
+	router.POST("/currencies", CustomOptions(currencies.CreateCurrency))
+	router.PATCH("/currencies/:code", CustomOptions(currencies.PatchCurrency))
+	router.GET("/balances", CustomOptions(currencies.GetBalances))
+
+	router.GET("/rates", CustomOptions(rates.GetRates))
+	router.POST("/rates", CustomOptions(rates.CreateRate))
+	router.POST("/rates/import", CustomOptions(rates.ImportRates))
+	router.DELETE("/rates/:id", CustomOptions(rates.DeleteRate))
+
+	router.GET("/settings", CustomOptions(settings.GetSettings))
+	router.PATCH("/settings", CustomOptions(settings.PatchSettings))
+
+	router.GET("/accounts", CustomOptions(accounts.GetAccounts))
+	router.POST("/accounts", CustomOptions(accounts.CreateAccount))
+	router.PATCH("/accounts/:id", CustomOptions(accounts.PatchAccount))
+	router.DELETE("/accounts/:id", CustomOptions(accounts.DeleteAccount))
 
 	router.GET("/actors", CustomOptions(actors.GetActors))
 	router.GET("/companies", CustomOptions(actors.GetCompanies))
+	router.GET("/drivers", CustomOptions(actors.GetDrivers))
 	router.POST("/actors", CustomOptions(actors.CreateActor))
 	router.PATCH("/actors/:id", CustomOptions(actors.PatchActor))
 	router.DELETE("/actors/:id", CustomOptions(actors.DeleteActor))
+	router.GET("/actors/:id/statement", CustomOptions(statements.GetStatement))
 
 	router.GET("/notes", CustomOptions(notes.GetNotes))
 	router.POST("/notes", CustomOptions(notes.CreateNote))
@@ -54,23 +108,53 @@ func main() {
 	router.PUT("/unattend_note/:id", CustomOptions(notes.UnattendNote))
 
 	router.GET("/bills", CustomOptions(bills.GetBills))
+	router.GET("/bills/:id", CustomOptions(bills.GetBill))
+	router.GET("/bills/:id/pdf", CustomOptions(bills.GetBillPDF))
 	router.POST("/bills", CustomOptions(bills.CreateBill))
 	router.PATCH("/bills/:id", CustomOptions(bills.PatchBill))
 	router.DELETE("/bills/:id", CustomOptions(bills.DeleteBill))//TODO: delete actual image when deleting bill
+	router.PUT("/bills/:id/trips/:trip_id", CustomOptions(bills.AttachTrip))
+	router.DELETE("/bills/:id/trips/:trip_id", CustomOptions(bills.DetachTrip))
+	router.PUT("/bills/:id/payments/:transaction_id", CustomOptions(bills.AttachPayment))
+	router.DELETE("/bills/:id/payments/:transaction_id", CustomOptions(bills.DetachPayment))
+
+	router.GET("/payables", CustomOptions(payables.GetPayables))
+	router.GET("/payables/:id", CustomOptions(payables.GetPayable))
+	router.POST("/payables", CustomOptions(payables.CreatePayable))
+	router.PATCH("/payables/:id", CustomOptions(payables.PatchPayable))
+	router.DELETE("/payables/:id", CustomOptions(payables.DeletePayable))
+	router.POST("/payables/:id/schedule", CustomOptions(payables.SchedulePayment))
 
 	router.GET("/trucks", CustomOptions(trucks.GetTrucks))
 	router.POST("/trucks", CustomOptions(trucks.CreateTruck))
 	router.PATCH("/trucks/:id", CustomOptions(trucks.PatchTruck))
 	router.DELETE("/trucks/:id", CustomOptions(trucks.DeleteTruck))
 
+	router.GET("/trips", CustomOptions(trips.GetTrips))
+	router.POST("/trips", CustomOptions(trips.CreateTrip))
+	router.PATCH("/trips/:id", CustomOptions(trips.PatchTrip))
+	router.DELETE("/trips/:id", CustomOptions(trips.DeleteTrip))
+	router.PUT("/trips/:id/load", CustomOptions(trips.LoadTrip))
+	router.PUT("/trips/:id/start", CustomOptions(trips.StartTrip))
+	router.PUT("/trips/:id/deliver", CustomOptions(trips.DeliverTrip))
+
+	router.GET("/pay_rules", CustomOptions(settlements.GetPayRules))
+	router.POST("/pay_rules", CustomOptions(settlements.CreatePayRule))
+	router.PATCH("/pay_rules/:id", CustomOptions(settlements.PatchPayRule))
+	router.DELETE("/pay_rules/:id", CustomOptions(settlements.DeletePayRule))
+	router.GET("/drivers/:id/settlement", CustomOptions(settlements.GetSettlement))
+	router.POST("/drivers/:id/settlement", CustomOptions(settlements.ConfirmSettlement))
+
 	router.ServeFiles("/public/*filepath", http.Dir("./public"))
 	router.POST("/uploadbill/:id", CustomOptions(handle_uploads.UploadBill))
 	router.POST("/uploadTrucks/:id", CustomOptions(handle_uploads.UploadTrucksPhotos))
+	router.POST("/uploadTripVoucher/:id", CustomOptions(handle_uploads.UploadTripVoucher))
+	router.POST("/uploadPayable/:id", CustomOptions(handle_uploads.UploadPayable))
+
+	recurring.StartScheduler(time.Hour)
 
 	log.Fatal(http.ListenAndServe(":8080", router))
 }
 
-//TODO: check concurrent last delete on transaction
 //TOCONSIDER: maybe I should write tests on demand :D, it takes a hell of time!!!
-//TODO: check sql injection protection
-//TODO: bills pictures associated with trips, a table for bills, a table for trips, and a table to relationate both of them
\ No newline at end of file
+//TODO: check sql injection protection
\ No newline at end of file
@@ -0,0 +1,448 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+var hundred = big.NewInt(100)
+
+// amounts and rates are only accepted as plain decimals, big.Rat alone would
+// also read forms like "0x10", "1_000", "1e3" or "1/3"
+var (
+	amountPattern   = regexp.MustCompile(`^-?\d+(\.\d{1,2})?$`)
+	ratePattern     = regexp.MustCompile(`^-?\d+(\.\d{1,6})?$`)
+	quantityPattern = regexp.MustCompile(`^-?\d+(\.\d{1,3})?$`)
+	decimalPattern  = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+)
+
+// Money is an exact amount with two decimals, it is stored as a number of
+// cents so sums and subtractions never lose precision. The zero value is 0.00
+// and every operation returns a new value, so it can be copied freely
+type Money struct {
+	cents *big.Int
+}
+
+func FromCents(cents int64) Money {
+	return Money{cents: big.NewInt(cents)}
+}
+
+func FromInt(units int64) Money {
+	return Money{cents: new(big.Int).Mul(big.NewInt(units), hundred)}
+}
+
+// Parse reads a decimal amount like "1500", "1500.5" or "1500.50", amounts
+// with more than two decimals are rejected instead of being rounded
+func Parse(s string) (Money, error) {
+	text := strings.TrimSpace(s)
+	if !amountPattern.MatchString(text) {
+		if decimalPattern.MatchString(text) {
+			return Money{}, fmt.Errorf("money: %q tiene más de dos decimales", s)
+		}
+		return Money{}, fmt.Errorf("money: %q no es un monto válido", s)
+	}
+	return parseCents(text)
+}
+
+// parseCents reads a plain decimal with any number of decimals as long as it
+// is an exact number of cents, the DB can return "12.500" for a computed value
+func parseCents(text string) (Money, error) {
+	amount, ok := new(big.Rat).SetString(text)
+	if !ok || !decimalPattern.MatchString(text) {
+		return Money{}, fmt.Errorf("money: %q no es un monto válido", text)
+	}
+	amount.Mul(amount, new(big.Rat).SetInt(hundred))
+	if !amount.IsInt() {
+		return Money{}, fmt.Errorf("money: %q tiene más de dos decimales", text)
+	}
+	return Money{cents: new(big.Int).Set(amount.Num())}, nil
+}
+
+func MustParse(s string) Money {
+	m, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (m Money) value() *big.Int {
+	if m.cents == nil {
+		return new(big.Int)
+	}
+	return m.cents
+}
+
+func (m Money) Add(o Money) Money {
+	return Money{cents: new(big.Int).Add(m.value(), o.value())}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{cents: new(big.Int).Sub(m.value(), o.value())}
+}
+
+func (m Money) Mul(n int64) Money {
+	return Money{cents: new(big.Int).Mul(m.value(), big.NewInt(n))}
+}
+
+func (m Money) Neg() Money {
+	return Money{cents: new(big.Int).Neg(m.value())}
+}
+
+func (m Money) Cmp(o Money) int {
+	return m.value().Cmp(o.value())
+}
+
+func (m Money) Equal(o Money) bool {
+	return m.Cmp(o) == 0
+}
+
+func (m Money) Sign() int {
+	return m.value().Sign()
+}
+
+func (m Money) IsZero() bool {
+	return m.Sign() == 0
+}
+
+// Decimals is the number of decimals kept by Money, currencies can use fewer
+const Decimals = 2
+
+// Fits reports whether the amount has at most the given number of decimals
+func (m Money) Fits(decimals int) bool {
+	return m.Equal(m.Round(decimals))
+}
+
+// Round rounds half away from zero to the given number of decimals
+func (m Money) Round(decimals int) Money {
+	if decimals >= Decimals {
+		return m
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Decimals-decimals)), nil)
+	value := roundRat(new(big.Rat).SetFrac(m.value(), scale), 0)
+	return Money{cents: new(big.Int).Mul(value.Num(), scale)}
+}
+
+// String formats the amount with exactly two decimals, it is also what gets
+// written in the queries built with fmt.Sprintf
+func (m Money) String() string {
+	cents := new(big.Int).Abs(m.value())
+	units, rest := new(big.Int).QuoRem(cents, hundred, new(big.Int))
+	sign := ""
+	if m.Sign() < 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("%v%v.%02d", sign, units.String(), rest.Int64())
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts the amount as a JSON number or as a string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		*m = Money{}
+		return nil
+	}
+	text = strings.Trim(text, `"`)
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case []byte:
+		parsed, err := parseCents(string(value))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case string:
+		parsed, err := parseCents(value)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case int64:
+		*m = FromInt(value)
+		return nil
+	}
+	return errors.New("money: tipo de dato no soportado")
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Rate is an exchange rate, it keeps up to six decimals like the DB columns
+// that store it
+type Rate struct {
+	value *big.Rat
+}
+
+const rateDecimals = 6
+
+// ParseRate reads a decimal rate like "36.5", rates with more than six
+// decimals are rejected instead of being rounded
+func ParseRate(s string) (Rate, error) {
+	text := strings.TrimSpace(s)
+	if !ratePattern.MatchString(text) {
+		if decimalPattern.MatchString(text) {
+			return Rate{}, fmt.Errorf("money: %q tiene más de seis decimales", s)
+		}
+		return Rate{}, fmt.Errorf("money: %q no es una tasa válida", s)
+	}
+	value, _ := new(big.Rat).SetString(text)
+	return Rate{value: value}, nil
+}
+
+func MustParseRate(s string) Rate {
+	r, err := ParseRate(s)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// RateOf returns how many units of a are paid for each unit of b
+func RateOf(a Money, b Money) Rate {
+	if b.IsZero() {
+		return Rate{}
+	}
+	value := new(big.Rat).SetFrac(a.value(), b.value())
+	return Rate{value: roundRat(value, rateDecimals)}
+}
+
+func (r Rate) rat() *big.Rat {
+	if r.value == nil {
+		return new(big.Rat)
+	}
+	return r.value
+}
+
+func (r Rate) Sign() int {
+	return r.rat().Sign()
+}
+
+func (r Rate) Cmp(o Rate) int {
+	return r.rat().Cmp(o.rat())
+}
+
+func (r Rate) String() string {
+	return r.rat().FloatString(rateDecimals)
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		*r = Rate{}
+		return nil
+	}
+	parsed, err := ParseRate(strings.Trim(text, `"`))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r *Rate) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*r = Rate{}
+		return nil
+	case []byte:
+		return r.scanDecimal(string(value))
+	case string:
+		return r.scanDecimal(value)
+	case int64:
+		*r = Rate{value: new(big.Rat).SetInt64(value)}
+		return nil
+	}
+	return errors.New("money: tipo de dato no soportado")
+}
+
+// scanDecimal reads a rate computed by the DB, it can have more decimals
+// than the columns so it is rounded instead of rejected
+func (r *Rate) scanDecimal(text string) error {
+	value, ok := new(big.Rat).SetString(text)
+	if !ok || !decimalPattern.MatchString(text) {
+		return fmt.Errorf("money: %q no es una tasa válida", text)
+	}
+	*r = Rate{value: roundRat(value, rateDecimals)}
+	return nil
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+// Quantity is how many units are charged, like trips, cubic meters or hours.
+// It is a plain decimal with up to three decimals, not an amount of money.
+type Quantity struct {
+	value *big.Rat
+}
+
+const quantityDecimals = 3
+
+// ParseQuantity reads a decimal quantity like "2" or "2.5", quantities with
+// more than three decimals are rejected instead of being rounded
+func ParseQuantity(s string) (Quantity, error) {
+	text := strings.TrimSpace(s)
+	if !quantityPattern.MatchString(text) {
+		if decimalPattern.MatchString(text) {
+			return Quantity{}, fmt.Errorf("money: %q tiene más de tres decimales", s)
+		}
+		return Quantity{}, fmt.Errorf("money: %q no es una cantidad válida", s)
+	}
+	value, _ := new(big.Rat).SetString(text)
+	return Quantity{value: value}, nil
+}
+
+func MustParseQuantity(s string) Quantity {
+	q, err := ParseQuantity(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q Quantity) rat() *big.Rat {
+	if q.value == nil {
+		return new(big.Rat)
+	}
+	return q.value
+}
+
+func (q Quantity) Sign() int {
+	return q.rat().Sign()
+}
+
+// String formats the quantity without trailing zeros, "2.5" and not "2.500"
+func (q Quantity) String() string {
+	text := q.rat().FloatString(quantityDecimals)
+	text = strings.TrimRight(text, "0")
+	return strings.TrimSuffix(text, ".")
+}
+
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		*q = Quantity{}
+		return nil
+	}
+	parsed, err := ParseQuantity(strings.Trim(text, `"`))
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
+
+func (q *Quantity) Scan(src interface{}) error {
+	var text string
+	switch value := src.(type) {
+	case nil:
+		*q = Quantity{}
+		return nil
+	case []byte:
+		text = string(value)
+	case string:
+		text = value
+	case int64:
+		*q = Quantity{value: new(big.Rat).SetInt64(value)}
+		return nil
+	default:
+		return errors.New("money: tipo de dato no soportado")
+	}
+	value, ok := new(big.Rat).SetString(text)
+	if !ok || !decimalPattern.MatchString(text) {
+		return fmt.Errorf("money: %q no es una cantidad válida", text)
+	}
+	*q = Quantity{value: roundRat(value, quantityDecimals)}
+	return nil
+}
+
+func (q Quantity) Value() (driver.Value, error) {
+	return q.rat().FloatString(quantityDecimals), nil
+}
+
+// MulRate converts the amount multiplying it by the rate, the result is
+// rounded half away from zero to cents
+func (m Money) MulRate(r Rate) Money {
+	value := new(big.Rat).Mul(new(big.Rat).SetInt(m.value()), r.rat())
+	return Money{cents: roundRat(value, 0).Num()}
+}
+
+// DivRate converts the amount dividing it by the rate, the result is rounded
+// half away from zero to cents
+func (m Money) DivRate(r Rate) Money {
+	if r.Sign() == 0 {
+		return Money{}
+	}
+	value := new(big.Rat).Quo(new(big.Rat).SetInt(m.value()), r.rat())
+	return Money{cents: roundRat(value, 0).Num()}
+}
+
+// Percent returns the given percentage of the amount, the result is rounded
+// half away from zero to cents
+func (m Money) Percent(p Money) Money {
+	value := new(big.Rat).SetFrac(new(big.Int).Mul(m.value(), p.value()), big.NewInt(100*100))
+	return Money{cents: roundRat(value, 0).Num()}
+}
+
+// Times multiplies the amount by a quantity, the result is rounded half away
+// from zero to cents
+func (m Money) Times(q Quantity) Money {
+	value := new(big.Rat).Mul(new(big.Rat).SetInt(m.value()), q.rat())
+	return Money{cents: roundRat(value, 0).Num()}
+}
+
+// Allocate returns the share of the amount that corresponds to part out of
+// whole, the result is rounded half away from zero to cents
+func (m Money) Allocate(part int64, whole int64) Money {
+	if whole == 0 {
+		return Money{}
+	}
+	value := new(big.Rat).SetFrac(new(big.Int).Mul(m.value(), big.NewInt(part)), big.NewInt(whole))
+	return Money{cents: roundRat(value, 0).Num()}
+}
+
+// roundRat rounds half away from zero to the given number of decimals
+func roundRat(value *big.Rat, decimals int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	scaled := new(big.Rat).Mul(value, new(big.Rat).SetInt(scale))
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	doubled := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2))
+	if doubled.Cmp(scaled.Denom()) >= 0 {
+		if scaled.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return new(big.Rat).SetFrac(quotient, scale)
+}
@@ -0,0 +1,223 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAndString(t *testing.T) {
+	cases := map[string]string{
+		"0":                    "0.00",
+		"3":                    "3.00",
+		"1500.5":               "1500.50",
+		"0.01":                 "0.01",
+		"-12.30":               "-12.30",
+		"10000000000000000000": "10000000000000000000.00",
+		" 7.1 ":                "7.10",
+		"99999999999999999.99": "99999999999999999.99",
+	}
+	for input, want := range cases {
+		m, err := Parse(input)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error %v", input, err)
+			continue
+		}
+		if m.String() != want {
+			t.Errorf("Parse(%q) = %v, want %v", input, m.String(), want)
+		}
+	}
+}
+
+func TestParseRejectsMoreThanTwoDecimals(t *testing.T) {
+	for _, input := range []string{"1.005", "abc", "1/3", ""} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseRejectsNonDecimalForms(t *testing.T) {
+	tests := []struct {
+		input string
+		name  string
+	}{
+		{"0x10", "hexadecimal"},
+		{"0b11", "binary"},
+		{"0o17", "octal"},
+		{"1_000", "underscores"},
+		{"1e3", "exponent"},
+		{"1.5E2", "exponent with decimals"},
+		{"3/4", "fraction"},
+		{"+5", "explicit sign"},
+		{".5", "no integer part"},
+		{"5.", "no decimals after the point"},
+		{"1,000.00", "thousands separator"},
+		{"--1", "double sign"},
+	}
+	for _, test := range tests {
+		if m, err := Parse(test.input); err == nil {
+			t.Errorf("Parse(%q) with %v = %v, want an error", test.input, test.name, m)
+		}
+		if r, err := ParseRate(test.input); err == nil {
+			t.Errorf("ParseRate(%q) with %v = %v, want an error", test.input, test.name, r)
+		}
+	}
+
+	var payload struct {
+		Amount Money
+	}
+	if err := json.Unmarshal([]byte(`{"Amount": "0x10"}`), &payload); err == nil {
+		t.Errorf("string amount 0x10 was read as %v, want an error", payload.Amount)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("36.123456")
+	if err != nil || rate.String() != "36.123456" {
+		t.Errorf("ParseRate(36.123456) = %v (%v), want 36.123456", rate, err)
+	}
+	if rate, err := ParseRate("36.1234567"); err == nil {
+		t.Errorf("ParseRate(36.1234567) = %v, want an error instead of rounding", rate)
+	}
+
+	t.Log("testing rates computed by the DB are rounded")
+	var scanned Rate
+	if err := scanned.Scan([]byte("1.23456789")); err != nil || scanned.String() != "1.234568" {
+		t.Errorf("Scan(1.23456789) = %v (%v), want 1.234568", scanned, err)
+	}
+}
+
+func TestArithmeticIsExact(t *testing.T) {
+	balance := MustParse("99999999999999999.99")
+	balance = balance.Add(MustParse("0.01")).Sub(MustParse("0.10"))
+	if balance.String() != "99999999999999999.90" {
+		t.Errorf("balance = %v, want 99999999999999999.90", balance)
+	}
+
+	sum := Money{}
+	for i := 0; i < 10; i++ {
+		sum = sum.Add(MustParse("0.10"))
+	}
+	if !sum.Equal(FromInt(1)) {
+		t.Errorf("sum = %v, want 1.00", sum)
+	}
+	if MustParse("2.50").Mul(3).String() != "7.50" {
+		t.Errorf("2.50 * 3 = %v, want 7.50", MustParse("2.50").Mul(3))
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var payload struct {
+		Amount Money
+	}
+	err := json.Unmarshal([]byte(`{"Amount": 12345678901234567.89}`), &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != `{"Amount":12345678901234567.89}` {
+		t.Errorf("json = %v", string(encoded))
+	}
+
+	err = json.Unmarshal([]byte(`{"Amount": "5.5"}`), &payload)
+	if err != nil || payload.Amount.String() != "5.50" {
+		t.Errorf("string amounts should be accepted, got %v (%v)", payload.Amount, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("1234.56")); err != nil {
+		t.Fatal(err)
+	}
+	if m.String() != "1234.56" {
+		t.Errorf("m = %v, want 1234.56", m)
+	}
+}
+
+func TestRates(t *testing.T) {
+	rate := RateOf(MustParse("3650"), MustParse("100"))
+	if rate.String() != "36.500000" {
+		t.Errorf("rate = %v, want 36.500000", rate)
+	}
+	if MustParse("100").MulRate(rate).String() != "3650.00" {
+		t.Errorf("100 * %v = %v, want 3650.00", rate, MustParse("100").MulRate(rate))
+	}
+	if MustParse("1000").DivRate(MustParseRate("3")).String() != "333.33" {
+		t.Errorf("1000 / 3 = %v, want 333.33", MustParse("1000").DivRate(MustParseRate("3")))
+	}
+	if MustParse("0.05").MulRate(MustParseRate("0.5")).String() != "0.03" {
+		t.Errorf("0.05 * 0.5 = %v, want 0.03", MustParse("0.05").MulRate(MustParseRate("0.5")))
+	}
+	if RateOf(MustParse("1000"), MustParse("3")).String() != "333.333333" {
+		t.Errorf("1000 / 3 = %v, want 333.333333", RateOf(MustParse("1000"), MustParse("3")))
+	}
+}
+
+func TestPercentTimesAndAllocate(t *testing.T) {
+	if got := MustParse("1000").Percent(MustParse("12.5")); got.String() != "125.00" {
+		t.Errorf("12.5%% of 1000 = %v, want 125.00", got)
+	}
+	if got := MustParse("0.25").Percent(MustParse("10")); got.String() != "0.03" {
+		t.Errorf("10%% of 0.25 = %v, want 0.03", got)
+	}
+	if got := MustParse("12.35").Times(MustParseQuantity("2.5")); got.String() != "30.88" {
+		t.Errorf("12.35 * 2.5 = %v, want 30.88", got)
+	}
+	if got := MustParse("100").Allocate(1, 3); got.String() != "33.33" {
+		t.Errorf("1/3 of 100 = %v, want 33.33", got)
+	}
+	if got := MustParse("100").Allocate(2, 3); got.String() != "66.67" {
+		t.Errorf("2/3 of 100 = %v, want 66.67", got)
+	}
+	if got := MustParse("100").Allocate(1, 0); !got.IsZero() {
+		t.Errorf("1/0 of 100 = %v, want 0.00", got)
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals int
+		want     string
+	}{
+		{"12.34", 2, "12.34"},
+		{"12.35", 1, "12.40"},
+		{"12.50", 0, "13.00"},
+		{"-12.50", 0, "-13.00"},
+		{"12.49", 0, "12.00"},
+	}
+	for _, test := range tests {
+		got := MustParse(test.amount).Round(test.decimals)
+		if got.String() != test.want {
+			t.Errorf("Round(%v, %v) = %v, want %v", test.amount, test.decimals, got, test.want)
+		}
+	}
+	if MustParse("12.30").Fits(0) || !MustParse("12.30").Fits(1) {
+		t.Error("12.30 should fit one decimal but not zero")
+	}
+}
+
+func TestQuantity(t *testing.T) {
+	quantity, err := ParseQuantity("2.125")
+	if err != nil || quantity.String() != "2.125" {
+		t.Errorf("ParseQuantity(2.125) = %v (%v), want 2.125", quantity, err)
+	}
+	if got := MustParseQuantity("2.50").String(); got != "2.5" {
+		t.Errorf("2.50 = %v, want 2.5", got)
+	}
+	if got := MustParseQuantity("3").String(); got != "3" {
+		t.Errorf("3 = %v, want 3", got)
+	}
+	for _, input := range []string{"2.1255", "0x10", "1e3", "1/3", ""} {
+		if q, err := ParseQuantity(input); err == nil {
+			t.Errorf("ParseQuantity(%q) = %v, want an error", input, q)
+		}
+	}
+	if got := MustParse("10").Times(MustParseQuantity("0.125")); got.String() != "1.25" {
+		t.Errorf("10 * 0.125 = %v, want 1.25", got)
+	}
+}
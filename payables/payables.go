@@ -0,0 +1,615 @@
+package payables
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+// SelectPayablesQuery lists the payables with their supplier and the
+// balances of their payments, callers append their own WHERE and ORDER BY
+// clauses and read rows with ScanPayable
+const SelectPayablesQuery = "SELECT payables.id, code, supplier, name, COALESCE(national_id, ''), description, amount, currency, date, due_date, url, paid, scheduled, outstanding, paid_off, payables.created_at FROM payables_with_balances AS payables INNER JOIN actors ON payables.supplier = actors.id"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func ScanPayable(row scanner) (types.Payable, error) {
+	payable := types.Payable{}
+	err := row.Scan(&payable.Id, &payable.Code, &payable.Supplier.Id, &payable.Supplier.Name, &payable.Supplier.NationalId, &payable.Description, &payable.Amount, &payable.Currency, &payable.Date, &payable.DueDate, &payable.Url, &payable.Paid, &payable.Scheduled, &payable.Outstanding, &payable.PaidOff, &payable.CreatedAt)
+	payable.Date = strings.Split(payable.Date, "T")[0]
+	payable.DueDate = strings.Split(payable.DueDate, "T")[0]
+	return payable, err
+}
+
+// loadPayable returns the payable with its executed and scheduled payments,
+// the Id of the returned payable is zero when it does not exist
+func loadPayable(db *sql.DB, payableId int) (types.Payable, error) {
+	payable, err := ScanPayable(db.QueryRow(fmt.Sprintf("%v WHERE payables.id='%v';", SelectPayablesQuery, payableId)))
+	if err == sql.ErrNoRows {
+		return types.Payable{}, nil
+	}
+	if err != nil {
+		return payable, err
+	}
+
+	payable.Payments = []types.TransactionWithBalance{}
+	rows, err := db.Query(fmt.Sprintf("%v WHERE transactions_with_balances.payable='%v' ORDER BY transactions_with_balances.id;", ledger.SelectTransactionsQuery, payable.Id))
+	if err != nil {
+		return payable, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		payment, err := ledger.ScanTransaction(rows)
+		if err != nil {
+			return payable, err
+		}
+		payable.Payments = append(payable.Payments, payment)
+	}
+	if err := rows.Err(); err != nil {
+		return payable, err
+	}
+
+	payable.PendingPayments = []types.PendingTransaction{}
+	pendingRows, err := db.Query(fmt.Sprintf("%v WHERE pending_transactions.payable='%v' ORDER BY pending_transactions.id;", ledger.SelectPendingTransactionsQuery, payable.Id))
+	if err != nil {
+		return payable, err
+	}
+	defer pendingRows.Close()
+	for pendingRows.Next() {
+		pending, err := ledger.ScanPendingTransaction(pendingRows)
+		if err != nil {
+			return payable, err
+		}
+		payable.PendingPayments = append(payable.PendingPayments, pending)
+	}
+	if err := pendingRows.Err(); err != nil {
+		return payable, err
+	}
+	return payable, ledger.AttachSteps(db, payable.PendingPayments)
+}
+
+// preparePayable validates the payable sent by the client and fills its
+// defaults, it returns a message for the client when it should be rejected
+func preparePayable(db *sql.DB, payable *types.Payable) (string, error) {
+	payable.Code = strings.TrimSpace(payable.Code)
+	payable.Description = strings.TrimSpace(payable.Description)
+	if payable.Code == "" {
+		return "Debe especificar el código de la factura del proveedor", nil
+	}
+	if payable.Description == "" {
+		return "La cuenta por pagar debe poseer una descripción", nil
+	}
+	if payable.Supplier.Id <= 0 {
+		return "Debe especificar el proveedor de la cuenta por pagar", nil
+	}
+	if payable.Amount.Sign() <= 0 {
+		return "El monto de la cuenta por pagar debe ser mayor a cero (0)", nil
+	}
+	if payable.Amount.Cmp(types.MaxTransactionAmount) > 0 {
+		return "El monto de la cuenta por pagar excede el máximo permitido", nil
+	}
+	if payable.Currency == "" {
+		payable.Currency = "USD"
+	}
+	message, err := ledger.CheckCurrency(db, payable.Currency, payable.Amount)
+	if err != nil || message != "" {
+		return message, err
+	}
+
+	if payable.Date == "" {
+		payable.Date = time.Now().Format(types.DateFormat)
+	}
+	date, err := time.Parse(types.DateFormat, payable.Date)
+	if err != nil {
+		return "La fecha de la cuenta por pagar no tiene un formato válido", nil
+	}
+	dueDate, err := time.Parse(types.DateFormat, payable.DueDate)
+	if err != nil {
+		return "La fecha de vencimiento no tiene un formato válido", nil
+	}
+	if dueDate.Before(date) {
+		return "La fecha de vencimiento no puede ser anterior a la fecha de la factura", nil
+	}
+
+	var supplierType string
+	err = db.QueryRow(fmt.Sprintf("SELECT type FROM actors WHERE id='%v';", payable.Supplier.Id)).Scan(&supplierType)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if supplierType == "" {
+		return "El proveedor especificado no existe", nil
+	}
+	if supplierType != "third" {
+		return "El proveedor especificado no es un tercero", nil
+	}
+	return "", nil
+}
+
+// weekEnd returns the sunday that closes the week of the given date
+func weekEnd(date time.Time) time.Time {
+	return date.AddDate(0, 0, (7-int(date.Weekday()))%7)
+}
+
+// GetPayables lists the payables, the supplier parameter keeps the ones of a
+// supplier and due=week keeps the ones with something left to pay that are
+// due by the end of the week of the date parameter, today by default, so
+// overdue payables are listed too
+func GetPayables(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	conditions := []string{}
+	order := "payables.id"
+
+	if supplier := query.Get("supplier"); supplier != "" {
+		supplierId, err := strconv.Atoi(supplier)
+		if err != nil || supplierId <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Id de proveedor no válido")
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("payables.supplier='%v'", supplierId))
+	}
+
+	if due := query.Get("due"); due != "" {
+		if due != "week" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "El vencimiento solo puede ser 'week'")
+			return
+		}
+		date := query.Get("date")
+		if date == "" {
+			date = time.Now().Format(types.DateFormat)
+		}
+		asOf, err := time.Parse(types.DateFormat, date)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La fecha no tiene un formato válido")
+			return
+		}
+		conditions = append(conditions, "payables.outstanding > 0", fmt.Sprintf("payables.due_date <= '%v'", weekEnd(asOf).Format(types.DateFormat)))
+		order = "payables.due_date, payables.id"
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	payables := []types.Payable{}
+	rows, err := db.Query(fmt.Sprintf("%v%v ORDER BY %v;", SelectPayablesQuery, where, order))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		payable, err := ScanPayable(rows)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		payables = append(payables, payable)
+	}
+
+	response, err := json.Marshal(payables)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func GetPayable(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	payableId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if payableId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id de la cuenta por pagar debe ser mayor a cero")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	payable, err := loadPayable(db, payableId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if payable.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta por pagar con el id %v no existe", payableId)
+		return
+	}
+
+	response, err := json.Marshal(payable)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func CreatePayable(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	payable := types.Payable{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &payable)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con una cuenta por pagar")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := preparePayable(db, &payable)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	var insertedId int
+	insertPayableQuery := fmt.Sprintf("INSERT INTO payables (code, supplier, description, amount, currency, date, due_date, url) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", payable.Code, payable.Supplier.Id, payable.Description, payable.Amount, payable.Currency, payable.Date, payable.DueDate, payable.Url)
+	err = db.QueryRow(insertPayableQuery).Scan(&insertedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	insertedPayable, err := loadPayable(db, insertedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(insertedPayable)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// PatchPayable replaces the payable, once it has payments, executed or
+// scheduled, its supplier and currency are fixed and its amount can not be
+// less than what they add up to
+func PatchPayable(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	payableId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if payableId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id de la cuenta por pagar debe ser mayor a cero")
+		return
+	}
+	payable := types.Payable{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &payable)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data enviada no corresponde con una cuenta por pagar")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := preparePayable(db, &payable)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
+
+	var supplierId int
+	var currency string
+	err = tx.QueryRow(fmt.Sprintf("SELECT supplier, currency FROM payables WHERE id='%v' FOR UPDATE;", payableId)).Scan(&supplierId, &currency)
+	if err != nil && err != sql.ErrNoRows {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if supplierId == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta por pagar con el id %v no existe", payableId)
+		return
+	}
+
+	current, err := ScanPayable(tx.QueryRow(fmt.Sprintf("%v WHERE payables.id='%v';", SelectPayablesQuery, payableId)))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	committed := current.Paid.Add(current.Scheduled)
+	if !committed.IsZero() && (payable.Supplier.Id != supplierId || payable.Currency != currency) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se puede cambiar el proveedor ni la moneda de una cuenta por pagar con pagos")
+		return
+	}
+	if payable.Amount.Cmp(committed) < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El monto de la cuenta por pagar no puede ser menor a lo pagado y programado (%v)", committed)
+		return
+	}
+
+	updatePayableQuery := fmt.Sprintf("UPDATE payables SET code='%v', supplier='%v', description='%v', amount='%v', currency='%v', date='%v', due_date='%v', url='%v' WHERE id='%v';", payable.Code, payable.Supplier.Id, payable.Description, payable.Amount, payable.Currency, payable.Date, payable.DueDate, payable.Url, payableId)
+	_, err = tx.Exec(updatePayableQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	updatedPayable, err := loadPayable(db, payableId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(updatedPayable)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func DeletePayable(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestedId := ps.ByName("id")
+	id, err := strconv.Atoi(requestedId)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id de la cuenta por pagar debe ser mayor a cero")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	deletedId := types.IdResponse{}
+	err = db.QueryRow(fmt.Sprintf("DELETE FROM payables WHERE id='%v' RETURNING id;", id)).Scan(&deletedId.Id)
+	if err != nil && err != sql.ErrNoRows {
+		if err.Error() == "pq: update or delete on table \"payables\" violates foreign key constraint \"transactions_with_balances_payable_fkey\" on table \"transactions_with_balances\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La cuenta por pagar que intenta borrar tiene uno o mas pagos asociados por lo que no puede ser eliminada")
+			return
+		}
+		if err.Error() == "pq: update or delete on table \"payables\" violates foreign key constraint \"pending_transactions_payable_fkey\" on table \"pending_transactions\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La cuenta por pagar que intenta borrar tiene uno o mas pagos programados por lo que no puede ser eliminada")
+			return
+		}
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	if deletedId.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta por pagar con el id %v no existe", requestedId)
+		return
+	}
+	response, err := json.Marshal(deletedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// SchedulePayment creates the pending output that pays the supplier from
+// the given account, the amount defaults to what is left to schedule and the
+// due date to the one of the payable. The payable is marked as paid as its
+// pending transactions are executed.
+func SchedulePayment(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	payableId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if payableId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id de la cuenta por pagar debe ser mayor a cero")
+		return
+	}
+	payment := types.PendingTransaction{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &payment)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con un pago")
+		return
+	}
+	if payment.Amount.Sign() < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El monto del pago no puede ser negativo")
+		return
+	}
+	if payment.Account.Id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El pago debe poseer una cuenta")
+		return
+	}
+	if payment.DueDate != "" {
+		if _, err := time.Parse(types.DateFormat, payment.DueDate); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La fecha de vencimiento no tiene un formato válido")
+			return
+		}
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := ledger.CheckCategory(db, payment.Category.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
+
+	var lockedId int
+	err = tx.QueryRow(fmt.Sprintf("SELECT id FROM payables WHERE id='%v' FOR UPDATE;", payableId)).Scan(&lockedId)
+	if err != nil && err != sql.ErrNoRows {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if lockedId == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta por pagar con el id %v no existe", payableId)
+		return
+	}
+	payable, err := ScanPayable(tx.QueryRow(fmt.Sprintf("%v WHERE payables.id='%v';", SelectPayablesQuery, payableId)))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	remaining := payable.Outstanding.Sub(payable.Scheduled)
+	if remaining.Sign() <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta por pagar %v no tiene saldo por programar", payableId)
+		return
+	}
+	if payment.Amount.IsZero() {
+		payment.Amount = remaining
+	}
+	if payment.Amount.Cmp(remaining) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El pago excede el saldo por programar de la cuenta por pagar (%v)", remaining)
+		return
+	}
+	message, err = ledger.CheckCurrency(tx, payable.Currency, payment.Amount)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	accountCurrency, err := ledger.AccountCurrency(tx, payment.Account.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if accountCurrency == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta especificada no existe")
+		return
+	}
+	if accountCurrency != payable.Currency {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La moneda de la cuenta debe ser la moneda de la cuenta por pagar (%v)", payable.Currency)
+		return
+	}
+
+	if payment.Description == "" {
+		payment.Description = fmt.Sprintf("Pago de la factura %v de %v", payable.Code, payable.Supplier.Name)
+	}
+	if payment.DueDate == "" {
+		payment.DueDate = payable.DueDate
+	}
+	insertPendingQuery := fmt.Sprintf("INSERT INTO pending_transactions (type, currency, amount, description, account, actor, category, payable, due_date) VALUES ('output', '%v', '%v', '%v', '%v', '%v', %v, '%v', '%v');", payable.Currency, payment.Amount, payment.Description, payment.Account.Id, payable.Supplier.Id, ledger.Nullable(payment.Category.Id), payable.Id, payment.DueDate)
+	_, err = tx.Exec(insertPendingQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	scheduledPayable, err := loadPayable(db, payableId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(scheduledPayable)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -0,0 +1,327 @@
+package payables
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"example.com/backend_gandola_soft/actors"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/pending_transactions"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/transactions"
+	"example.com/backend_gandola_soft/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+func createPayable(t *testing.T, router *httprouter.Router, payable types.Payable) types.Payable {
+	rr := testutils.MakeRequest(t, router, "POST", "/payables", payable)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdPayable := types.Payable{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdPayable)
+	if err != nil {
+		t.Fatal("Response body does not contain a Payable type")
+	}
+	return createdPayable
+}
+
+func TestGetPayables(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/payables", GetPayables)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/payables", nil)
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	payables := []types.Payable{}
+	err := json.Unmarshal(rr.Body.Bytes(), &payables)
+	if err != nil {
+		t.Error("Response body does not contain an array of type Payable")
+	}
+}
+
+func TestCreatePayable(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/payables", CreatePayable)
+
+	dueDate := time.Now().AddDate(0, 0, 15).Format(types.DateFormat)
+	payable := types.Payable{Code: "F-0001", Description: "pastillas de freno", Amount: money.MustParse("250.50"), DueDate: dueDate}
+	payable.Supplier.Id = 1
+	createdPayable := createPayable(t, router, payable)
+
+	t.Log("testing the created payable")
+	if createdPayable.Id == 0 || createdPayable.Currency != "USD" || createdPayable.DueDate != dueDate {
+		t.Errorf("payable = %v %v due %v, want USD due %v", createdPayable.Id, createdPayable.Currency, createdPayable.DueDate, dueDate)
+	}
+	if !createdPayable.Outstanding.Equal(money.MustParse("250.50")) || !createdPayable.Paid.IsZero() || createdPayable.PaidOff {
+		t.Errorf("outstanding = %v, paid = %v, want 250.50 and 0", createdPayable.Outstanding, createdPayable.Paid)
+	}
+}
+
+func TestCreatePayableFromCompany(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/payables", CreatePayable)
+
+	payable := types.Payable{Code: "F-0001", Description: "pastillas de freno", Amount: money.MustParse("100"), DueDate: time.Now().Format(types.DateFormat)}
+	payable.Supplier.Id = 2
+	rr := testutils.MakeRequest(t, router, "POST", "/payables", payable)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "El proveedor especificado no es un tercero"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestCreatePayableDueBeforeDate(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/payables", CreatePayable)
+
+	payable := types.Payable{Code: "F-0001", Description: "pastillas de freno", Amount: money.MustParse("100"), DueDate: time.Now().AddDate(0, 0, -1).Format(types.DateFormat)}
+	payable.Supplier.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/payables", payable)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La fecha de vencimiento no puede ser anterior a la fecha de la factura"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestSchedulePayments(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/payables", CreatePayable)
+	router.GET("/payables/:id", GetPayable)
+	router.PATCH("/payables/:id", PatchPayable)
+	router.POST("/payables/:id/schedule", SchedulePayment)
+	router.PUT("/pending_transactions/:id", pending_transactions.ExecutePendingTransaction)
+	router.POST("/transactions", transactions.CreateTransaction)
+	router.POST("/actors", actors.CreateActor)
+	router.PUT("/pending_transactions/:id/submit", pending_transactions.SubmitPendingTransaction)
+	router.PUT("/pending_transactions/:id/approve", pending_transactions.ApprovePendingTransaction)
+
+	payable := types.Payable{Code: "F-0001", Description: "pastillas de freno", Amount: money.MustParse("100"), DueDate: time.Now().Format(types.DateFormat)}
+	payable.Supplier.Id = 1
+	createdPayable := createPayable(t, router, payable)
+	scheduleUrl := fmt.Sprintf("/payables/%v/schedule", createdPayable.Id)
+
+	t.Log("testing a partial payment")
+	payment := types.PendingTransaction{Amount: money.MustParse("40")}
+	payment.Account.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", scheduleUrl, payment)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	scheduledPayable := types.Payable{}
+	err := json.Unmarshal(rr.Body.Bytes(), &scheduledPayable)
+	if err != nil {
+		t.Fatal("Response body does not contain a Payable type")
+	}
+	if len(scheduledPayable.PendingPayments) != 1 || !scheduledPayable.Scheduled.Equal(money.MustParse("40")) {
+		t.Fatalf("scheduled = %v in %v payments, want 40 in 1", scheduledPayable.Scheduled, len(scheduledPayable.PendingPayments))
+	}
+	pending := scheduledPayable.PendingPayments[0]
+	if pending.Type != "output" || pending.Actor.Id != 1 || pending.Payable != createdPayable.Id {
+		t.Errorf("pending = %v to %v for %v, want output to 1 for %v", pending.Type, pending.Actor.Id, pending.Payable, createdPayable.Id)
+	}
+
+	t.Log("testing a payment over what is left to schedule")
+	payment.Amount = money.MustParse("60.01")
+	rr = testutils.MakeRequest(t, router, "POST", scheduleUrl, payment)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "El pago excede el saldo por programar de la cuenta por pagar (60.00)"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+
+	t.Log("testing the amount can not drop below what is scheduled")
+	patch := payable
+	patch.Amount = money.MustParse("39")
+	patch.DueDate = createdPayable.DueDate
+	rr = testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/payables/%v", createdPayable.Id), patch)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+
+	t.Log("testing the payment is counted as paid once executed")
+	funds := types.TransactionWithBalance{}
+	funds.Type = "input"
+	funds.Currency = "USD"
+	funds.Amount = money.MustParse("40")
+	funds.Description = "funds for the payable"
+	funds.Actor.Id = 1
+	funds.Account.Id = 1
+	rr = testutils.MakeRequest(t, router, "POST", "/transactions", funds)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	approver := types.Actor{Type: "personnel", Name: fmt.Sprintf("aprobador %v", time.Now().UnixNano())}
+	rr = testutils.MakeRequest(t, router, "POST", "/actors", approver)
+	err = json.Unmarshal(rr.Body.Bytes(), &approver)
+	if err != nil {
+		t.Fatal("Response body does not contain an Actor type")
+	}
+	step := types.PendingStep{}
+	step.Actor.Id = approver.Id
+	for _, action := range []string{"submit", "approve"} {
+		rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v/%v", pending.Id, action), step)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+		}
+	}
+	rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v", pending.Id), step)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	rr = testutils.MakeRequest(t, router, "GET", fmt.Sprintf("/payables/%v", createdPayable.Id), nil)
+	paidPayable := types.Payable{}
+	err = json.Unmarshal(rr.Body.Bytes(), &paidPayable)
+	if err != nil {
+		t.Fatal("Response body does not contain a Payable type")
+	}
+	if !paidPayable.Paid.Equal(money.MustParse("40")) || !paidPayable.Scheduled.IsZero() || len(paidPayable.Payments) != 1 {
+		t.Errorf("paid = %v, scheduled = %v, want 40 and 0", paidPayable.Paid, paidPayable.Scheduled)
+	}
+
+	t.Log("testing the rest is scheduled by default")
+	payment.Amount = money.Money{}
+	rr = testutils.MakeRequest(t, router, "POST", scheduleUrl, payment)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &scheduledPayable)
+	if err != nil {
+		t.Fatal("Response body does not contain a Payable type")
+	}
+	if !scheduledPayable.Paid.Add(scheduledPayable.Scheduled).Equal(money.MustParse("100")) {
+		t.Errorf("paid = %v, scheduled = %v, want 100 between them", scheduledPayable.Paid, scheduledPayable.Scheduled)
+	}
+}
+
+func TestRescheduleRejectedPayment(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/payables", CreatePayable)
+	router.POST("/payables/:id/schedule", SchedulePayment)
+	router.POST("/actors", actors.CreateActor)
+	router.PUT("/pending_transactions/:id/submit", pending_transactions.SubmitPendingTransaction)
+	router.PUT("/pending_transactions/:id/reject", pending_transactions.RejectPendingTransaction)
+
+	payable := types.Payable{Code: "F-0002", Description: "cauchos", Amount: money.MustParse("100"), DueDate: time.Now().Format(types.DateFormat)}
+	payable.Supplier.Id = 1
+	createdPayable := createPayable(t, router, payable)
+	scheduleUrl := fmt.Sprintf("/payables/%v/schedule", createdPayable.Id)
+
+	payment := types.PendingTransaction{}
+	payment.Account.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", scheduleUrl, payment)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	scheduledPayable := types.Payable{}
+	err := json.Unmarshal(rr.Body.Bytes(), &scheduledPayable)
+	if err != nil || len(scheduledPayable.PendingPayments) != 1 {
+		t.Fatal("Response body does not contain a Payable type with its scheduled payment")
+	}
+
+	approver := types.Actor{Type: "personnel", Name: fmt.Sprintf("aprobador %v", time.Now().UnixNano())}
+	rr = testutils.MakeRequest(t, router, "POST", "/actors", approver)
+	err = json.Unmarshal(rr.Body.Bytes(), &approver)
+	if err != nil {
+		t.Fatal("Response body does not contain an Actor type")
+	}
+	step := types.PendingStep{}
+	step.Actor.Id = approver.Id
+	for _, action := range []string{"submit", "reject"} {
+		rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v/%v", scheduledPayable.PendingPayments[0].Id, action), step)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+		}
+	}
+
+	t.Log("testing the rejected payment is no longer scheduled")
+	rr = testutils.MakeRequest(t, router, "POST", scheduleUrl, payment)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &scheduledPayable)
+	if err != nil {
+		t.Fatal("Response body does not contain a Payable type")
+	}
+	if !scheduledPayable.Scheduled.Equal(money.MustParse("100")) {
+		t.Errorf("scheduled = %v, want 100", scheduledPayable.Scheduled)
+	}
+}
+
+func TestGetPayablesDueThisWeek(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/payables", CreatePayable)
+	router.GET("/payables", GetPayables)
+
+	today := time.Now()
+	payable := types.Payable{Code: "F-0001", Description: "pastillas de freno", Amount: money.MustParse("10"), DueDate: weekEnd(today).Format(types.DateFormat)}
+	payable.Supplier.Id = 1
+	dueThisWeek := createPayable(t, router, payable)
+	payable.DueDate = weekEnd(today).AddDate(0, 0, 1).Format(types.DateFormat)
+	dueNextWeek := createPayable(t, router, payable)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/payables?due=week", nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	payables := []types.Payable{}
+	err := json.Unmarshal(rr.Body.Bytes(), &payables)
+	if err != nil {
+		t.Fatal("Response body does not contain an array of type Payable")
+	}
+	listed := map[int]bool{}
+	for _, payable := range payables {
+		listed[payable.Id] = true
+	}
+	if !listed[dueThisWeek.Id] || listed[dueNextWeek.Id] {
+		t.Errorf("listed = %v, want %v and not %v", listed, dueThisWeek.Id, dueNextWeek.Id)
+	}
+}
+
+func TestGetPayablesWithBadDue(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/payables", GetPayables)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/payables?due=month", nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "El vencimiento solo puede ser 'week'"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestWeekEnd(t *testing.T) {
+	tests := []struct {
+		date string
+		want string
+	}{
+		{"2022-05-02", "2022-05-08"},
+		{"2022-05-05", "2022-05-08"},
+		{"2022-05-08", "2022-05-08"},
+	}
+	for _, test := range tests {
+		date, _ := time.Parse(types.DateFormat, test.date)
+		if got := weekEnd(date).Format(types.DateFormat); got != test.want {
+			t.Errorf("weekEnd(%v) = %v, want %v", test.date, got, test.want)
+		}
+	}
+}
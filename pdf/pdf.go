@@ -0,0 +1,174 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Letter size in points, the coordinates taken by a Document start on the top
+// left corner of the page and grow to the right and down
+const (
+	PageWidth  = 612.0
+	PageHeight = 792.0
+)
+
+// Document is a minimal PDF writer with the standard Helvetica fonts, enough
+// to export statements and invoices without external dependencies
+type Document struct {
+	pages []*bytes.Buffer
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage starts a new page, the following drawing goes on it
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+}
+
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// Pages returns the number of pages of the document
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+func fontName(bold bool) string {
+	if bold {
+		return "F2"
+	}
+	return "F1"
+}
+
+// Text writes text with its baseline at x, y
+func (d *Document) Text(x float64, y float64, size float64, bold bool, text string) {
+	fmt.Fprintf(d.page(), "BT /%v %.2f Tf %.2f %.2f Td (%v) Tj ET\n", fontName(bold), size, x, PageHeight-y, escape(text))
+}
+
+// TextRight writes text ending at x, used to align amounts in columns
+func (d *Document) TextRight(x float64, y float64, size float64, bold bool, text string) {
+	d.Text(x-TextWidth(text, size, bold), y, size, bold, text)
+}
+
+// Line draws a thin line between two points
+func (d *Document) Line(x1 float64, y1 float64, x2 float64, y2 float64) {
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// Rect draws the border of a rectangle whose top left corner is x, y
+func (d *Document) Rect(x float64, y float64, width float64, height float64) {
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f %.2f %.2f re S\n", x, PageHeight-y-height, width, height)
+}
+
+// Write outputs the document with one content stream per page
+func (d *Document) Write(w io.Writer) error {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	out := &bytes.Buffer{}
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(out, "%v 0 obj\n%v\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// the catalog, the page tree and the fonts come first, so every page
+	// is followed by its content stream from object 5 on
+	kids := []string{}
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%v 0 R", 5+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%v] /Count %v >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %v %v] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %v 0 R >>", PageWidth, PageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %v >>\nstream\n%vendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %v\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %v /Root 1 0 R >>\nstartxref\n%v\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// escape encodes the text in WinAnsi, which covers the Spanish letters, and
+// escapes the characters that delimit PDF strings. Characters outside the
+// encoding are replaced by a question mark.
+func escape(text string) string {
+	escaped := &strings.Builder{}
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(byte(r))
+		case r == '€':
+			escaped.WriteString("\\200")
+		case r == '\n' || r == '\t':
+			escaped.WriteByte(' ')
+		case r >= 32 && r < 127:
+			escaped.WriteByte(byte(r))
+		case r >= 160 && r < 256:
+			fmt.Fprintf(escaped, "\\%03o", r)
+		default:
+			escaped.WriteByte('?')
+		}
+	}
+	return escaped.String()
+}
+
+// widths of the Helvetica glyphs in thousandths of the font size for the
+// characters used in amounts, every other glyph is taken as an average one
+var widths = map[rune]float64{
+	' ': 278, '.': 278, ',': 278, '-': 333, '(': 333, ')': 333, '/': 278, ':': 278, '%': 889,
+	'0': 556, '1': 556, '2': 556, '3': 556, '4': 556, '5': 556, '6': 556, '7': 556, '8': 556, '9': 556,
+	'$': 556, 'i': 222, 'l': 222, 'I': 278, 'f': 278, 't': 278, 'r': 333, 'm': 833, 'w': 722, 'M': 833, 'W': 944,
+}
+
+// boldWidths are the Helvetica-Bold widths that differ from the regular ones
+var boldWidths = map[rune]float64{
+	':': 333, 'i': 278, 'l': 278, 'r': 389, 'm': 889, 'w': 778,
+}
+
+// Truncate cuts the text to length characters, ending it with an ellipsis,
+// so it fits in its column
+func Truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-3]) + "..."
+}
+
+// TextWidth estimates the width of the text in points, it is exact for
+// amounts and close enough for words
+func TextWidth(text string, size float64, bold bool) float64 {
+	var width float64
+	for _, r := range text {
+		glyph, found := widths[r]
+		if !found {
+			glyph = 556
+		}
+		if bold {
+			if boldGlyph, found := boldWidths[r]; found {
+				glyph = boldGlyph
+			}
+		}
+		width += glyph
+	}
+	return width * size / 1000
+}
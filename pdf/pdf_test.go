@@ -0,0 +1,82 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	document := New()
+	document.Text(50, 50, 12, true, "Estado de cuenta")
+	document.AddPage()
+	document.TextRight(560, 50, 10, false, "1500.00")
+	document.Line(50, 60, 560, 60)
+
+	out := &bytes.Buffer{}
+	err := document.Write(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := out.String()
+
+	t.Log("testing header and page count")
+	if !strings.HasPrefix(content, "%PDF-1.4\n") {
+		t.Error("document should start with the PDF header")
+	}
+	if !strings.Contains(content, "/Count 2") {
+		t.Error("document should have two pages")
+	}
+
+	t.Log("testing that the cross reference table points to every object")
+	xref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(content)
+	if xref == nil {
+		t.Fatal("document has no startxref")
+	}
+	start, _ := strconv.Atoi(xref[1])
+	if !strings.HasPrefix(content[start:], "xref\n") {
+		t.Fatalf("startxref %v does not point to the xref table", start)
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(content, -1)
+	if len(offsets) != 8 {
+		t.Fatalf("xref has %v objects, want 8", len(offsets))
+	}
+	for i, offset := range offsets {
+		position, _ := strconv.Atoi(offset[1])
+		if !strings.HasPrefix(content[position:], fmt.Sprintf("%v 0 obj", i+1)) {
+			t.Errorf("offset of object %v does not point to it", i+1)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	cases := map[string]string{
+		"Compañía (cero)": `Compa\361\355a \(cero\)`,
+		`a\b`:             `a\\b`,
+		"€ 10":            `\200 10`,
+		"日本":              "??",
+	}
+	for text, want := range cases {
+		if got := escape(text); got != want {
+			t.Errorf("escape(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if text := Truncate("Caracas", 7); text != "Caracas" {
+		t.Errorf("Truncate = %v, want Caracas", text)
+	}
+	if text := Truncate("Dirección fiscal", 10); text != "Direcci..." {
+		t.Errorf("Truncate = %v, want Direcci...", text)
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	if width := TextWidth("10.00", 10, false); width != 25.02 {
+		t.Errorf("TextWidth = %v, want 25.02", width)
+	}
+}
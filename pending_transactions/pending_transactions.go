@@ -1,13 +1,20 @@
 package pending_transactions
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/rates"
+	"example.com/backend_gandola_soft/settings"
 	"example.com/backend_gandola_soft/types"
 	"example.com/backend_gandola_soft/utils"
 	"github.com/julienschmidt/httprouter"
@@ -17,21 +24,25 @@ func GetPendingTransactions(w http.ResponseWriter, r *http.Request, _ httprouter
 	transactions := []types.PendingTransaction{}
 	db := database.ConnectDB()
 	defer db.Close()
-	rows, err := db.Query("SELECT pending_transactions.id, pending_transactions.type, pending_transactions.currency, pending_transactions.amount, pending_transactions.description, pending_transactions.created_at, actors.id, actors.name FROM pending_transactions, actors WHERE pending_transactions.actor = actors.id ORDER BY pending_transactions.id;")
+	rows, err := db.Query(ledger.SelectPendingTransactionsQuery + " ORDER BY pending_transactions.id;")
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
-		transaction := types.PendingTransaction{}
-		err = rows.Scan(&transaction.Id, &transaction.Type, &transaction.Currency, &transaction.Amount, &transaction.Description, &transaction.CreatedAt, &transaction.Actor.Id, &transaction.Actor.Name)
+		transaction, err := ledger.ScanPendingTransaction(rows)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
 		transactions = append(transactions, transaction)
 	}
+	err = ledger.AttachSteps(db, transactions)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
 	json_transactions, err := json.Marshal(transactions)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -41,6 +52,18 @@ func GetPendingTransactions(w http.ResponseWriter, r *http.Request, _ httprouter
 	w.Write(json_transactions)
 }
 
+// checkDueDate validates the optional due date of a pending transaction, it
+// returns a message for the client when it is not valid
+func checkDueDate(dueDate string) string {
+	if dueDate == "" {
+		return ""
+	}
+	if _, err := time.Parse(types.DateFormat, dueDate); err != nil {
+		return "La fecha de vencimiento no tiene un formato válido"
+	}
+	return ""
+}
+
 func CreatePendingTransaction(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	transaction := types.PendingTransaction{}
 	body, err := ioutil.ReadAll(r.Body)
@@ -60,17 +83,12 @@ func CreatePendingTransaction(w http.ResponseWriter, r *http.Request, _ httprout
 		fmt.Fprintf(w, "El tipo de transacción solo puede ser del tipo 'input' o 'output'")
 		return
 	}
-	if transaction.Currency != "USD" && transaction.Currency != "VES" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Solo se aceptan monedas de tipo VES y USD")
-		return
-	}
-	if transaction.Amount <= 0 {
+	if transaction.Amount.Sign() <= 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "El monto de la transacción pendiente es menor a cero (0)")
 		return
 	}
-	if transaction.Amount > float32(types.MaxTransactionAmount) {
+	if transaction.Amount.Cmp(types.MaxTransactionAmount) > 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "El monto de la transacción pendiente exede el máximo permitido")
 		return
@@ -85,10 +103,41 @@ func CreatePendingTransaction(w http.ResponseWriter, r *http.Request, _ httprout
 		fmt.Fprintf(w, "La transacción pendiente debe poseer un actor")
 		return
 	}
+	if transaction.Account.Id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción pendiente debe poseer una cuenta")
+		return
+	}
+	if message := checkDueDate(transaction.DueDate); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
 
 	db := database.ConnectDB()
 	defer db.Close()
 
+	message, err := ledger.CheckCurrency(db, transaction.Currency, transaction.Amount)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+	message, err = ledger.CheckCategory(db, transaction.Category.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
 	var actorId int
 	getActorIdQuery := fmt.Sprintf("SELECT id FROM actors WHERE id='%v';", transaction.Actor.Id)
 	actorIdRow, err := db.Query(getActorIdQuery)
@@ -110,8 +159,24 @@ func CreatePendingTransaction(w http.ResponseWriter, r *http.Request, _ httprout
 		return
 	}
 
+	accountCurrency, err := ledger.AccountCurrency(db, transaction.Account.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if accountCurrency == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta especificada no existe")
+		return
+	}
+	if accountCurrency != transaction.Currency {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La moneda de la transacción no coincide con la moneda de la cuenta")
+		return
+	}
+
 	var insertedId int
-	insertTransactionQuery := fmt.Sprintf("INSERT INTO pending_transactions(type, currency, amount, description, actor) VALUES ('%v', '%v', '%v', '%v', '%v') RETURNING id;", transaction.Type, transaction.Currency, transaction.Amount, transaction.Description, transaction.Actor.Id)
+	insertTransactionQuery := fmt.Sprintf("INSERT INTO pending_transactions(type, currency, amount, description, account, actor, category, due_date) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', %v, %v) RETURNING id;", transaction.Type, transaction.Currency, transaction.Amount, transaction.Description, transaction.Account.Id, transaction.Actor.Id, ledger.Nullable(transaction.Category.Id), ledger.Nullable(transaction.DueDate))
 
 	rowsInsertedId, err := db.Query(insertTransactionQuery)
 	if err != nil {
@@ -127,7 +192,7 @@ func CreatePendingTransaction(w http.ResponseWriter, r *http.Request, _ httprout
 	}
 
 	insertedTransaction := types.PendingTransaction{}
-	retrieveTransactionQuery := fmt.Sprintf("SELECT pending_transactions.id, pending_transactions.type, pending_transactions.currency, pending_transactions.amount, pending_transactions.description, pending_transactions.created_at, actors.id, actors.name FROM pending_transactions, actors WHERE pending_transactions.actor = actors.id AND pending_transactions.id = '%v';", insertedId)
+	retrieveTransactionQuery := fmt.Sprintf("%v WHERE pending_transactions.id = '%v';", ledger.SelectPendingTransactionsQuery, insertedId)
 	rowsRetrievedTransaction, err := db.Query(retrieveTransactionQuery)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -135,14 +200,21 @@ func CreatePendingTransaction(w http.ResponseWriter, r *http.Request, _ httprout
 	}
 	defer rowsRetrievedTransaction.Close()
 	for rowsRetrievedTransaction.Next() {
-		err = rowsRetrievedTransaction.Scan(&insertedTransaction.Id, &insertedTransaction.Type, &insertedTransaction.Currency, &insertedTransaction.Amount, &insertedTransaction.Description, &insertedTransaction.CreatedAt, &insertedTransaction.Actor.Id, &insertedTransaction.Actor.Name)
+		insertedTransaction, err = ledger.ScanPendingTransaction(rowsRetrievedTransaction)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
 	}
 
-	response, err := json.Marshal(insertedTransaction)
+	inserted := []types.PendingTransaction{insertedTransaction}
+	err = ledger.AttachSteps(db, inserted)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	response, err := json.Marshal(inserted[0])
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
@@ -185,12 +257,7 @@ func PatchPendingTransaction(w http.ResponseWriter, r *http.Request, ps httprout
 		fmt.Fprintf(w, "El tipo de la transacción debe ser 'input' o 'output'")
 		return
 	}
-	if newPendingTransaction.Currency != "USD" && newPendingTransaction.Currency != "VES" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Solo se aceptan monedas de tipo VES y USD")
-		return
-	}
-	if newPendingTransaction.Amount <= 0 || newPendingTransaction.Amount > float32(types.MaxTransactionAmount) {
+	if newPendingTransaction.Amount.Sign() <= 0 || newPendingTransaction.Amount.Cmp(types.MaxTransactionAmount) > 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "El monto de la transacción es muy bajo o muy alto")
 		return
@@ -200,10 +267,60 @@ func PatchPendingTransaction(w http.ResponseWriter, r *http.Request, ps httprout
 		fmt.Fprintf(w, "La transacción pendiente debe poseer un actor")
 		return
 	}
+	if newPendingTransaction.Account.Id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción pendiente debe poseer una cuenta")
+		return
+	}
+	if message := checkDueDate(newPendingTransaction.DueDate); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
 
 	db := database.ConnectDB()
 	defer db.Close()
 
+	var payableId int
+	var status string
+	err = db.QueryRow(fmt.Sprintf("SELECT COALESCE(payable, 0), status FROM pending_transactions WHERE id='%v';", pendingTransactionsId)).Scan(&payableId, &status)
+	if err != nil && err != sql.ErrNoRows {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if payableId != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción pendiente programa un pago de la cuenta por pagar %v, debe borrarla y programar el pago de nuevo", payableId)
+		return
+	}
+	// approvals are given to the amounts as they were sent
+	if status != "" && status != "draft" && status != "rejected" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Solo se pueden modificar transacciones pendientes en borrador o rechazadas")
+		return
+	}
+
+	message, err := ledger.CheckCurrency(db, newPendingTransaction.Currency, newPendingTransaction.Amount)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+	message, err = ledger.CheckCategory(db, newPendingTransaction.Category.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
 	var actorId int
 	getActorIdQuery := fmt.Sprintf("SELECT id FROM actors WHERE id = '%v';", newPendingTransaction.Actor.Id)
 	actorIdRow, err := db.Query(getActorIdQuery)
@@ -225,8 +342,24 @@ func PatchPendingTransaction(w http.ResponseWriter, r *http.Request, ps httprout
 		return
 	}
 
+	accountCurrency, err := ledger.AccountCurrency(db, newPendingTransaction.Account.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if accountCurrency == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta especificada no existe")
+		return
+	}
+	if accountCurrency != newPendingTransaction.Currency {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La moneda de la transacción no coincide con la moneda de la cuenta")
+		return
+	}
+
 	var updatedId int
-	updateQuery := fmt.Sprintf("UPDATE pending_transactions SET type='%v', currency='%v', amount='%v', description='%v', actor='%v' WHERE id='%v' RETURNING id;", newPendingTransaction.Type, newPendingTransaction.Currency, newPendingTransaction.Amount, newPendingTransaction.Description, newPendingTransaction.Actor.Id, pendingTransactionsId)
+	updateQuery := fmt.Sprintf("UPDATE pending_transactions SET type='%v', currency='%v', amount='%v', description='%v', account='%v', actor='%v', category=%v, due_date=%v WHERE id='%v' RETURNING id;", newPendingTransaction.Type, newPendingTransaction.Currency, newPendingTransaction.Amount, newPendingTransaction.Description, newPendingTransaction.Account.Id, newPendingTransaction.Actor.Id, ledger.Nullable(newPendingTransaction.Category.Id), ledger.Nullable(newPendingTransaction.DueDate), pendingTransactionsId)
 	rowsUpdatedId, err := db.Query(updateQuery)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -247,7 +380,7 @@ func PatchPendingTransaction(w http.ResponseWriter, r *http.Request, ps httprout
 	}
 
 	modifiedPendingTransaction := types.PendingTransaction{}
-	retrieveTransactionQuery := fmt.Sprintf("SELECT pending_transactions.id, pending_transactions.type, pending_transactions.Currency, pending_transactions.amount, pending_transactions.description, pending_transactions.created_at, actors.id, actors.name FROM pending_transactions, actors WHERE pending_transactions.actor = actors.id AND pending_transactions.id = '%v';", updatedId)
+	retrieveTransactionQuery := fmt.Sprintf("%v WHERE pending_transactions.id = '%v';", ledger.SelectPendingTransactionsQuery, updatedId)
 	rowsRetrievedTransaction, err := db.Query(retrieveTransactionQuery)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -255,14 +388,21 @@ func PatchPendingTransaction(w http.ResponseWriter, r *http.Request, ps httprout
 	}
 	defer rowsRetrievedTransaction.Close()
 	for rowsRetrievedTransaction.Next() {
-		err = rowsRetrievedTransaction.Scan(&modifiedPendingTransaction.Id, &modifiedPendingTransaction.Type, &modifiedPendingTransaction.Currency, &modifiedPendingTransaction.Amount, &modifiedPendingTransaction.Description, &modifiedPendingTransaction.CreatedAt, &modifiedPendingTransaction.Actor.Id, &modifiedPendingTransaction.Actor.Name)
+		modifiedPendingTransaction, err = ledger.ScanPendingTransaction(rowsRetrievedTransaction)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
 	}
 
-	response, err := json.Marshal(modifiedPendingTransaction)
+	modified := []types.PendingTransaction{modifiedPendingTransaction}
+	err = ledger.AttachSteps(db, modified)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	response, err := json.Marshal(modified[0])
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
@@ -320,6 +460,76 @@ func DeletePendingTransaction(w http.ResponseWriter, r *http.Request, ps httprou
 	w.Write(response)
 }
 
+// execute moves the approved pending transaction into the ledger inside tx,
+// which must hold the ledger lock, and records the employee who executed it.
+// It returns the id of the new ledger entry, or a message for
+// the client when the pending transaction can not be executed.
+func execute(tx *sql.Tx, id int, actorId int) (int, string, error) {
+	if id <= 1 {
+		return 0, "No puede modificar la transacción pendiente cero", nil
+	}
+	query := fmt.Sprintf("SELECT id, type, currency, amount, description, account, actor, COALESCE(settlement, 0), COALESCE(category, 0), COALESCE(payable, 0), status, created_at FROM pending_transactions WHERE id = '%v' FOR UPDATE;", id)
+	pendingTransaction := types.PendingTransaction{}
+	var settlementId int
+	err := tx.QueryRow(query).Scan(&pendingTransaction.Id, &pendingTransaction.Type, &pendingTransaction.Currency, &pendingTransaction.Amount, &pendingTransaction.Description, &pendingTransaction.Account.Id, &pendingTransaction.Actor.Id, &settlementId, &pendingTransaction.Category.Id, &pendingTransaction.Payable, &pendingTransaction.Status, &pendingTransaction.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, "", err
+	}
+	if pendingTransaction.Id == 0 {
+		return 0, fmt.Sprintf("La transacción pendiente con el id %v no existe", id), nil
+	}
+	if pendingTransaction.Status != "approved" {
+		return 0, fmt.Sprintf("La transacción pendiente de id %v no está aprobada", id), nil
+	}
+
+	lastCurrencyBalance, err := ledger.LastCurrencyBalance(tx, pendingTransaction.Currency)
+	if err != nil {
+		return 0, "", err
+	}
+	newCurrencyBalance := ledger.Apply(lastCurrencyBalance, pendingTransaction.Type, pendingTransaction.Amount)
+	if newCurrencyBalance.Cmp(types.MaxBalanceAmount) > 0 {
+		return 0, fmt.Sprintf("Su transacción pendiente de id %v no pudo ser ejecutada porque excede el balance máximo permitido", id), nil
+	}
+	if newCurrencyBalance.Sign() < 0 {
+		return 0, fmt.Sprintf("Su transacción pendiente de id %v no pudo ser ejecutada porque genera un balance menor a cero (0)", id), nil
+	}
+
+	lastAccountBalance, err := ledger.LastAccountBalance(tx, pendingTransaction.Account.Id)
+	if err != nil {
+		return 0, "", err
+	}
+	newAccountBalance := ledger.Apply(lastAccountBalance, pendingTransaction.Type, pendingTransaction.Amount)
+	if newAccountBalance.Sign() < 0 {
+		return 0, fmt.Sprintf("Su transacción pendiente de id %v no pudo ser ejecutada porque genera un balance menor a cero (0) en la cuenta", id), nil
+	}
+
+	var insertedTransactionId int
+	insertTransactionQuery := fmt.Sprintf("INSERT INTO transactions_with_balances(type, currency, amount, description, currency_balance, account, balance, actor, settlement, category, payable, created_at) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', %v, %v, %v, '%v') RETURNING id;", pendingTransaction.Type, pendingTransaction.Currency, pendingTransaction.Amount, pendingTransaction.Description, newCurrencyBalance, pendingTransaction.Account.Id, newAccountBalance, pendingTransaction.Actor.Id, ledger.Nullable(settlementId), ledger.Nullable(pendingTransaction.Category.Id), ledger.Nullable(pendingTransaction.Payable), pendingTransaction.CreatedAt)
+	err = tx.QueryRow(insertTransactionQuery).Scan(&insertedTransactionId)
+	if err != nil {
+		if err.Error() == `pq: new row for relation "transactions_with_balances" violates check constraint "transactions_with_balances_currency_balance_check"` {
+			return 0, fmt.Sprintf("Su transacción pendiente de id %v no pudo ser ejecutada porque genera un balance menor a cero (0)", id), nil
+		}
+		return 0, "", err
+	}
+
+	// the history follows the transaction into the ledger
+	_, err = tx.Exec(fmt.Sprintf("UPDATE pending_transaction_steps SET pending_transaction=NULL, transaction='%v' WHERE pending_transaction='%v';", insertedTransactionId, id))
+	if err != nil {
+		return 0, "", err
+	}
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO pending_transaction_steps (transaction, status, actor) VALUES ('%v', 'executed', '%v');", insertedTransactionId, actorId))
+	if err != nil {
+		return 0, "", err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM pending_transactions WHERE id='%v';", id))
+	if err != nil {
+		return 0, "", err
+	}
+	return insertedTransactionId, "", nil
+}
+
 func ExecutePendingTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	requestedId := ps.ByName("id")
 	if requestedId == "" {
@@ -327,6 +537,12 @@ func ExecutePendingTransaction(w http.ResponseWriter, r *http.Request, ps httpro
 		fmt.Fprintf(w, "Debe especificar el parametro id en la petición de borrado")
 		return
 	}
+	// httprouter can not register /pending_transactions/execute next to the
+	// id wildcard, so the batch execution is dispatched from here
+	if requestedId == "execute" {
+		ExecutePendingTransactions(w, r, ps)
+		return
+	}
 	id, err := strconv.Atoi(requestedId)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -337,132 +553,314 @@ func ExecutePendingTransaction(w http.ResponseWriter, r *http.Request, ps httpro
 		fmt.Fprintf(w, "No puede modificar la transacción pendiente cero")
 		return
 	}
+	// the body says which employee executes the transaction
+	step := types.PendingStep{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &step)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con un paso de la transacción pendiente")
+		return
+	}
+	if step.Actor.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Debe especificar el empleado que ejecuta la transacción pendiente")
+		return
+	}
 	db := database.ConnectDB()
 	defer db.Close()
-	query := fmt.Sprintf("SELECT * FROM pending_transactions WHERE id = '%v';", requestedId)
-	rows, err := db.Query(query)
+
+	message, err := checkStepActor(db, step.Actor.Id)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	pendingTransaction := types.PendingTransaction{}
-	for rows.Next() {
-		err = rows.Scan(&pendingTransaction.Id, &pendingTransaction.Type, &pendingTransaction.Currency, &pendingTransaction.Amount, &pendingTransaction.Description, &pendingTransaction.Actor.Id, &pendingTransaction.CreatedAt)
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	tx, err := ledger.Begin(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
+
+	insertedTransactionId, message, err := execute(tx, id, step.Actor.Id)
+	if err != nil || message != "" {
+		if discardErr := ledger.Discard(tx); discardErr != nil {
+			utils.SendInternalServerError(discardErr, w)
+			return
+		}
+	}
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	insertedTransaction := types.TransactionWithBalance{}
+	retrieveTransactionQuery := fmt.Sprintf("%v WHERE transactions_with_balances.id = '%v';", ledger.SelectTransactionsQuery, insertedTransactionId)
+	rowsRetrievedTransaction, err := db.Query(retrieveTransactionQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsRetrievedTransaction.Close()
+	for rowsRetrievedTransaction.Next() {
+		insertedTransaction, err = ledger.ScanTransaction(rowsRetrievedTransaction)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
 	}
-	if pendingTransaction.Id == 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "La transacción pendiente con el id %v no existe", requestedId)
+
+	response, err := json.Marshal(insertedTransaction)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
 
-	var lastUSDBalance float32
-	var lastVESBalance float32
-	getLastBalanceQuery := "SELECT USD_balance, VES_balance FROM transactions_with_balances ORDER BY id desc LIMIT 1;"
-	lastTransactionRow, err := db.Query(getLastBalanceQuery)
+func GetLastTransactionId(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	lastPendingTransactionsId := types.IdResponse{
+		Id: -1,
+	}
+	db := database.ConnectDB()
+	defer db.Close()
+	query := "SELECT id FROM pending_transactions ORDER BY id DESC LIMIT 1;"
+	rows, err := db.Query(query)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer lastTransactionRow.Close()
-	for lastTransactionRow.Next() {
-		if err := lastTransactionRow.Scan(&lastUSDBalance, &lastVESBalance); err != nil {
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&lastPendingTransactionsId.Id); err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
 	}
-	newUSDBalance := lastUSDBalance
-	newVESBalance := lastVESBalance
 
-	if pendingTransaction.Currency == "USD" {
-		if pendingTransaction.Type == "input" {
-			newUSDBalance = lastUSDBalance + pendingTransaction.Amount
-			if newUSDBalance > float32(types.MaxBalanceAmount) {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "Su transacción no pudo ser ejecutada porque excede el balance máximo permitido")
-				return
-			}
-		} 
+	if lastPendingTransactionsId.Id == -1 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No existen más transacciones")
+		return
+	}
 
-		if pendingTransaction.Type == "output" {
-			newUSDBalance = lastUSDBalance - pendingTransaction.Amount
-			if newUSDBalance < 0 {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "Su transacción pendiente de id %v no pudo ser ejecutada porque genera un balance menor a cero (0)", requestedId)
-				return
-			}
+	w.Header().Set("Content-Type", "application/json")
+	response, err := json.Marshal(lastPendingTransactionsId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Write(response)
+}
+
+// ExecutePendingTransactions executes the requested pending transactions in
+// order inside a single DB transaction, so either all of them reach the
+// ledger or none does. The first one that can not be executed is reported
+// along with its position in the batch. A dry run returns the resulting
+// entries, without ids, and balances without committing them.
+func ExecutePendingTransactions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	batch := types.BatchExecution{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &batch)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con una lista de transacciones pendientes")
+		return
+	}
+	if len(batch.Ids) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Debe especificar al menos una transacción pendiente")
+		return
+	}
+	listed := map[int]bool{}
+	for _, id := range batch.Ids {
+		if listed[id] {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La transacción pendiente %v está repetida en la lista", id)
+			return
 		}
+		listed[id] = true
 	}
 
-	if pendingTransaction.Currency == "VES" {
-		if pendingTransaction.Type == "input" {
-			newVESBalance = lastVESBalance + pendingTransaction.Amount
-			if newVESBalance > float32(types.MaxBalanceAmount) {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "Su transacción no pudo ser ejecutada porque excede el balance máximo permitido")
-				return
-			}
-		} 
+	if batch.Actor.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Debe especificar el empleado que ejecuta las transacciones pendientes")
+		return
+	}
 
-		if pendingTransaction.Type == "output" {
-			newVESBalance = lastVESBalance - pendingTransaction.Amount
-			if newVESBalance < 0 {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "Su transacción pendiente de id %v no pudo ser ejecutada porque genera un balance menor a cero (0)", requestedId)
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := checkStepActor(db, batch.Actor.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	tx, err := ledger.Begin(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
+
+	insertedIds := []string{}
+	for i, id := range batch.Ids {
+		insertedTransactionId, message, err := execute(tx, id, batch.Actor.Id)
+		if err != nil || message != "" {
+			if discardErr := ledger.Discard(tx); discardErr != nil {
+				utils.SendInternalServerError(discardErr, w)
 				return
 			}
 		}
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		if message != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "No se ejecutó ninguna transacción, la número %v de la lista falló: %v", i+1, message)
+			return
+		}
+		insertedIds = append(insertedIds, fmt.Sprintf("'%v'", insertedTransactionId))
 	}
 
-	var insertedTransactionId int
-	insertTransactionQuery := fmt.Sprintf("INSERT INTO transactions_with_balances(type, currency, amount, description, USD_balance, VES_balance, actor, created_at) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", pendingTransaction.Type, pendingTransaction.Currency, pendingTransaction.Amount, pendingTransaction.Description, newUSDBalance, newVESBalance, pendingTransaction.Actor.Id, pendingTransaction.CreatedAt)
-
-	rowsId, err := db.Query(insertTransactionQuery)
+	result := types.BatchResult{DryRun: batch.DryRun, Transactions: []types.TransactionWithBalance{}}
+	rows, err := tx.Query(fmt.Sprintf("%v WHERE transactions_with_balances.id IN (%v) ORDER BY transactions_with_balances.id;", ledger.SelectTransactionsQuery, strings.Join(insertedIds, ", ")))
 	if err != nil {
-		if err.Error() == `pq: new row for relation "transactions_with_balances" violates check constraint "transactions_with_balances_usd_balance_check"` {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Su transacción pendiente de id %v no pudo ser ejecutada porque genera un balance menor a cero (0)", requestedId)
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	for rows.Next() {
+		transaction, err := ledger.ScanTransaction(rows)
+		if err != nil {
+			rows.Close()
+			utils.SendInternalServerError(err, w)
 			return
 		}
+		result.Transactions = append(result.Transactions, transaction)
+	}
+	rows.Close()
+	result.Balances, err = ledger.CurrentBalances(tx)
+	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rowsId.Close()
 
-	for rowsId.Next() {
-		if err := rowsId.Scan(&insertedTransactionId); err != nil {
-			utils.SendInternalServerError(err, w)
-			return
+	if batch.DryRun {
+		// the entries of a dry run are never stored, so they have no id
+		for i := range result.Transactions {
+			result.Transactions[i].Id = 0
 		}
+		err = ledger.Discard(tx)
+	} else {
+		err = tx.Commit()
+	}
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
 	}
 
-	deleteQuery := fmt.Sprintf("DELETE FROM pending_transactions WHERE id='%v' RETURNING id;", requestedId)
-	_, err = db.Query(deleteQuery)
+	response, err := json.Marshal(result)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
 
-	insertedTransaction := types.TransactionWithBalance{}
-	retrieveTransactionQuery := fmt.Sprintf("SELECT transactions_with_balances.id, transactions_with_balances.type, transactions_with_balances.currency, transactions_with_balances.amount, transactions_with_balances.description, transactions_with_balances.USD_balance, transactions_with_balances.VES_balance, transactions_with_balances.executed, transactions_with_balances.created_at, actors.id, actors.name FROM transactions_with_balances, actors WHERE transactions_with_balances.actor = actors.id AND transactions_with_balances.id = '%v';", insertedTransactionId)
-	rowsRetrievedTransaction, err := db.Query(retrieveTransactionQuery)
+// GetCalendar groups the pending transactions that were not rejected by due
+// date, the from and to parameters limit the range and leave out the ones
+// without a due date, which otherwise come last
+func GetCalendar(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	conditions := []string{"pending_transactions.id > 1", "pending_transactions.status <> 'rejected'"}
+	if from := query.Get("from"); from != "" {
+		if _, err := time.Parse(types.DateFormat, from); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La fecha inicial no tiene un formato válido")
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("pending_transactions.due_date >= '%v'", from))
+	}
+	if to := query.Get("to"); to != "" {
+		if _, err := time.Parse(types.DateFormat, to); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La fecha final no tiene un formato válido")
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("pending_transactions.due_date <= '%v'", to))
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	pending := []types.PendingTransaction{}
+	rows, err := db.Query(fmt.Sprintf("%v WHERE %v ORDER BY pending_transactions.due_date NULLS LAST, pending_transactions.id;", ledger.SelectPendingTransactionsQuery, strings.Join(conditions, " AND ")))
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rowsRetrievedTransaction.Close()
-	for rowsRetrievedTransaction.Next() {
-		err = rowsRetrievedTransaction.Scan(&insertedTransaction.Id, &insertedTransaction.Type, &insertedTransaction.Currency, &insertedTransaction.Amount, &insertedTransaction.Description, &insertedTransaction.USDBalance, &insertedTransaction.VESBalance, &insertedTransaction.Executed, &insertedTransaction.CreatedAt, &insertedTransaction.Actor.Id, &insertedTransaction.Actor.Name)
+	defer rows.Close()
+	for rows.Next() {
+		transaction, err := ledger.ScanPendingTransaction(rows)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
+		pending = append(pending, transaction)
+	}
+	err = ledger.AttachSteps(db, pending)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
 	}
 
-	response, err := json.Marshal(insertedTransaction)
+	calendar := []types.CalendarDay{}
+	for _, transaction := range pending {
+		last := len(calendar) - 1
+		if last < 0 || calendar[last].Date != transaction.DueDate {
+			calendar = append(calendar, types.CalendarDay{Date: transaction.DueDate, Transactions: []types.PendingTransaction{}})
+			last++
+		}
+		calendar[last].Transactions = append(calendar[last].Transactions, transaction)
+	}
+
+	response, err := json.Marshal(calendar)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
@@ -471,37 +869,298 @@ func ExecutePendingTransaction(w http.ResponseWriter, r *http.Request, ps httpro
 	w.Write(response)
 }
 
-func GetLastTransactionId(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	lastPendingTransactionsId := types.IdResponse{
-		Id: -1,
+// project applies the pending transactions, sorted by due date, on top of
+// the current balances. Every day holds the balances once all of its
+// transactions are executed and a currency is short on the first day it
+// ends below zero.
+func project(current []types.CurrencyBalance, pending []types.PendingTransaction) types.Projection {
+	projection := types.Projection{Current: current, Days: []types.ProjectedDay{}, Shortfalls: []types.Shortfall{}}
+	balances := make([]types.CurrencyBalance, len(current))
+	copy(balances, current)
+	for _, transaction := range pending {
+		last := len(projection.Days) - 1
+		if last < 0 || projection.Days[last].Date != transaction.DueDate {
+			projection.Days = append(projection.Days, types.ProjectedDay{Date: transaction.DueDate, Transactions: []types.PendingTransaction{}})
+			last++
+		}
+		for i := range balances {
+			if balances[i].Currency == transaction.Currency {
+				balances[i].Balance = ledger.Apply(balances[i].Balance, transaction.Type, transaction.Amount)
+			}
+		}
+		day := &projection.Days[last]
+		day.Transactions = append(day.Transactions, transaction)
+		day.Balances = append([]types.CurrencyBalance{}, balances...)
 	}
+
+	short := map[string]bool{}
+	for _, day := range projection.Days {
+		for _, balance := range day.Balances {
+			if balance.Balance.Sign() < 0 && !short[balance.Currency] {
+				short[balance.Currency] = true
+				projection.Shortfalls = append(projection.Shortfalls, types.Shortfall{Currency: balance.Currency, Date: day.Date, Balance: balance.Balance})
+			}
+		}
+	}
+	return projection
+}
+
+// GetProjection projects the balance of every currency through the pending
+// transactions with a due date, up to the to parameter when it is given.
+// Overdue transactions are projected on their own due date. Rejected ones
+// will not be executed and are left out, drafts are kept because recurring
+// templates create their transactions as drafts.
+func GetProjection(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	conditions := []string{"pending_transactions.id > 1", "pending_transactions.due_date IS NOT NULL", "pending_transactions.status <> 'rejected'"}
+	if to := r.URL.Query().Get("to"); to != "" {
+		if _, err := time.Parse(types.DateFormat, to); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La fecha final no tiene un formato válido")
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("pending_transactions.due_date <= '%v'", to))
+	}
+
 	db := database.ConnectDB()
 	defer db.Close()
-	query := "SELECT id FROM pending_transactions ORDER BY id DESC LIMIT 1;"
-	rows, err := db.Query(query)
+
+	current, err := ledger.CurrentBalances(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	pending := []types.PendingTransaction{}
+	rows, err := db.Query(fmt.Sprintf("%v WHERE %v ORDER BY pending_transactions.due_date, pending_transactions.id;", ledger.SelectPendingTransactionsQuery, strings.Join(conditions, " AND ")))
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
-		if err := rows.Scan(&lastPendingTransactionsId.Id); err != nil {
+		transaction, err := ledger.ScanPendingTransaction(rows)
+		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
+		pending = append(pending, transaction)
+	}
+	err = ledger.AttachSteps(db, pending)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
 	}
 
-	if lastPendingTransactionsId.Id == -1 {
+	response, err := json.Marshal(project(current, pending))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// checkStepActor validates that the actor who signs a step is a member of
+// the personnel, it returns a message for the client when it is not
+func checkStepActor(q rowQuerier, actorId int) (string, error) {
+	var actorType string
+	err := q.QueryRow(fmt.Sprintf("SELECT type FROM actors WHERE id='%v';", actorId)).Scan(&actorType)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if actorType == "" {
+		return "El actor especificado no existe", nil
+	}
+	if actorType != "personnel" {
+		return "Solo un empleado puede enviar, aprobar, rechazar o ejecutar una transacción pendiente", nil
+	}
+	return "", nil
+}
+
+// requiredApprovals returns two when the amount is worth more USD than the
+// approval threshold, amounts of currencies without a rate in force are
+// taken as above it
+func requiredApprovals(tx *sql.Tx, currency string, amount money.Money) (int, error) {
+	config, err := settings.Load(tx)
+	if err != nil {
+		return 0, err
+	}
+	value, found, err := rates.ToUSD(tx, currency, amount, time.Now().Local().Format(types.DateFormat))
+	if err != nil {
+		return 0, err
+	}
+	if !found || value.Cmp(config.ApprovalThreshold) > 0 {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+// changeStatus records the step of the actor in the history of the pending
+// transaction and moves it to its new status. A pending transaction can be
+// submitted from draft or rejected, approved or rejected once submitted and
+// rejected while approved. Approvals are counted since the last submission
+// and every employee approves once.
+func changeStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params, status string) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "No existen más transacciones")
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if id <= 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No puede modificar la transacción pendiente cero")
+		return
+	}
+	step := types.PendingStep{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &step)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con un paso de la transacción pendiente")
+		return
+	}
+	if step.Actor.Id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Debe especificar el empleado que realiza el paso")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	response, err := json.Marshal(lastPendingTransactionsId)
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := checkStepActor(db, step.Actor.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
+	defer tx.Rollback()
+
+	var currentStatus string
+	var currency string
+	var amount money.Money
+	err = tx.QueryRow(fmt.Sprintf("SELECT status, currency, amount FROM pending_transactions WHERE id='%v' FOR UPDATE;", id)).Scan(&currentStatus, &currency, &amount)
+	if err != nil && err != sql.ErrNoRows {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if currentStatus == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción pendiente con el id %v no existe", id)
+		return
+	}
+
+	newStatus := status
+	switch status {
+	case "submitted":
+		if currentStatus != "draft" && currentStatus != "rejected" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Solo se pueden enviar a aprobación transacciones pendientes en borrador o rechazadas")
+			return
+		}
+	case "approved":
+		if currentStatus != "submitted" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Solo se pueden aprobar transacciones pendientes enviadas a aprobación")
+			return
+		}
+		var approvals int
+		var approvedBefore bool
+		approvalsQuery := fmt.Sprintf("SELECT COUNT(*), COALESCE(BOOL_OR(actor = '%v'), FALSE) FROM pending_transaction_steps WHERE pending_transaction='%v' AND status='approved' AND id > (SELECT MAX(id) FROM pending_transaction_steps WHERE pending_transaction='%v' AND status='submitted');", step.Actor.Id, id, id)
+		err = tx.QueryRow(approvalsQuery).Scan(&approvals, &approvedBefore)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		if approvedBefore {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "El empleado ya aprobó la transacción pendiente")
+			return
+		}
+		required, err := requiredApprovals(tx, currency, amount)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		if approvals+1 < required {
+			newStatus = "submitted"
+		}
+	case "rejected":
+		if currentStatus != "submitted" && currentStatus != "approved" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Solo se pueden rechazar transacciones pendientes enviadas a aprobación o aprobadas")
+			return
+		}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO pending_transaction_steps (pending_transaction, status, actor, notes) VALUES ('%v', '%v', '%v', '%v');", id, status, step.Actor.Id, step.Notes))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	_, err = tx.Exec(fmt.Sprintf("UPDATE pending_transactions SET status='%v' WHERE id='%v';", newStatus, id))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	transactions := []types.PendingTransaction{}
+	transaction, err := ledger.ScanPendingTransaction(db.QueryRow(fmt.Sprintf("%v WHERE pending_transactions.id = '%v';", ledger.SelectPendingTransactionsQuery, id)))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	transactions = append(transactions, transaction)
+	err = ledger.AttachSteps(db, transactions)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	response, err := json.Marshal(transactions[0])
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(response)
 }
+
+func SubmitPendingTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	changeStatus(w, r, ps, "submitted")
+}
+
+// ApprovePendingTransaction records an approval, the transaction becomes
+// approved once it has as many as the approval threshold requires
+func ApprovePendingTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	changeStatus(w, r, ps, "approved")
+}
+
+func RejectPendingTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	changeStatus(w, r, ps, "rejected")
+}
@@ -9,7 +9,13 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"example.com/backend_gandola_soft/actors"
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/transactions"
 	"example.com/backend_gandola_soft/types"
 	"github.com/julienschmidt/httprouter"
 )
@@ -52,7 +58,7 @@ func TestCreatePendingTransaction(t *testing.T) {
 
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(5)
+	transactionAmount := money.MustParse("5")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -60,6 +66,7 @@ func TestCreatePendingTransaction(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -92,7 +99,7 @@ func TestCreatePendingTransaction(t *testing.T) {
 	if transactionResponse.Type != "input" {
 		t.Errorf("transactionResponse.Type = %v, want %v", transactionResponse.Type, transactionType)
 	}
-	if transactionResponse.Amount != 5 {
+	if !transactionResponse.Amount.Equal(transactionAmount) {
 		t.Errorf("transactionResponse.Amount = %v, want %v", transactionResponse.Amount, transactionAmount)
 	}
 	if transactionResponse.Description != "abc" {
@@ -106,7 +113,7 @@ func TestCreateTransactionWithoutType(t *testing.T) {
 
 	transactionType := ""
 	transactionCurrency := "USD"
-	transactionAmount := float32(5)
+	transactionAmount := money.MustParse("5")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -114,6 +121,7 @@ func TestCreateTransactionWithoutType(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -150,7 +158,7 @@ func TestCreatePendingTransactionWithWrongType(t *testing.T) {
 
 	transactionType := "noType"
 	transactionCurrency := "USD"
-	transactionAmount := float32(5)
+	transactionAmount := money.MustParse("5")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -158,6 +166,7 @@ func TestCreatePendingTransactionWithWrongType(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -194,7 +203,7 @@ func TestCreatePendingTransactionWithoutAmount(t *testing.T) {
 
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(0)
+	transactionAmount := money.MustParse("0")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -202,6 +211,7 @@ func TestCreatePendingTransactionWithoutAmount(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -238,7 +248,7 @@ func TestCreatePendingTransactionMoreThanMaximum(t *testing.T) {
 
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(1e15)
+	transactionAmount := money.MustParse("1000000000000000")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -246,6 +256,7 @@ func TestCreatePendingTransactionMoreThanMaximum(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -282,7 +293,7 @@ func TestCreatePendingTransactionWithoutDescription(t *testing.T) {
 
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(5)
+	transactionAmount := money.MustParse("5")
 	transactionDescription := ""
 	bodyString := fmt.Sprintf(`
 	{
@@ -290,6 +301,7 @@ func TestCreatePendingTransactionWithoutDescription(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -326,7 +338,7 @@ func TestCreatePendingTransactionWithBadJson(t *testing.T) {
 
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(5)
+	transactionAmount := money.MustParse("5")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -334,6 +346,7 @@ func TestCreatePendingTransactionWithBadJson(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		},
@@ -370,7 +383,7 @@ func TestCreatePendingTransactionWithNonExistingActor(t *testing.T) {
 
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(5)
+	transactionAmount := money.MustParse("5")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -378,6 +391,7 @@ func TestCreatePendingTransactionWithNonExistingActor(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 9999
 		}
@@ -414,7 +428,7 @@ func TestCreatePendingTransactionWrongCurrency(t *testing.T) {
 
 	transactionType := "input"
 	transactionCurrency := "wrong"
-	transactionAmount := float32(5)
+	transactionAmount := money.MustParse("5")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -422,6 +436,7 @@ func TestCreatePendingTransactionWrongCurrency(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -446,7 +461,7 @@ func TestCreatePendingTransactionWrongCurrency(t *testing.T) {
 		log.Fatal(err)
 		t.Error("Could not read body of response")
 	}
-	errMessage := "Solo se aceptan monedas de tipo VES y USD"
+	errMessage := "La moneda wrong no está registrada"
 	if string(body) != errMessage {
 		t.Errorf("response = %v, want %v", string(body), errMessage)
 	}
@@ -486,7 +501,7 @@ func TestPatchPendingTransaction(t *testing.T) {
 	id := lastId.Id
 	transactionType := "output"
 	transactionCurrency := "USD"
-	amount := float32(5)
+	amount := money.MustParse("5")
 	description := "patch pending transaction test"
 	bodyString := fmt.Sprintf(`
 		{
@@ -494,6 +509,7 @@ func TestPatchPendingTransaction(t *testing.T) {
 			"Currency": "%v",
 			"Amount": %v,
 			"Description": "%v",
+			"Account": {"Id": 1},
 			"Actor": {
 				"Id": 1
 			}
@@ -533,7 +549,7 @@ func TestPatchPendingTransaction(t *testing.T) {
 		t.Errorf("pendingTransactionResponse.Type = %v, want %v", pendingTransactionResponse.Type, transactionType)
 	}
 
-	if pendingTransactionResponse.Amount != amount {
+	if !pendingTransactionResponse.Amount.Equal(amount) {
 		t.Errorf("pendingTransactionResponse.Amount = %v, want %v", pendingTransactionResponse.Amount, amount)
 	}
 
@@ -576,7 +592,7 @@ func TestPatchPendingTransactionEmptyDescription(t *testing.T) {
 	id := lastId.Id
 	transactionType := "output"
 	transactionCurrency := "USD"
-	amount := float32(5)
+	amount := money.MustParse("5")
 	description := ""
 	bodyString := fmt.Sprintf(`
 		{
@@ -584,6 +600,7 @@ func TestPatchPendingTransactionEmptyDescription(t *testing.T) {
 			"Currency": "%v",
 			"Amount": %v,
 			"Description": "%v",
+			"Account": {"Id": 1},
 			"Actor": {
 				"Id": 1
 			}
@@ -651,7 +668,7 @@ func TestPatchPendingTransactionBadType(t *testing.T) {
 	id := lastId.Id
 	transactionType := "noType"
 	transactionCurrency := "USD"
-	amount := float32(5)
+	amount := money.MustParse("5")
 	description := "bad type"
 	bodyString := fmt.Sprintf(`
 		{
@@ -659,6 +676,7 @@ func TestPatchPendingTransactionBadType(t *testing.T) {
 			"Currency": "%v",
 			"Amount": %v,
 			"Description": "%v",
+			"Account": {"Id": 1},
 			"Actor": {
 				"Id": 1
 			}
@@ -726,7 +744,7 @@ func TestPatchPendingTransactionAmountZeroOrLess(t *testing.T) {
 	id := lastId.Id
 	transactionType := "input"
 	transactionCurrency := "USD"
-	amount := float32(0)
+	amount := money.MustParse("0")
 	description := "amount zero"
 	bodyString := fmt.Sprintf(`
 		{
@@ -734,6 +752,7 @@ func TestPatchPendingTransactionAmountZeroOrLess(t *testing.T) {
 			"Currency": "%v",
 			"Amount": %v,
 			"Description": "%v",
+			"Account": {"Id": 1},
 			"Actor": {
 				"Id": 1
 			}
@@ -774,7 +793,7 @@ func TestPatchPendingTransactionZero(t *testing.T) {
 	id := 1
 	transactionType := "output"
 	transactionCurrency := "USD"
-	amount := float32(5)
+	amount := money.MustParse("5")
 	description := "patching transaction zero"
 	bodyString := fmt.Sprintf(`
 		{
@@ -782,6 +801,7 @@ func TestPatchPendingTransactionZero(t *testing.T) {
 			"Currency": "%v",
 			"Amount": %v,
 			"Description": "%v",
+			"Account": {"Id": 1},
 			"Actor": {
 				"Id": 1
 			}
@@ -822,7 +842,7 @@ func TestPatchPendingTransactionBadJson(t *testing.T) {
 	id := 2
 	transactionType := "output"
 	transactionCurrency := "USD"
-	amount := float32(5)
+	amount := money.MustParse("5")
 	description := "patching transaction zero"
 	bodyString := fmt.Sprintf(`
 		{
@@ -830,6 +850,7 @@ func TestPatchPendingTransactionBadJson(t *testing.T) {
 			"Currency": "%v",
 			"Amount": %v,
 			"Description": "%v",
+			"Account": {"Id": 1},
 			"Actor": {
 				"Id": 1
 			},
@@ -870,7 +891,7 @@ func TestPatchPendingTransactionNonExistingId(t *testing.T) {
 	id := 9999999
 	transactionType := "output"
 	transactionCurrency := "USD"
-	amount := float32(5)
+	amount := money.MustParse("5")
 	description := "non existing id"
 	bodyString := fmt.Sprintf(`
 		{
@@ -878,6 +899,7 @@ func TestPatchPendingTransactionNonExistingId(t *testing.T) {
 			"Currency": "%v",
 			"Amount": %v,
 			"Description": "%v",
+			"Account": {"Id": 1},
 			"Actor": {
 				"Id": 1
 			}
@@ -918,7 +940,7 @@ func TestPatchPendingTransactionNonExistingActor(t *testing.T) {
 	id := 9999999
 	transactionType := "output"
 	transactionCurrency := "USD"
-	amount := float32(5)
+	amount := money.MustParse("5")
 	description := "non existing id"
 	bodyString := fmt.Sprintf(`
 		{
@@ -926,6 +948,7 @@ func TestPatchPendingTransactionNonExistingActor(t *testing.T) {
 			"Currency": "%v",
 			"Amount": %v,
 			"Description": "%v",
+			"Account": {"Id": 1},
 			"Actor": {
 				"Id": 9999
 			}
@@ -966,7 +989,7 @@ func TestPatchPendingTransactionWrongCurrency(t *testing.T) {
 	id := 9999999
 	transactionType := "output"
 	transactionCurrency := "wrong"
-	amount := float32(5)
+	amount := money.MustParse("5")
 	description := "non existing id"
 	bodyString := fmt.Sprintf(`
 		{
@@ -974,6 +997,7 @@ func TestPatchPendingTransactionWrongCurrency(t *testing.T) {
 			"Currency": "%v",
 			"Amount": %v,
 			"Description": "%v",
+			"Account": {"Id": 1},
 			"Actor": {
 				"Id": 1
 			}
@@ -1000,7 +1024,7 @@ func TestPatchPendingTransactionWrongCurrency(t *testing.T) {
 		log.Fatal(err)
 		t.Error("Could not read body of response")
 	}
-	expected := "Solo se aceptan monedas de tipo VES y USD"
+	expected := "La moneda wrong no está registrada"
 
 	if string(body) != expected {
 		t.Errorf("body = %v, want %v", string(body), expected)
@@ -1196,7 +1220,7 @@ func TestExecutePendingTransaction(t *testing.T) {
 
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(42)
+	transactionAmount := money.MustParse("42")
 	transactionDescription := "pending transaction for make execution"
 	bodyString := fmt.Sprintf(`
 	{
@@ -1204,6 +1228,7 @@ func TestExecutePendingTransaction(t *testing.T) {
 		"Currency": "%v",
 		"Amount": %v,
 		"Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -1236,9 +1261,11 @@ func TestExecutePendingTransaction(t *testing.T) {
 
 	router.PUT("/pending_transactions/:id", ExecutePendingTransaction)
 	id := transactionResponse.Id
+	approver := createApprover(t, router)
+	approve(t, router, id, approver)
 
 	urlRequest := fmt.Sprintf("/pending_transactions/%v", id)
-	req2, err := http.NewRequest("PUT", urlRequest, nil)
+	req2, err := http.NewRequest("PUT", urlRequest, strings.NewReader(fmt.Sprintf(`{"Actor": {"Id": %v}}`, approver)))
 	if err != nil {
 		log.Fatal(err)
 		t.Error("Could not make a put request to /pending_transactions/:id")
@@ -1294,3 +1321,612 @@ func TestExecutePendingTransaction(t *testing.T) {
 		t.Errorf("lastIdAfterExecution = %v, lastIdBeforeExecution = %v", lastIdAfterExecution.Id, transactionResponse.Id)
 	}
 }
+
+func TestCreatePendingTransactionWithDueDate(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.GET("/pending_transactions/calendar", GetCalendar)
+
+	newTransaction := types.PendingTransaction{Type: "output", Currency: "USD", Amount: money.MustParse("5"), Description: "scheduled", DueDate: "2031-01-15"}
+	newTransaction.Account.Id = 1
+	newTransaction.Actor.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/pending_transactions", newTransaction)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdTransaction := types.PendingTransaction{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdTransaction)
+	if err != nil {
+		t.Fatal("Response body does not contain a PendingTransaction type")
+	}
+	if createdTransaction.DueDate != "2031-01-15" {
+		t.Errorf("DueDate = %v, want 2031-01-15", createdTransaction.DueDate)
+	}
+
+	t.Log("testing the transaction is listed on its due date")
+	rr = testutils.MakeRequest(t, router, "GET", "/pending_transactions/calendar?from=2031-01-15&to=2031-01-15", nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	calendar := []types.CalendarDay{}
+	err = json.Unmarshal(rr.Body.Bytes(), &calendar)
+	if err != nil {
+		t.Fatal("Response body does not contain an array of type CalendarDay")
+	}
+	if len(calendar) != 1 || calendar[0].Date != "2031-01-15" {
+		t.Fatalf("calendar = %v, want a single day on 2031-01-15", calendar)
+	}
+	listed := false
+	for _, transaction := range calendar[0].Transactions {
+		listed = listed || transaction.Id == createdTransaction.Id
+	}
+	if !listed {
+		t.Errorf("transaction %v is not listed on its due date", createdTransaction.Id)
+	}
+}
+
+func TestCreatePendingTransactionWithBadDueDate(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+
+	newTransaction := types.PendingTransaction{Type: "output", Currency: "USD", Amount: money.MustParse("5"), Description: "scheduled", DueDate: "15/01/2031"}
+	newTransaction.Account.Id = 1
+	newTransaction.Actor.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/pending_transactions", newTransaction)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La fecha de vencimiento no tiene un formato válido"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestGetProjection(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/pending_transactions/projection", GetProjection)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/pending_transactions/projection", nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	projection := types.Projection{}
+	err := json.Unmarshal(rr.Body.Bytes(), &projection)
+	if err != nil {
+		t.Fatal("Response body does not contain a Projection type")
+	}
+	if len(projection.Current) == 0 {
+		t.Error("projection does not start from the current balances")
+	}
+}
+
+func TestRejectedLeftOutOfProjection(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.PUT("/pending_transactions/:id/submit", SubmitPendingTransaction)
+	router.PUT("/pending_transactions/:id/reject", RejectPendingTransaction)
+	router.GET("/pending_transactions/projection", GetProjection)
+	router.GET("/pending_transactions/calendar", GetCalendar)
+
+	newTransaction := types.PendingTransaction{Type: "output", Currency: "USD", Amount: money.MustParse("5"), Description: "scheduled", DueDate: "2099-01-01"}
+	newTransaction.Account.Id = 1
+	newTransaction.Actor.Id = 1
+	transaction := createPendingTransaction(t, router, newTransaction)
+	step := types.PendingStep{}
+	step.Actor.Id = createApprover(t, router)
+	for _, action := range []string{"submit", "reject"} {
+		rr := testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v/%v", transaction.Id, action), step)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+		}
+	}
+
+	t.Log("testing the rejected transaction is not projected")
+	rr := testutils.MakeRequest(t, router, "GET", "/pending_transactions/projection", nil)
+	projection := types.Projection{}
+	err := json.Unmarshal(rr.Body.Bytes(), &projection)
+	if err != nil {
+		t.Fatal("Response body does not contain a Projection type")
+	}
+	for _, day := range projection.Days {
+		for _, projected := range day.Transactions {
+			if projected.Id == transaction.Id {
+				t.Errorf("rejected transaction %v projected on %v", transaction.Id, day.Date)
+			}
+		}
+	}
+
+	t.Log("testing the rejected transaction is not in the calendar")
+	rr = testutils.MakeRequest(t, router, "GET", "/pending_transactions/calendar?from=2099-01-01&to=2099-01-01", nil)
+	calendar := []types.CalendarDay{}
+	err = json.Unmarshal(rr.Body.Bytes(), &calendar)
+	if err != nil {
+		t.Fatal("Response body does not contain an array of type CalendarDay")
+	}
+	for _, day := range calendar {
+		for _, listed := range day.Transactions {
+			if listed.Id == transaction.Id {
+				t.Errorf("rejected transaction %v listed on %v", transaction.Id, day.Date)
+			}
+		}
+	}
+}
+
+func TestProject(t *testing.T) {
+	current := []types.CurrencyBalance{
+		{Currency: "USD", Symbol: "$", Balance: money.MustParse("100")},
+		{Currency: "VES", Symbol: "Bs.", Balance: money.MustParse("50")},
+	}
+	pending := []types.PendingTransaction{
+		{Type: "output", Currency: "USD", Amount: money.MustParse("60"), DueDate: "2031-01-10"},
+		{Type: "input", Currency: "VES", Amount: money.MustParse("10"), DueDate: "2031-01-10"},
+		{Type: "output", Currency: "USD", Amount: money.MustParse("70"), DueDate: "2031-01-12"},
+		{Type: "output", Currency: "USD", Amount: money.MustParse("10"), DueDate: "2031-01-13"},
+	}
+
+	projection := project(current, pending)
+	if len(projection.Days) != 3 {
+		t.Fatalf("days = %v, want 3", len(projection.Days))
+	}
+	if !projection.Days[0].Balances[0].Balance.Equal(money.MustParse("40")) || !projection.Days[0].Balances[1].Balance.Equal(money.MustParse("60")) {
+		t.Errorf("balances on %v = %v, want USD 40 and VES 60", projection.Days[0].Date, projection.Days[0].Balances)
+	}
+	if !current[0].Balance.Equal(money.MustParse("100")) {
+		t.Errorf("current balance = %v, want it untouched", current[0].Balance)
+	}
+	if len(projection.Shortfalls) != 1 {
+		t.Fatalf("shortfalls = %v, want only USD", projection.Shortfalls)
+	}
+	shortfall := projection.Shortfalls[0]
+	if shortfall.Currency != "USD" || shortfall.Date != "2031-01-12" || !shortfall.Balance.Equal(money.MustParse("-30")) {
+		t.Errorf("shortfall = %v on %v of %v, want USD on 2031-01-12 of -30.00", shortfall.Currency, shortfall.Date, shortfall.Balance)
+	}
+}
+
+func createPendingTransaction(t *testing.T, router *httprouter.Router, transaction types.PendingTransaction) types.PendingTransaction {
+	rr := testutils.MakeRequest(t, router, "POST", "/pending_transactions", transaction)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdTransaction := types.PendingTransaction{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdTransaction)
+	if err != nil {
+		t.Fatal("Response body does not contain a PendingTransaction type")
+	}
+	return createdTransaction
+}
+
+func TestExecutePendingTransactionsDryRun(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.PUT("/pending_transactions/:id", ExecutePendingTransaction)
+	router.GET("/pending_transactions", GetPendingTransactions)
+
+	newInput := types.PendingTransaction{Type: "input", Currency: "USD", Amount: money.MustParse("30"), Description: "scheduled"}
+	newInput.Account.Id = 1
+	newInput.Actor.Id = 1
+	input := createPendingTransaction(t, router, newInput)
+	newOutput := types.PendingTransaction{Type: "output", Currency: "USD", Amount: money.MustParse("20"), Description: "scheduled"}
+	newOutput.Account.Id = 1
+	newOutput.Actor.Id = 1
+	output := createPendingTransaction(t, router, newOutput)
+	approver := createApprover(t, router)
+	approve(t, router, input.Id, approver)
+	approve(t, router, output.Id, approver)
+
+	batch := types.BatchExecution{Ids: []int{input.Id, output.Id}, DryRun: true}
+	batch.Actor.Id = approver
+	rr := testutils.MakeRequest(t, router, "PUT", "/pending_transactions/execute", batch)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	result := types.BatchResult{}
+	err := json.Unmarshal(rr.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal("Response body does not contain a BatchResult type")
+	}
+	if !result.DryRun || len(result.Transactions) != 2 || len(result.Balances) == 0 {
+		t.Fatalf("result = %v, want a dry run with 2 transactions and the balances", result)
+	}
+	if result.Transactions[0].Type != "input" || result.Transactions[1].Type != "output" {
+		t.Errorf("transactions = %v then %v, want input then output", result.Transactions[0].Type, result.Transactions[1].Type)
+	}
+	if result.Transactions[0].Id != 0 || result.Transactions[1].Id != 0 {
+		t.Errorf("ids = %v and %v, want 0 for entries that are not stored", result.Transactions[0].Id, result.Transactions[1].Id)
+	}
+	checkSequence(t)
+
+	t.Log("testing the dry run did not execute anything")
+	rr = testutils.MakeRequest(t, router, "GET", "/pending_transactions", nil)
+	pendingTransactions := []types.PendingTransaction{}
+	err = json.Unmarshal(rr.Body.Bytes(), &pendingTransactions)
+	if err != nil {
+		t.Fatal("Response body does not contain an array of type PendingTransaction")
+	}
+	found := 0
+	for _, transaction := range pendingTransactions {
+		if transaction.Id == input.Id || transaction.Id == output.Id {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("found %v of the pending transactions, want 2", found)
+	}
+
+	t.Log("testing the batch is executed")
+	batch.DryRun = false
+	rr = testutils.MakeRequest(t, router, "PUT", "/pending_transactions/execute", batch)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+}
+
+func TestExecutePendingTransactionsAllOrNothing(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.PUT("/pending_transactions/:id", ExecutePendingTransaction)
+
+	newInput := types.PendingTransaction{Type: "input", Currency: "USD", Amount: money.MustParse("10"), Description: "scheduled"}
+	newInput.Account.Id = 1
+	newInput.Actor.Id = 1
+	input := createPendingTransaction(t, router, newInput)
+	newOutput := types.PendingTransaction{Type: "output", Currency: "USD", Amount: money.MustParse("99999999999"), Description: "scheduled"}
+	newOutput.Account.Id = 1
+	newOutput.Actor.Id = 1
+	output := createPendingTransaction(t, router, newOutput)
+	approver := createApprover(t, router)
+	approve(t, router, input.Id, approver)
+	approve(t, router, output.Id, approver, createApprover(t, router))
+
+	batch := types.BatchExecution{Ids: []int{input.Id, output.Id}}
+	batch.Actor.Id = approver
+	rr := testutils.MakeRequest(t, router, "PUT", "/pending_transactions/execute", batch)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Fatalf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := fmt.Sprintf("No se ejecutó ninguna transacción, la número 2 de la lista falló: Su transacción pendiente de id %v no pudo ser ejecutada porque genera un balance menor a cero (0)", output.Id)
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+
+	checkSequence(t)
+
+	t.Log("testing the first transaction was rolled back")
+	batch = types.BatchExecution{Ids: []int{input.Id}, DryRun: true}
+	batch.Actor.Id = approver
+	rr = testutils.MakeRequest(t, router, "PUT", "/pending_transactions/execute", batch)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+}
+
+// checkSequence fails when the next ledger id would not follow the last
+// entry, ids taken by discarded inserts must be given back
+func checkSequence(t *testing.T) {
+	db := database.ConnectDB()
+	defer db.Close()
+	var lastValue, lastId int
+	err := db.QueryRow("SELECT last_value, (SELECT MAX(id) FROM transactions_with_balances) FROM transactions_with_balances_id_seq;").Scan(&lastValue, &lastId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastValue != lastId {
+		t.Errorf("sequence last value = %v, want the last ledger id %v", lastValue, lastId)
+	}
+}
+
+func TestExecutePendingTransactionsRepeatedId(t *testing.T) {
+	router := httprouter.New()
+	router.PUT("/pending_transactions/:id", ExecutePendingTransaction)
+
+	rr := testutils.MakeRequest(t, router, "PUT", "/pending_transactions/execute", types.BatchExecution{Ids: []int{7, 8, 7}})
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La transacción pendiente 7 está repetida en la lista"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestExecutePendingTransactionsEmpty(t *testing.T) {
+	router := httprouter.New()
+	router.PUT("/pending_transactions/:id", ExecutePendingTransaction)
+
+	rr := testutils.MakeRequest(t, router, "PUT", "/pending_transactions/execute", types.BatchExecution{})
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "Debe especificar al menos una transacción pendiente"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func createApprover(t *testing.T, router *httprouter.Router) int {
+	if _, _, found := router.Lookup("POST", "/actors"); !found {
+		router.POST("/actors", actors.CreateActor)
+	}
+	approver := types.Actor{Type: "personnel", Name: fmt.Sprintf("aprobador %v", time.Now().UnixNano())}
+	rr := testutils.MakeRequest(t, router, "POST", "/actors", approver)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdApprover := types.Actor{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdApprover)
+	if err != nil {
+		t.Fatal("Response body does not contain an Actor type")
+	}
+	return createdApprover.Id
+}
+
+// approve submits the pending transaction and approves it once per approver
+func approve(t *testing.T, router *httprouter.Router, id int, approvers ...int) types.PendingTransaction {
+	if _, _, found := router.Lookup("PUT", "/pending_transactions/1/submit"); !found {
+		router.PUT("/pending_transactions/:id/submit", SubmitPendingTransaction)
+		router.PUT("/pending_transactions/:id/approve", ApprovePendingTransaction)
+	}
+	step := types.PendingStep{}
+	step.Actor.Id = approvers[0]
+	rr := testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v/submit", id), step)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	transaction := types.PendingTransaction{}
+	for _, approver := range approvers {
+		step.Actor.Id = approver
+		rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v/approve", id), step)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &transaction)
+		if err != nil {
+			t.Fatal("Response body does not contain a PendingTransaction type")
+		}
+	}
+	return transaction
+}
+
+func TestExecuteNotApprovedPendingTransaction(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.PUT("/pending_transactions/:id", ExecutePendingTransaction)
+
+	newTransaction := types.PendingTransaction{Type: "input", Currency: "USD", Amount: money.MustParse("5"), Description: "scheduled"}
+	newTransaction.Account.Id = 1
+	newTransaction.Actor.Id = 1
+	transaction := createPendingTransaction(t, router, newTransaction)
+	if transaction.Status != "draft" {
+		t.Errorf("Status = %v, want draft", transaction.Status)
+	}
+	step := types.PendingStep{}
+	step.Actor.Id = createApprover(t, router)
+	rr := testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v", transaction.Id), step)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := fmt.Sprintf("La transacción pendiente de id %v no está aprobada", transaction.Id)
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestExecutePendingTransactionWithoutActor(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.PUT("/pending_transactions/:id", ExecutePendingTransaction)
+
+	newTransaction := types.PendingTransaction{Type: "input", Currency: "USD", Amount: money.MustParse("5"), Description: "scheduled"}
+	newTransaction.Account.Id = 1
+	newTransaction.Actor.Id = 1
+	transaction := createPendingTransaction(t, router, newTransaction)
+	approve(t, router, transaction.Id, createApprover(t, router))
+
+	t.Log("testing the executing employee is required")
+	rr := testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v", transaction.Id), types.PendingStep{})
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "Debe especificar el empleado que ejecuta la transacción pendiente"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+
+	t.Log("testing a batch also requires it")
+	rr = testutils.MakeRequest(t, router, "PUT", "/pending_transactions/execute", types.BatchExecution{Ids: []int{transaction.Id}})
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected = "Debe especificar el empleado que ejecuta las transacciones pendientes"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestGetTransactionSteps(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.PUT("/pending_transactions/:id", ExecutePendingTransaction)
+	router.GET("/transactions/:id/steps", transactions.GetTransactionSteps)
+
+	newTransaction := types.PendingTransaction{Type: "input", Currency: "USD", Amount: money.MustParse("5"), Description: "scheduled"}
+	newTransaction.Account.Id = 1
+	newTransaction.Actor.Id = 1
+	transaction := createPendingTransaction(t, router, newTransaction)
+	approver := createApprover(t, router)
+	approve(t, router, transaction.Id, approver)
+	step := types.PendingStep{}
+	step.Actor.Id = approver
+	rr := testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v", transaction.Id), step)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	executed := types.TransactionWithBalance{}
+	err := json.Unmarshal(rr.Body.Bytes(), &executed)
+	if err != nil {
+		t.Fatal("Response body does not contain a TransactionWithBalance type")
+	}
+
+	t.Log("testing the history stays with the ledger entry")
+	rr = testutils.MakeRequest(t, router, "GET", fmt.Sprintf("/transactions/%v/steps", executed.Id), nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	steps := []types.PendingStep{}
+	err = json.Unmarshal(rr.Body.Bytes(), &steps)
+	if err != nil {
+		t.Fatal("Response body does not contain a list of PendingStep")
+	}
+	expected := []string{"submitted", "approved", "executed"}
+	if len(steps) != len(expected) {
+		t.Fatalf("steps = %v, want %v", steps, expected)
+	}
+	for i, status := range expected {
+		if steps[i].Status != status || steps[i].Actor.Id != approver || steps[i].Transaction != executed.Id {
+			t.Errorf("step %v = %+v, want %v by %v on transaction %v", i, steps[i], status, approver, executed.Id)
+		}
+	}
+
+	t.Log("testing a non existing transaction")
+	rr = testutils.MakeRequest(t, router, "GET", "/transactions/999999999/steps", nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestStepsOnEveryResponse(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.GET("/pending_transactions/calendar", GetCalendar)
+
+	t.Log("testing a new pending transaction has an empty history")
+	newTransaction := types.PendingTransaction{Type: "input", Currency: "USD", Amount: money.MustParse("5"), Description: "scheduled", DueDate: "2030-01-01"}
+	newTransaction.Account.Id = 1
+	newTransaction.Actor.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/pending_transactions", newTransaction)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), `"Steps":[]`) {
+		t.Errorf("response = %v, want an empty list of steps", rr.Body.String())
+	}
+	transaction := types.PendingTransaction{}
+	err := json.Unmarshal(rr.Body.Bytes(), &transaction)
+	if err != nil {
+		t.Fatal("Response body does not contain a PendingTransaction type")
+	}
+
+	t.Log("testing the calendar carries the history")
+	approve(t, router, transaction.Id, createApprover(t, router))
+	rr = testutils.MakeRequest(t, router, "GET", "/pending_transactions/calendar?from=2030-01-01&to=2030-01-01", nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	calendar := []types.CalendarDay{}
+	err = json.Unmarshal(rr.Body.Bytes(), &calendar)
+	if err != nil {
+		t.Fatal("Response body does not contain a list of CalendarDay")
+	}
+	found := false
+	for _, day := range calendar {
+		for _, listed := range day.Transactions {
+			if listed.Id == transaction.Id {
+				found = true
+				if len(listed.Steps) != 2 {
+					t.Errorf("steps = %v, want the submission and the approval", listed.Steps)
+				}
+			}
+		}
+	}
+	if !found {
+		t.Errorf("calendar = %v, want it to list the transaction %v", calendar, transaction.Id)
+	}
+}
+
+func TestApproveOverThreshold(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.PUT("/pending_transactions/:id/reject", RejectPendingTransaction)
+	router.PATCH("/pending_transactions/:id", PatchPendingTransaction)
+
+	newTransaction := types.PendingTransaction{Type: "input", Currency: "USD", Amount: money.MustParse("5000"), Description: "scheduled"}
+	newTransaction.Account.Id = 1
+	newTransaction.Actor.Id = 1
+	transaction := createPendingTransaction(t, router, newTransaction)
+	first := createApprover(t, router)
+	second := createApprover(t, router)
+
+	t.Log("testing one approval is not enough over the threshold")
+	approved := approve(t, router, transaction.Id, first)
+	if approved.Status != "submitted" {
+		t.Errorf("Status = %v, want submitted", approved.Status)
+	}
+
+	t.Log("testing an employee approves once")
+	step := types.PendingStep{}
+	step.Actor.Id = first
+	rr := testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v/approve", transaction.Id), step)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+
+	t.Log("testing the second approval")
+	step.Actor.Id = second
+	rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v/approve", transaction.Id), step)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &approved)
+	if err != nil {
+		t.Fatal("Response body does not contain a PendingTransaction type")
+	}
+	if approved.Status != "approved" || len(approved.Steps) != 3 {
+		t.Errorf("Status = %v with %v steps, want approved with 3", approved.Status, len(approved.Steps))
+	}
+	if approved.Steps[2].Actor.Id != second || approved.Steps[2].Status != "approved" {
+		t.Errorf("last step = %v by %v, want approved by %v", approved.Steps[2].Status, approved.Steps[2].Actor.Id, second)
+	}
+
+	t.Log("testing an approved transaction can not be modified")
+	newTransaction.Amount = money.MustParse("6000")
+	rr = testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/pending_transactions/%v", transaction.Id), newTransaction)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+
+	t.Log("testing the rejection")
+	step.Notes = "falta soporte"
+	rr = testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v/reject", transaction.Id), step)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	rejected := types.PendingTransaction{}
+	err = json.Unmarshal(rr.Body.Bytes(), &rejected)
+	if err != nil {
+		t.Fatal("Response body does not contain a PendingTransaction type")
+	}
+	if rejected.Status != "rejected" {
+		t.Errorf("Status = %v, want rejected", rejected.Status)
+	}
+}
+
+func TestSubmitByNonEmployee(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pending_transactions", CreatePendingTransaction)
+	router.PUT("/pending_transactions/:id/submit", SubmitPendingTransaction)
+
+	newTransaction := types.PendingTransaction{Type: "input", Currency: "USD", Amount: money.MustParse("5"), Description: "scheduled"}
+	newTransaction.Account.Id = 1
+	newTransaction.Actor.Id = 1
+	transaction := createPendingTransaction(t, router, newTransaction)
+	step := types.PendingStep{}
+	step.Actor.Id = 1
+	rr := testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/pending_transactions/%v/submit", transaction.Id), step)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "Solo un empleado puede enviar, aprobar, rechazar o ejecutar una transacción pendiente"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
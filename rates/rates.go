@@ -0,0 +1,481 @@
+package rates
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+const selectRatesQuery = "SELECT id, date::TEXT, currency, rate, source, created_at FROM exchange_rates"
+
+// rates without a source are registered as typed by hand
+const manualSource = "manual"
+
+// rates without a currency are of bolívares, the currency they were first
+// registered for
+const defaultCurrency = "VES"
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanRate(rows *sql.Rows) (types.ExchangeRate, error) {
+	rate := types.ExchangeRate{}
+	err := rows.Scan(&rate.Id, &rate.Date, &rate.Currency, &rate.Rate, &rate.Source, &rate.CreatedAt)
+	return rate, err
+}
+
+func queryRates(q querier, query string) ([]types.ExchangeRate, error) {
+	rates := []types.ExchangeRate{}
+	rows, err := q.Query(query)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rate, err := scanRate(rows)
+		if err != nil {
+			return rates, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// LoadRates returns the exchange rates of every currency sorted by date, rates
+// of the same date keep the order in which they were registered
+func LoadRates(q querier) (map[string][]types.ExchangeRate, error) {
+	rates, err := queryRates(q, selectRatesQuery+" ORDER BY date, id;")
+	if err != nil {
+		return nil, err
+	}
+	ratesByCurrency := map[string][]types.ExchangeRate{}
+	for _, rate := range rates {
+		ratesByCurrency[rate.Currency] = append(ratesByCurrency[rate.Currency], rate)
+	}
+	return ratesByCurrency, nil
+}
+
+// dayOf drops the time of a timestamp so it can be compared with rate dates
+func dayOf(date string) string {
+	if len(date) > len(types.DateFormat) {
+		return date[:len(types.DateFormat)]
+	}
+	return date
+}
+
+// InForce returns the rate in force on the given date, that is the last one
+// registered with that date or an earlier one. rates must be the rates of a
+// single currency sorted as LoadRates returns them.
+func InForce(rates []types.ExchangeRate, date string) (types.ExchangeRate, bool) {
+	date = dayOf(date)
+	next := sort.Search(len(rates), func(i int) bool {
+		return rates[i].Date > date
+	})
+	if next == 0 {
+		return types.ExchangeRate{}, false
+	}
+	return rates[next-1], true
+}
+
+// ParseValuation reads the valuation query param, it returns false when no
+// valuation was requested and an error message when it is not supported
+func ParseValuation(r *http.Request) (bool, string) {
+	valuation := r.URL.Query().Get("valuation")
+	if valuation == "" {
+		return false, ""
+	}
+	if valuation != "USD" {
+		return false, "Solo se acepta la valoración en USD"
+	}
+	return true, ""
+}
+
+// valuationAt returns an empty USD valuation with the rate of the currency in
+// force on the given date, USD is always valued at a rate of one
+func valuationAt(rates map[string][]types.ExchangeRate, currency string, date string) (*types.Valuation, bool) {
+	if currency == "USD" {
+		return &types.Valuation{Currency: "USD", Date: dayOf(date), Rate: money.MustParseRate("1")}, true
+	}
+	rate, found := InForce(rates[currency], date)
+	if !found {
+		return nil, false
+	}
+	return &types.Valuation{Currency: "USD", Date: rate.Date, Rate: rate.Rate}, true
+}
+
+// ToUSD converts the amount with the rate of its currency in force on the
+// given date, it returns false when the currency has no rate by then
+func ToUSD(q querier, currency string, amount money.Money, date string) (money.Money, bool, error) {
+	if currency == "USD" {
+		return amount, true, nil
+	}
+	rates, err := queryRates(q, fmt.Sprintf("%v WHERE currency='%v' ORDER BY date, id;", selectRatesQuery, currency))
+	if err != nil {
+		return money.Money{}, false, err
+	}
+	rate, found := InForce(rates, date)
+	if !found {
+		return money.Money{}, false, nil
+	}
+	return amount.DivRate(rate.Rate), true, nil
+}
+
+// ValueTransactions sets the USD valuation of the amount and the currency
+// balance of every transaction using the rate in force on the day it was
+// executed, transactions older than the first rate of their currency are
+// left without valuation
+func ValueTransactions(q querier, transactions []types.TransactionWithBalance) error {
+	rates, err := LoadRates(q)
+	if err != nil {
+		return err
+	}
+	for i := range transactions {
+		valuation, found := valuationAt(rates, transactions[i].Currency, transactions[i].Executed)
+		if !found {
+			continue
+		}
+		valuation.Amount = transactions[i].Amount.DivRate(valuation.Rate)
+		valuation.Balance = transactions[i].CurrencyBalance.DivRate(valuation.Rate)
+		transactions[i].Valuation = valuation
+	}
+	return nil
+}
+
+// ValueAccounts sets the USD valuation of the balance of every account using
+// the rate in force today, the Amount of the valuation is not used
+func ValueAccounts(q querier, accounts []types.Account) error {
+	rates, err := LoadRates(q)
+	if err != nil {
+		return err
+	}
+	today := time.Now().Local().Format(types.DateFormat)
+	for i := range accounts {
+		valuation, found := valuationAt(rates, accounts[i].Currency, today)
+		if !found {
+			continue
+		}
+		valuation.Balance = accounts[i].Balance.DivRate(valuation.Rate)
+		accounts[i].Valuation = valuation
+	}
+	return nil
+}
+
+func validateRate(rate *types.ExchangeRate) string {
+	_, err := time.Parse(types.DateFormat, rate.Date)
+	if err != nil {
+		return "La fecha de la tasa no tiene un formato válido"
+	}
+	if rate.Rate.Sign() <= 0 {
+		return "La tasa de cambio debe ser mayor a cero (0)"
+	}
+	rate.Currency = strings.ToUpper(strings.TrimSpace(rate.Currency))
+	if rate.Currency == "" {
+		rate.Currency = defaultCurrency
+	}
+	if rate.Currency == "USD" {
+		return "Las tasas de cambio se registran para monedas distintas a USD"
+	}
+	rate.Source = strings.TrimSpace(rate.Source)
+	if rate.Source == "" {
+		rate.Source = manualSource
+	}
+	return ""
+}
+
+func GetRates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	conditions := []string{}
+	from := r.URL.Query().Get("from")
+	if from != "" {
+		if _, err := time.Parse(types.DateFormat, from); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La fecha de inicio no tiene un formato válido")
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("date >= '%v'", from))
+	}
+	to := r.URL.Query().Get("to")
+	if to != "" {
+		if _, err := time.Parse(types.DateFormat, to); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La fecha de fin no tiene un formato válido")
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("date <= '%v'", to))
+	}
+	currency := r.URL.Query().Get("currency")
+	if currency != "" {
+		conditions = append(conditions, fmt.Sprintf("currency = '%v'", currency))
+	}
+	query := selectRatesQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+	rates, err := queryRates(db, query+" ORDER BY date DESC, id DESC;")
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	json_rates, err := json.Marshal(rates)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json_rates)
+}
+
+func CreateRate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rate := types.ExchangeRate{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &rate)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con una tasa de cambio")
+		return
+	}
+	if message := validateRate(&rate); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := checkCurrencies(db, []types.ExchangeRate{rate})
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	var insertedId int
+	insertRateQuery := fmt.Sprintf("INSERT INTO exchange_rates (date, currency, rate, source) VALUES ('%v', '%v', '%v', '%v') RETURNING id;", rate.Date, rate.Currency, rate.Rate, rate.Source)
+	err = db.QueryRow(insertRateQuery).Scan(&insertedId)
+	if err != nil {
+		if err.Error() == "pq: duplicate key value violates unique constraint \"exchange_rates_date_currency_source_key\"" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Ya existe una tasa de %v de la fuente %v para la fecha %v", rate.Currency, rate.Source, rate.Date)
+			return
+		}
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	insertedRates, err := queryRates(db, fmt.Sprintf("%v WHERE id='%v';", selectRatesQuery, insertedId))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	insertedRate := types.ExchangeRate{}
+	for _, rate := range insertedRates {
+		insertedRate = rate
+	}
+	response, err := json.Marshal(insertedRate)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// checkCurrencies returns a message when a rate is of a currency that is not
+// registered
+func checkCurrencies(q rowQuerier, rates []types.ExchangeRate) (string, error) {
+	checked := map[string]bool{}
+	for _, rate := range rates {
+		if checked[rate.Currency] {
+			continue
+		}
+		currency, err := ledger.LookupCurrency(q, rate.Currency)
+		if err != nil {
+			return "", err
+		}
+		if currency.Code == "" {
+			return fmt.Sprintf("La moneda %v no está registrada", rate.Currency), nil
+		}
+		checked[rate.Currency] = true
+	}
+	return "", nil
+}
+
+func upsertRate(q rowQuerier, rate types.ExchangeRate) (int, error) {
+	var id int
+	err := q.QueryRow(fmt.Sprintf("INSERT INTO exchange_rates (date, currency, rate, source) VALUES ('%v', '%v', '%v', '%v') ON CONFLICT (date, currency, source) DO UPDATE SET rate = EXCLUDED.rate RETURNING id;", rate.Date, rate.Currency, rate.Rate, rate.Source)).Scan(&id)
+	return id, err
+}
+
+// ImportRates reads a CSV file sent in the "file" field with the columns
+// date, rate, source and currency, the header row, the source and the currency
+// are optional. Rates already registered for the same date, currency and
+// source are replaced, so a file can be imported again. Nothing is imported
+// when a line is not valid.
+func ImportRates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Debe enviar un archivo CSV en el campo file")
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rates := []types.ExchangeRate{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La línea %v del archivo no es válida", line)
+			return
+		}
+		if line == 1 && len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), "date") {
+			continue
+		}
+		if len(record) < 2 || len(record) > 4 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La línea %v del archivo debe poseer fecha, tasa, fuente y moneda", line)
+			return
+		}
+		rate := types.ExchangeRate{Date: strings.TrimSpace(record[0])}
+		rate.Rate, err = money.ParseRate(record[1])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La tasa de la línea %v del archivo no es válida", line)
+			return
+		}
+		if len(record) >= 3 {
+			rate.Source = record[2]
+		}
+		if len(record) == 4 {
+			rate.Currency = record[3]
+		}
+		if message := validateRate(&rate); message != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Línea %v: %v", line, message)
+			return
+		}
+		rates = append(rates, rate)
+	}
+	if len(rates) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El archivo no posee tasas de cambio")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := checkCurrencies(db, rates)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
+	importedIds := []string{}
+	for _, rate := range rates {
+		importedId, err := upsertRate(tx, rate)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		importedIds = append(importedIds, fmt.Sprintf("'%v'", importedId))
+	}
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	importedRates, err := queryRates(db, fmt.Sprintf("%v WHERE id IN (%v) ORDER BY date, id;", selectRatesQuery, strings.Join(importedIds, ", ")))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(importedRates)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func DeleteRate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	rateId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	deletedId := types.IdResponse{}
+	err = db.QueryRow(fmt.Sprintf("DELETE FROM exchange_rates WHERE id='%v' RETURNING id;", rateId)).Scan(&deletedId.Id)
+	if err != nil && err != sql.ErrNoRows {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if deletedId.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La tasa con el id %v no existe", rateId)
+		return
+	}
+	response, err := json.Marshal(deletedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
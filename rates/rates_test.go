@@ -0,0 +1,133 @@
+package rates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestInForce(t *testing.T) {
+	rates := []types.ExchangeRate{
+		{Id: 1, Date: "2022-01-01", Currency: "VES", Rate: money.MustParseRate("4.5")},
+		{Id: 2, Date: "2022-01-10", Currency: "VES", Rate: money.MustParseRate("4.6")},
+		{Id: 3, Date: "2022-01-10", Currency: "VES", Rate: money.MustParseRate("4.7")},
+	}
+	tests := []struct {
+		date  string
+		found bool
+		id    int
+	}{
+		{"2021-12-31", false, 0},
+		{"2022-01-01", true, 1},
+		{"2022-01-09T23:59:59-04:00", true, 1},
+		{"2022-01-10", true, 3},
+		{"2022-02-01", true, 3},
+	}
+	for _, test := range tests {
+		rate, found := InForce(rates, test.date)
+		if found != test.found || rate.Id != test.id {
+			t.Errorf("InForce(%v) = %v %v, want %v %v", test.date, rate.Id, found, test.id, test.found)
+		}
+	}
+}
+
+func TestGetRates(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/rates", GetRates)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/rates", nil)
+
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+	rates := []types.ExchangeRate{}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	err = json.Unmarshal(body, &rates)
+	if err != nil {
+		t.Error("Response body does not contain an array of type ExchangeRate")
+	}
+}
+
+func TestCreateRateWithBadDate(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/rates", CreateRate)
+
+	rr := testutils.MakeRequest(t, router, "POST", "/rates", json.RawMessage(`{"Date": "01/02/2022", "Rate": 4.5}`))
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La fecha de la tasa no tiene un formato válido"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestImportRates(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/rates/import", ImportRates)
+	router.DELETE("/rates/:id", DeleteRate)
+
+	source := utils.RandStringBytes(10)
+	content := fmt.Sprintf("date,rate,source,currency\n2022-01-03,4.61,%v,VES\n2022-01-04,4.62,%v\n", source, source)
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "rates.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", "/rates/import", bytes.NewReader(body.Bytes()))
+		if err != nil {
+			log.Fatal(err)
+			t.Error("Could not make a post request to /rates/import")
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		t.Log("testing OK status code")
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+		}
+		imported := []types.ExchangeRate{}
+		err = json.Unmarshal(rr.Body.Bytes(), &imported)
+		if err != nil {
+			t.Fatal("Response body does not contain an array of type ExchangeRate")
+		}
+
+		t.Log("testing that importing again does not duplicate the rates")
+		if len(imported) != 2 {
+			t.Fatalf("imported %v rates, want 2", len(imported))
+		}
+		if imported[0].Date != "2022-01-03" || imported[0].Rate.Cmp(money.MustParseRate("4.61")) != 0 {
+			t.Errorf("first rate = %v %v, want 2022-01-03 4.61", imported[0].Date, imported[0].Rate)
+		}
+		if i == 1 {
+			for _, rate := range imported {
+				testutils.MakeRequest(t, router, "DELETE", fmt.Sprintf("/rates/%v", rate.Id), nil)
+			}
+		}
+	}
+}
@@ -0,0 +1,487 @@
+package recurring
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+const selectRecurringQuery = "SELECT recurring_transactions.id, recurring_transactions.type, recurring_transactions.currency, recurring_transactions.amount, recurring_transactions.description, accounts.id, accounts.name, actors.id, actors.name, COALESCE(categories.id, 0), COALESCE(categories.name, ''), recurring_transactions.frequency, TO_CHAR(recurring_transactions.start_date, 'YYYY-MM-DD'), COALESCE(TO_CHAR(recurring_transactions.end_date, 'YYYY-MM-DD'), ''), COALESCE(TO_CHAR(recurring_transactions.last_date, 'YYYY-MM-DD'), ''), recurring_transactions.created_at FROM recurring_transactions INNER JOIN actors ON recurring_transactions.actor = actors.id INNER JOIN accounts ON recurring_transactions.account = accounts.id LEFT JOIN categories ON recurring_transactions.category = categories.id"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRecurring(row scanner) (types.RecurringTransaction, error) {
+	recurring := types.RecurringTransaction{}
+	err := row.Scan(&recurring.Id, &recurring.Type, &recurring.Currency, &recurring.Amount, &recurring.Description, &recurring.Account.Id, &recurring.Account.Name, &recurring.Actor.Id, &recurring.Actor.Name, &recurring.Category.Id, &recurring.Category.Name, &recurring.Frequency, &recurring.StartDate, &recurring.EndDate, &recurring.LastDate, &recurring.CreatedAt)
+	return recurring, err
+}
+
+func loadRecurring(db *sql.DB, id int) (types.RecurringTransaction, error) {
+	recurring, err := scanRecurring(db.QueryRow(fmt.Sprintf("%v WHERE recurring_transactions.id='%v';", selectRecurringQuery, id)))
+	if err == sql.ErrNoRows {
+		return types.RecurringTransaction{}, nil
+	}
+	return recurring, err
+}
+
+// validateRecurring returns a message for the client when the template
+// should be rejected as a bad request
+func validateRecurring(db *sql.DB, recurring *types.RecurringTransaction) (string, error) {
+	recurring.Description = strings.TrimSpace(recurring.Description)
+	if recurring.Type != "input" && recurring.Type != "output" {
+		return "El tipo de transacción solo puede ser del tipo 'input' o 'output'", nil
+	}
+	if recurring.Amount.Sign() <= 0 {
+		return "El monto de la transacción recurrente debe ser mayor a cero (0)", nil
+	}
+	if recurring.Amount.Cmp(types.MaxTransactionAmount) > 0 {
+		return "El monto de la transacción recurrente excede el máximo permitido", nil
+	}
+	if recurring.Description == "" {
+		return "La transacción recurrente debe poseer una descripción", nil
+	}
+	if recurring.Actor.Id <= 0 {
+		return "La transacción recurrente debe poseer un actor", nil
+	}
+	if recurring.Account.Id <= 0 {
+		return "La transacción recurrente debe poseer una cuenta", nil
+	}
+	if recurring.Frequency != "weekly" && recurring.Frequency != "biweekly" && recurring.Frequency != "monthly" && recurring.Frequency != "yearly" {
+		return "La frecuencia solo puede ser 'weekly', 'biweekly', 'monthly' o 'yearly'", nil
+	}
+	startDate, err := time.Parse(types.DateFormat, recurring.StartDate)
+	if err != nil {
+		return "La fecha de inicio no tiene un formato válido", nil
+	}
+	if recurring.EndDate != "" {
+		endDate, err := time.Parse(types.DateFormat, recurring.EndDate)
+		if err != nil {
+			return "La fecha final no tiene un formato válido", nil
+		}
+		if endDate.Before(startDate) {
+			return "La fecha final no puede ser anterior a la fecha de inicio", nil
+		}
+	}
+
+	message, err := ledger.CheckCurrency(db, recurring.Currency, recurring.Amount)
+	if err != nil || message != "" {
+		return message, err
+	}
+	message, err = ledger.CheckCategory(db, recurring.Category.Id)
+	if err != nil || message != "" {
+		return message, err
+	}
+
+	var actorId int
+	err = db.QueryRow(fmt.Sprintf("SELECT id FROM actors WHERE id='%v';", recurring.Actor.Id)).Scan(&actorId)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if actorId == 0 {
+		return "El actor especificado no existe", nil
+	}
+
+	accountCurrency, err := ledger.AccountCurrency(db, recurring.Account.Id)
+	if err != nil {
+		return "", err
+	}
+	if accountCurrency == "" {
+		return "La cuenta especificada no existe", nil
+	}
+	if accountCurrency != recurring.Currency {
+		return "La moneda de la transacción no coincide con la moneda de la cuenta", nil
+	}
+	return "", nil
+}
+
+// occurrence returns the n-th date of the schedule that starts on start.
+// Monthly and yearly schedules keep the day of the start, or the last day
+// of shorter months, so one starting on the 31st falls on February 28th.
+func occurrence(start time.Time, frequency string, n int) time.Time {
+	switch frequency {
+	case "weekly":
+		return start.AddDate(0, 0, 7*n)
+	case "biweekly":
+		return start.AddDate(0, 0, 14*n)
+	}
+	months := n
+	if frequency == "yearly" {
+		months = 12 * n
+	}
+	first := time.Date(start.Year(), start.Month()+time.Month(months), 1, 0, 0, 0, 0, start.Location())
+	day := start.Day()
+	if lastDay := first.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, start.Location())
+}
+
+// dueOccurrences returns the dates of the template that are due by today
+// and were not created yet, every one missed since LastDate is returned so
+// the schedule catches up after the server was down
+func dueOccurrences(recurring types.RecurringTransaction, today time.Time) []time.Time {
+	occurrences := []time.Time{}
+	start, err := time.Parse(types.DateFormat, recurring.StartDate)
+	if err != nil {
+		return occurrences
+	}
+	limit := today
+	if recurring.EndDate != "" {
+		endDate, err := time.Parse(types.DateFormat, recurring.EndDate)
+		if err == nil && endDate.Before(limit) {
+			limit = endDate
+		}
+	}
+	for n := 0; ; n++ {
+		date := occurrence(start, recurring.Frequency, n)
+		if date.After(limit) {
+			break
+		}
+		if recurring.LastDate != "" && date.Format(types.DateFormat) <= recurring.LastDate {
+			continue
+		}
+		occurrences = append(occurrences, date)
+	}
+	return occurrences
+}
+
+// materialize creates the pending transactions due for one template and
+// moves its LastDate forward in the same DB transaction. The template row is
+// locked and a pending transaction is unique per template and due date, so
+// running it twice never creates the same occurrence twice.
+func materialize(db *sql.DB, id int, today time.Time) ([]int, error) {
+	created := []int{}
+	tx, err := db.Begin()
+	if err != nil {
+		return created, err
+	}
+	defer tx.Rollback()
+
+	recurring, err := scanRecurring(tx.QueryRow(fmt.Sprintf("%v WHERE recurring_transactions.id='%v' FOR UPDATE OF recurring_transactions;", selectRecurringQuery, id)))
+	if err == sql.ErrNoRows {
+		return created, nil
+	}
+	if err != nil {
+		return created, err
+	}
+
+	occurrences := dueOccurrences(recurring, today)
+	if len(occurrences) == 0 {
+		return created, nil
+	}
+	for _, date := range occurrences {
+		insertPendingQuery := fmt.Sprintf("INSERT INTO pending_transactions (type, currency, amount, description, account, actor, category, due_date, recurring) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', %v, '%v', '%v') ON CONFLICT (recurring, due_date) DO NOTHING RETURNING id;", recurring.Type, recurring.Currency, recurring.Amount, recurring.Description, recurring.Account.Id, recurring.Actor.Id, ledger.Nullable(recurring.Category.Id), date.Format(types.DateFormat), recurring.Id)
+		var insertedId int
+		err = tx.QueryRow(insertPendingQuery).Scan(&insertedId)
+		if err != nil && err != sql.ErrNoRows {
+			return []int{}, err
+		}
+		if insertedId != 0 {
+			created = append(created, insertedId)
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf("UPDATE recurring_transactions SET last_date='%v' WHERE id='%v';", occurrences[len(occurrences)-1].Format(types.DateFormat), recurring.Id))
+	if err != nil {
+		return []int{}, err
+	}
+	return created, tx.Commit()
+}
+
+// Materialize creates the pending transactions of every template that are
+// due by today and returns their ids. A template that fails is logged and
+// left as it was, so it does not hold back the others and is tried again on
+// the next run.
+func Materialize(db *sql.DB, today time.Time) ([]int, error) {
+	ids := []int{}
+	rows, err := db.Query(fmt.Sprintf("SELECT id FROM recurring_transactions WHERE start_date <= '%v' ORDER BY id;", today.Format(types.DateFormat)))
+	if err != nil {
+		return ids, err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	created := []int{}
+	for _, id := range ids {
+		createdIds, err := materialize(db, id, today)
+		if err != nil {
+			log.Printf("no se pudieron crear las transacciones pendientes de la plantilla recurrente %v: %v", id, err)
+			continue
+		}
+		created = append(created, createdIds...)
+	}
+	return created, nil
+}
+
+// today is the local date at midnight UTC, the way dates are parsed from
+// types.DateFormat
+func today() time.Time {
+	date, _ := time.Parse(types.DateFormat, time.Now().Local().Format(types.DateFormat))
+	return date
+}
+
+// StartScheduler creates the pending transactions due right away, catching
+// up with the ones missed while the server was down, and checks again on
+// every interval
+func StartScheduler(interval time.Duration) {
+	go func() {
+		for {
+			db := database.ConnectDB()
+			created, err := Materialize(db, today())
+			db.Close()
+			if err != nil {
+				log.Println(err)
+			} else if len(created) > 0 {
+				log.Printf("se crearon %v transacciones pendientes recurrentes", len(created))
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func GetRecurringTransactions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	db := database.ConnectDB()
+	defer db.Close()
+
+	recurringTransactions := []types.RecurringTransaction{}
+	rows, err := db.Query(selectRecurringQuery + " ORDER BY recurring_transactions.id;")
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		recurring, err := scanRecurring(rows)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		recurringTransactions = append(recurringTransactions, recurring)
+	}
+
+	response, err := json.Marshal(recurringTransactions)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func CreateRecurringTransaction(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	recurring := types.RecurringTransaction{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &recurring)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con una transacción recurrente")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := validateRecurring(db, &recurring)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	var insertedId int
+	insertRecurringQuery := fmt.Sprintf("INSERT INTO recurring_transactions (type, currency, amount, description, account, actor, category, frequency, start_date, end_date) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', %v, '%v', '%v', %v) RETURNING id;", recurring.Type, recurring.Currency, recurring.Amount, recurring.Description, recurring.Account.Id, recurring.Actor.Id, ledger.Nullable(recurring.Category.Id), recurring.Frequency, recurring.StartDate, ledger.Nullable(recurring.EndDate))
+	err = db.QueryRow(insertRecurringQuery).Scan(&insertedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	insertedRecurring, err := loadRecurring(db, insertedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(insertedRecurring)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// PatchRecurringTransaction replaces the template, the pending transactions
+// already created are not changed and the new schedule only applies to the
+// dates after LastDate
+func PatchRecurringTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil || id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Id de transacción recurrente no válido")
+		return
+	}
+	recurring := types.RecurringTransaction{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &recurring)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data enviada no corresponde con una transacción recurrente")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := validateRecurring(db, &recurring)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	var updatedId int
+	updateRecurringQuery := fmt.Sprintf("UPDATE recurring_transactions SET type='%v', currency='%v', amount='%v', description='%v', account='%v', actor='%v', category=%v, frequency='%v', start_date='%v', end_date=%v WHERE id='%v' RETURNING id;", recurring.Type, recurring.Currency, recurring.Amount, recurring.Description, recurring.Account.Id, recurring.Actor.Id, ledger.Nullable(recurring.Category.Id), recurring.Frequency, recurring.StartDate, ledger.Nullable(recurring.EndDate), id)
+	err = db.QueryRow(updateRecurringQuery).Scan(&updatedId)
+	if err != nil && err != sql.ErrNoRows {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if updatedId == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción recurrente con el id %v no existe", id)
+		return
+	}
+
+	updatedRecurring, err := loadRecurring(db, updatedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(updatedRecurring)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// DeleteRecurringTransaction removes the template, the pending transactions
+// it already created are kept
+func DeleteRecurringTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestedId := ps.ByName("id")
+	id, err := strconv.Atoi(requestedId)
+	if err != nil || id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Id de transacción recurrente no válido")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	deletedId := types.IdResponse{}
+	err = db.QueryRow(fmt.Sprintf("DELETE FROM recurring_transactions WHERE id='%v' RETURNING id;", id)).Scan(&deletedId.Id)
+	if err != nil && err != sql.ErrNoRows {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if deletedId.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción recurrente con el id %v no existe", requestedId)
+		return
+	}
+	response, err := json.Marshal(deletedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// MaterializeRecurringTransactions runs the scheduler right away and returns
+// the pending transactions it created
+func MaterializeRecurringTransactions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	db := database.ConnectDB()
+	defer db.Close()
+
+	createdIds, err := Materialize(db, today())
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	created := []types.PendingTransaction{}
+	if len(createdIds) > 0 {
+		ids := []string{}
+		for _, id := range createdIds {
+			ids = append(ids, fmt.Sprintf("'%v'", id))
+		}
+		rows, err := db.Query(fmt.Sprintf("%v WHERE pending_transactions.id IN (%v) ORDER BY pending_transactions.id;", ledger.SelectPendingTransactionsQuery, strings.Join(ids, ", ")))
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			transaction, err := ledger.ScanPendingTransaction(rows)
+			if err != nil {
+				utils.SendInternalServerError(err, w)
+				return
+			}
+			created = append(created, transaction)
+		}
+	}
+	err = ledger.AttachSteps(db, created)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	response, err := json.Marshal(created)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
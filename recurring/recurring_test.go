@@ -0,0 +1,148 @@
+package recurring
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+func date(t *testing.T, value string) time.Time {
+	parsed, err := time.Parse(types.DateFormat, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestOccurrence(t *testing.T) {
+	cases := []struct {
+		start     string
+		frequency string
+		n         int
+		expected  string
+	}{
+		{"2022-01-03", "weekly", 2, "2022-01-17"},
+		{"2022-01-03", "biweekly", 2, "2022-01-31"},
+		{"2022-01-31", "monthly", 1, "2022-02-28"},
+		{"2022-01-31", "monthly", 2, "2022-03-31"},
+		{"2022-01-31", "monthly", 12, "2023-01-31"},
+		{"2020-02-29", "yearly", 1, "2021-02-28"},
+		{"2020-02-29", "yearly", 4, "2024-02-29"},
+	}
+	for _, c := range cases {
+		got := occurrence(date(t, c.start), c.frequency, c.n).Format(types.DateFormat)
+		if got != c.expected {
+			t.Errorf("occurrence(%v, %v, %v) = %v, want %v", c.start, c.frequency, c.n, got, c.expected)
+		}
+	}
+}
+
+func TestDueOccurrences(t *testing.T) {
+	recurring := types.RecurringTransaction{Frequency: "monthly", StartDate: "2022-01-15", EndDate: "2022-12-31"}
+
+	t.Log("testing every missed date is returned")
+	occurrences := dueOccurrences(recurring, date(t, "2022-04-20"))
+	if len(occurrences) != 4 {
+		t.Fatalf("occurrences = %v, want 4", len(occurrences))
+	}
+
+	t.Log("testing dates up to the last date are skipped")
+	recurring.LastDate = "2022-03-15"
+	occurrences = dueOccurrences(recurring, date(t, "2022-04-20"))
+	if len(occurrences) != 1 || occurrences[0].Format(types.DateFormat) != "2022-04-15" {
+		t.Fatalf("occurrences = %v, want only 2022-04-15", occurrences)
+	}
+
+	t.Log("testing the end date limits the schedule")
+	recurring.LastDate = ""
+	occurrences = dueOccurrences(recurring, date(t, "2023-06-01"))
+	if len(occurrences) != 12 {
+		t.Fatalf("occurrences = %v, want 12", len(occurrences))
+	}
+}
+
+func TestCreateRecurringTransactionWithBadFrequency(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/recurring_transactions", CreateRecurringTransaction)
+
+	recurring := types.RecurringTransaction{Type: "output", Currency: "USD", Amount: money.FromInt(500), Description: "Alquiler", Frequency: "daily", StartDate: "2022-01-01"}
+	recurring.Account.Id = 1
+	recurring.Actor.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/recurring_transactions", recurring)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La frecuencia solo puede ser 'weekly', 'biweekly', 'monthly' o 'yearly'"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestMaterializeIsIdempotent(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/recurring_transactions", CreateRecurringTransaction)
+	router.DELETE("/recurring_transactions/:id", DeleteRecurringTransaction)
+
+	recurring := types.RecurringTransaction{Type: "output", Currency: "USD", Amount: money.FromInt(500), Description: "Alquiler", Frequency: "monthly", StartDate: "2022-01-31", EndDate: "2022-04-30"}
+	recurring.Account.Id = 1
+	recurring.Actor.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/recurring_transactions", recurring)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	created := types.RecurringTransaction{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal("Response body does not contain a RecurringTransaction type")
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+	defer testutils.MakeRequest(t, router, "DELETE", fmt.Sprintf("/recurring_transactions/%v", created.Id), nil)
+	defer db.Exec(fmt.Sprintf("DELETE FROM pending_transactions WHERE recurring='%v';", created.Id))
+
+	t.Log("testing the missed months are created once")
+	today := date(t, "2022-06-01")
+	first, err := materialize(db, created.Id, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 4 {
+		t.Errorf("created = %v, want 4", len(first))
+	}
+	second, err := materialize(db, created.Id, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 0 {
+		t.Errorf("created = %v, want 0", len(second))
+	}
+
+	var dueDates []string
+	rows, err := db.Query(fmt.Sprintf("SELECT TO_CHAR(due_date, 'YYYY-MM-DD') FROM pending_transactions WHERE recurring='%v' ORDER BY due_date;", created.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dueDate string
+		if err := rows.Scan(&dueDate); err != nil {
+			t.Fatal(err)
+		}
+		dueDates = append(dueDates, dueDate)
+	}
+	expected := "2022-01-31,2022-02-28,2022-03-31,2022-04-30"
+	if strings.Join(dueDates, ",") != expected {
+		t.Errorf("due dates = %v, want %v", strings.Join(dueDates, ","), expected)
+	}
+}
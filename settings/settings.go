@@ -0,0 +1,120 @@
+package settings
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+const settingsColumns = "company_name, company_national_id, company_address, company_phone, iva_rate, iva_withholding_rate, islr_withholding_rate, approval_threshold, updated_at"
+
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanSettings(row *sql.Row) (types.Settings, error) {
+	settings := types.Settings{}
+	err := row.Scan(&settings.CompanyName, &settings.CompanyNationalId, &settings.CompanyAddress, &settings.CompanyPhone, &settings.IvaRate, &settings.IvaWithholdingRate, &settings.IslrWithholdingRate, &settings.ApprovalThreshold, &settings.UpdatedAt)
+	return settings, err
+}
+
+// Load returns the configuration of the company, the settings table always
+// has exactly one row
+func Load(q rowQuerier) (types.Settings, error) {
+	return scanSettings(q.QueryRow(fmt.Sprintf("SELECT %v FROM settings;", settingsColumns)))
+}
+
+// validateSettings returns a non empty message when the settings should be
+// rejected as a bad request
+func validateSettings(settings *types.Settings) string {
+	settings.CompanyName = strings.TrimSpace(settings.CompanyName)
+	settings.CompanyNationalId = strings.TrimSpace(settings.CompanyNationalId)
+	settings.CompanyAddress = strings.TrimSpace(settings.CompanyAddress)
+	settings.CompanyPhone = strings.TrimSpace(settings.CompanyPhone)
+	hundred := money.FromInt(100)
+	rates := []struct {
+		rate money.Money
+		name string
+	}{
+		{settings.IvaRate, "del IVA"},
+		{settings.IvaWithholdingRate, "de retención del IVA"},
+		{settings.IslrWithholdingRate, "de retención del ISLR"},
+	}
+	for _, rate := range rates {
+		if rate.rate.Sign() < 0 || rate.rate.Cmp(hundred) > 0 {
+			return fmt.Sprintf("La tasa %v debe estar entre 0 y 100", rate.name)
+		}
+	}
+	if settings.ApprovalThreshold.Sign() < 0 || settings.ApprovalThreshold.Cmp(types.MaxTransactionAmount) > 0 {
+		return "El monto a partir del cual se requieren dos aprobaciones no es válido"
+	}
+	return ""
+}
+
+func GetSettings(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	db := database.ConnectDB()
+	defer db.Close()
+
+	settings, err := Load(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(settings)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// PatchSettings replaces the configuration, bills take the rates in force
+// when they are created and pending transactions the approval threshold when
+// they are approved
+func PatchSettings(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	settings := types.Settings{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &settings)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data enviada no corresponde con la configuración")
+		return
+	}
+	if message := validateSettings(&settings); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	updateSettingsQuery := fmt.Sprintf("UPDATE settings SET company_name='%v', company_national_id='%v', company_address='%v', company_phone='%v', iva_rate='%v', iva_withholding_rate='%v', islr_withholding_rate='%v', approval_threshold='%v', updated_at=CURRENT_TIMESTAMP RETURNING %v;", settings.CompanyName, settings.CompanyNationalId, settings.CompanyAddress, settings.CompanyPhone, settings.IvaRate, settings.IvaWithholdingRate, settings.IslrWithholdingRate, settings.ApprovalThreshold, settingsColumns)
+	updatedSettings, err := scanSettings(db.QueryRow(updateSettingsQuery))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(updatedSettings)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
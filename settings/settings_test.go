@@ -0,0 +1,62 @@
+package settings
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestGetSettings(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/settings", GetSettings)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/settings", nil)
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	settings := types.Settings{}
+	err := json.Unmarshal(rr.Body.Bytes(), &settings)
+	if err != nil {
+		t.Fatal("Response body does not contain a Settings type")
+	}
+}
+
+func TestPatchSettingsWithBadRate(t *testing.T) {
+	router := httprouter.New()
+	router.PATCH("/settings", PatchSettings)
+
+	settings := types.Settings{IvaRate: money.MustParse("116")}
+	rr := testutils.MakeRequest(t, router, "PATCH", "/settings", settings)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La tasa del IVA debe estar entre 0 y 100"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestPatchSettingsWithNegativeThreshold(t *testing.T) {
+	router := httprouter.New()
+	router.PATCH("/settings", PatchSettings)
+
+	settings := types.Settings{ApprovalThreshold: money.MustParse("-1")}
+	rr := testutils.MakeRequest(t, router, "PATCH", "/settings", settings)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "El monto a partir del cual se requieren dos aprobaciones no es válido"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
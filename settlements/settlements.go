@@ -0,0 +1,663 @@
+package settlements
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+const selectPayRulesQuery = "SELECT pay_rules.id, COALESCE(driver.id, 0), COALESCE(driver.name, ''), COALESCE(origin.id, 0), COALESCE(origin.name, ''), COALESCE(destination.id, 0), COALESCE(destination.name, ''), pay_rules.type, pay_rules.currency, pay_rules.rate, pay_rules.created_at FROM pay_rules LEFT JOIN actors AS driver ON pay_rules.driver = driver.id LEFT JOIN actors AS origin ON pay_rules.origin = origin.id LEFT JOIN actors AS destination ON pay_rules.destination = destination.id"
+
+// querier is satisfied by both *sql.DB and *sql.Tx so a settlement can be
+// previewed without a transaction and confirmed inside one
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func scanPayRule(rows *sql.Rows) (types.PayRule, error) {
+	rule := types.PayRule{}
+	err := rows.Scan(&rule.Id, &rule.Driver.Id, &rule.Driver.Name, &rule.Origin.Id, &rule.Origin.Name, &rule.Destination.Id, &rule.Destination.Name, &rule.Type, &rule.Currency, &rule.Rate, &rule.CreatedAt)
+	return rule, err
+}
+
+// actorType returns the type of the actor or an empty string when it does
+// not exist
+func actorType(db *sql.DB, id int) (string, error) {
+	var actorType string
+	rows, err := db.Query(fmt.Sprintf("SELECT type FROM actors WHERE id='%v';", id))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&actorType); err != nil {
+			return "", err
+		}
+	}
+	return actorType, nil
+}
+
+// validatePayRule returns a non empty message when the rule should be
+// rejected as a bad request
+func validatePayRule(db *sql.DB, rule types.PayRule) (string, error) {
+	if rule.Type != "per_trip" && rule.Type != "per_unit" && rule.Type != "bill_percentage" {
+		return "El tipo de regla solo puede ser 'per_trip', 'per_unit' o 'bill_percentage'", nil
+	}
+	if rule.Rate.Sign() <= 0 {
+		return "La tarifa de la regla debe ser mayor a cero (0)", nil
+	}
+	if rule.Type == "bill_percentage" && rule.Rate.Cmp(money.FromInt(100)) > 0 {
+		return "El porcentaje de la regla no puede ser mayor a cien (100)", nil
+	}
+	if rule.Rate.Cmp(types.MaxTransactionAmount) > 0 {
+		return "La tarifa de la regla exede el máximo permitido", nil
+	}
+	if (rule.Origin.Id == 0) != (rule.Destination.Id == 0) {
+		return "La ruta de la regla debe poseer origen y destino", nil
+	}
+	if rule.Driver.Id == 0 && rule.Origin.Id == 0 {
+		return "La regla debe aplicar a un conductor o a una ruta", nil
+	}
+
+	currency, err := ledger.LookupCurrency(db, rule.Currency)
+	if err != nil {
+		return "", err
+	}
+	if currency.Code == "" {
+		return fmt.Sprintf("La moneda %v no está registrada", rule.Currency), nil
+	}
+
+	for _, id := range []int{rule.Driver.Id, rule.Origin.Id, rule.Destination.Id} {
+		if id == 0 {
+			continue
+		}
+		kind, err := actorType(db, id)
+		if err != nil {
+			return "", err
+		}
+		if kind == "" {
+			return fmt.Sprintf("El actor con el id %v no existe", id), nil
+		}
+		if id == rule.Driver.Id && kind != "driver" {
+			return "El actor especificado como conductor no es un conductor", nil
+		}
+	}
+	return "", nil
+}
+
+func GetPayRules(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rules := []types.PayRule{}
+	db := database.ConnectDB()
+	defer db.Close()
+	rows, err := db.Query(selectPayRulesQuery + " ORDER BY pay_rules.id;")
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rule, err := scanPayRule(rows)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		rules = append(rules, rule)
+	}
+	json_rules, err := json.Marshal(rules)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json_rules)
+}
+
+func CreatePayRule(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rule := types.PayRule{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &rule)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con una regla de pago")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := validatePayRule(db, rule)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	var insertedId int
+	insertRuleQuery := fmt.Sprintf("INSERT INTO pay_rules (driver, origin, destination, type, currency, rate) VALUES (%v, %v, %v, '%v', '%v', '%v') RETURNING id;", ledger.Nullable(rule.Driver.Id), ledger.Nullable(rule.Origin.Id), ledger.Nullable(rule.Destination.Id), rule.Type, rule.Currency, rule.Rate)
+	rowsInsertedId, err := db.Query(insertRuleQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsInsertedId.Close()
+	for rowsInsertedId.Next() {
+		if err := rowsInsertedId.Scan(&insertedId); err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	insertedRule := types.PayRule{}
+	rowsRetrievedRule, err := db.Query(fmt.Sprintf("%v WHERE pay_rules.id='%v';", selectPayRulesQuery, insertedId))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsRetrievedRule.Close()
+	for rowsRetrievedRule.Next() {
+		insertedRule, err = scanPayRule(rowsRetrievedRule)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	response, err := json.Marshal(insertedRule)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func PatchPayRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ruleId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if ruleId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id de la regla debe ser mayor a cero")
+		return
+	}
+
+	rule := types.PayRule{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &rule)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data enviada no corresponde con una regla de pago")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := validatePayRule(db, rule)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	var updatedId int
+	updateRuleQuery := fmt.Sprintf("UPDATE pay_rules SET driver=%v, origin=%v, destination=%v, type='%v', currency='%v', rate='%v' WHERE id='%v' RETURNING id;", ledger.Nullable(rule.Driver.Id), ledger.Nullable(rule.Origin.Id), ledger.Nullable(rule.Destination.Id), rule.Type, rule.Currency, rule.Rate, ruleId)
+	rowsUpdatedId, err := db.Query(updateRuleQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsUpdatedId.Close()
+	for rowsUpdatedId.Next() {
+		if err := rowsUpdatedId.Scan(&updatedId); err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	if updatedId == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La regla con el id %v no existe", ruleId)
+		return
+	}
+
+	updatedRule := types.PayRule{}
+	rowsRetrievedRule, err := db.Query(fmt.Sprintf("%v WHERE pay_rules.id='%v';", selectPayRulesQuery, updatedId))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsRetrievedRule.Close()
+	for rowsRetrievedRule.Next() {
+		updatedRule, err = scanPayRule(rowsRetrievedRule)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	response, err := json.Marshal(updatedRule)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func DeletePayRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ruleId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if ruleId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id de la regla debe ser mayor a cero")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+	rows, err := db.Query(fmt.Sprintf("DELETE FROM pay_rules WHERE id='%v' RETURNING id;", ruleId))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	deletedId := types.IdResponse{}
+	for rows.Next() {
+		if err := rows.Scan(&deletedId.Id); err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	if deletedId.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La regla con el id %v no existe", ruleId)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	response, err := json.Marshal(deletedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Write(response)
+}
+
+// parseSettlementRequest reads the driver id and the from/to query parameters,
+// it returns a non empty message when the request is not valid
+func parseSettlementRequest(r *http.Request, ps httprouter.Params) (int, string, string, string) {
+	driverId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil || driverId <= 0 {
+		return 0, "", "", "Id de conductor no válido"
+	}
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	fromDate, err := time.Parse(types.DateFormat, from)
+	if err != nil {
+		return 0, "", "", "La fecha de inicio de la liquidación no tiene un formato válido"
+	}
+	toDate, err := time.Parse(types.DateFormat, to)
+	if err != nil {
+		return 0, "", "", "La fecha de fin de la liquidación no tiene un formato válido"
+	}
+	if toDate.Before(fromDate) {
+		return 0, "", "", "La fecha de fin de la liquidación es anterior a la fecha de inicio"
+	}
+	return driverId, from, to, ""
+}
+
+// computeSettlement lists the unsettled trips and advances of a driver and
+// what is owed per currency. Driver.Id is zero when the actor is not a
+// driver. When lock is true the trips and the advances are locked so a
+// concurrent confirmation can not settle them twice.
+func computeSettlement(q querier, driverId int, from string, to string, lock bool) (types.Settlement, error) {
+	settlement := types.Settlement{
+		From:     from,
+		To:       to,
+		Trips:    []types.SettlementTrip{},
+		Advances: []types.TransactionWithBalance{},
+		Totals:   []types.SettlementTotal{},
+	}
+
+	driverRows, err := q.Query(fmt.Sprintf("SELECT id, name FROM actors WHERE id='%v' AND type='driver';", driverId))
+	if err != nil {
+		return settlement, err
+	}
+	for driverRows.Next() {
+		if err := driverRows.Scan(&settlement.Driver.Id, &settlement.Driver.Name); err != nil {
+			driverRows.Close()
+			return settlement, err
+		}
+	}
+	driverRows.Close()
+	if settlement.Driver.Id == 0 {
+		return settlement, nil
+	}
+
+	lockClause := ""
+	if lock {
+		lockClause = " FOR UPDATE OF trips"
+	}
+	tripsQuery := fmt.Sprintf("SELECT trips.id, trips.date, trips.origin, origin.name, trips.destination, destination.name, trips.cargo, trips.amount, trips.unit FROM trips INNER JOIN actors AS origin ON trips.origin = origin.id INNER JOIN actors AS destination ON trips.destination = destination.id WHERE trips.driver='%v' AND trips.date BETWEEN '%v' AND '%v' AND trips.status IN ('delivered', 'billed') AND trips.settlement IS NULL ORDER BY trips.date, trips.id%v;", driverId, from, to, lockClause)
+	tripRows, err := q.Query(tripsQuery)
+	if err != nil {
+		return settlement, err
+	}
+	origins := []int{}
+	destinations := []int{}
+	for tripRows.Next() {
+		trip := types.SettlementTrip{}
+		var originId, destinationId int
+		if err := tripRows.Scan(&trip.Id, &trip.Date, &originId, &trip.Origin, &destinationId, &trip.Destination, &trip.Cargo, &trip.Amount, &trip.Unit); err != nil {
+			tripRows.Close()
+			return settlement, err
+		}
+		trip.Date = strings.Split(trip.Date, "T")[0]
+		settlement.Trips = append(settlement.Trips, trip)
+		origins = append(origins, originId)
+		destinations = append(destinations, destinationId)
+	}
+	tripRows.Close()
+
+	totals := map[string]*types.SettlementTotal{}
+	settledTrips := []types.SettlementTrip{}
+	for i := range settlement.Trips {
+		trip := &settlement.Trips[i]
+		ruleQuery := fmt.Sprintf("SELECT id, type, currency, rate FROM pay_rules WHERE (driver='%v' OR driver IS NULL) AND ((origin='%v' AND destination='%v') OR origin IS NULL) ORDER BY (origin IS NOT NULL) DESC, (driver IS NOT NULL) DESC, id DESC LIMIT 1;", driverId, origins[i], destinations[i])
+		ruleRows, err := q.Query(ruleQuery)
+		if err != nil {
+			return settlement, err
+		}
+		for ruleRows.Next() {
+			if err := ruleRows.Scan(&trip.Rule.Id, &trip.Rule.Type, &trip.Currency, &trip.Rule.Rate); err != nil {
+				ruleRows.Close()
+				return settlement, err
+			}
+		}
+		ruleRows.Close()
+		if trip.Rule.Id == 0 {
+			settledTrips = append(settledTrips, *trip)
+			continue
+		}
+
+		switch trip.Rule.Type {
+		case "per_trip":
+			trip.Pay = trip.Rule.Rate
+		case "per_unit":
+			trip.Pay = trip.Rule.Rate.Mul(int64(trip.Amount))
+		case "bill_percentage":
+			// the percentage of the bill subtotal, taxes excluded, is split
+			// among its trips by their amount and paid in the currency of
+			// the bill. Trips that are not billed yet, or whose bill has no
+			// amount, are left for a later settlement
+			var total money.Money
+			var billedAmount, billedTrips int64
+			billQuery := fmt.Sprintf("SELECT bills.subtotal, bills.currency, SUM(trips.amount), COUNT(trips.id) FROM trips INNER JOIN bills ON trips.bill = bills.id WHERE bills.id = (SELECT bill FROM trips WHERE id='%v') GROUP BY bills.id;", trip.Id)
+			billRows, err := q.Query(billQuery)
+			if err != nil {
+				return settlement, err
+			}
+			for billRows.Next() {
+				if err := billRows.Scan(&total, &trip.Currency, &billedAmount, &billedTrips); err != nil {
+					billRows.Close()
+					return settlement, err
+				}
+			}
+			billRows.Close()
+			if total.IsZero() {
+				continue
+			}
+			share := total.Percent(trip.Rule.Rate)
+			if billedAmount == 0 {
+				trip.Pay = share.Allocate(1, billedTrips)
+			} else {
+				trip.Pay = share.Allocate(int64(trip.Amount), billedAmount)
+			}
+		}
+		settledTrips = append(settledTrips, *trip)
+		if totals[trip.Currency] == nil {
+			totals[trip.Currency] = &types.SettlementTotal{Currency: trip.Currency}
+		}
+		totals[trip.Currency].Earned = totals[trip.Currency].Earned.Add(trip.Pay)
+	}
+	settlement.Trips = settledTrips
+
+	advancesLockClause := ""
+	if lock {
+		advancesLockClause = " FOR UPDATE OF transactions_with_balances"
+	}
+	advancesQuery := fmt.Sprintf("%v WHERE transactions_with_balances.actor='%v' AND transactions_with_balances.type='output' AND transactions_with_balances.settlement IS NULL AND transactions_with_balances.reversed = FALSE AND transactions_with_balances.reverses IS NULL AND transactions_with_balances.transfer IS NULL AND transactions_with_balances.executed::date <= '%v' ORDER BY transactions_with_balances.id%v;", ledger.SelectTransactionsQuery, driverId, to, advancesLockClause)
+	advanceRows, err := q.Query(advancesQuery)
+	if err != nil {
+		return settlement, err
+	}
+	for advanceRows.Next() {
+		advance, err := ledger.ScanTransaction(advanceRows)
+		if err != nil {
+			advanceRows.Close()
+			return settlement, err
+		}
+		settlement.Advances = append(settlement.Advances, advance)
+		if totals[advance.Currency] == nil {
+			totals[advance.Currency] = &types.SettlementTotal{Currency: advance.Currency}
+		}
+		totals[advance.Currency].Advances = totals[advance.Currency].Advances.Add(advance.Amount)
+	}
+	advanceRows.Close()
+
+	for _, total := range totals {
+		total.Balance = total.Earned.Sub(total.Advances)
+		settlement.Totals = append(settlement.Totals, *total)
+	}
+	sort.Slice(settlement.Totals, func(i, j int) bool {
+		return settlement.Totals[i].Currency < settlement.Totals[j].Currency
+	})
+	return settlement, nil
+}
+
+func GetSettlement(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	driverId, from, to, message := parseSettlementRequest(r, ps)
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	settlement, err := computeSettlement(db, driverId, from, to, false)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if settlement.Driver.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El conductor especificado no existe o no es un conductor")
+		return
+	}
+
+	response, err := json.Marshal(settlement)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func ConfirmSettlement(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	driverId, from, to, message := parseSettlementRequest(r, ps)
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
+
+	settlement, err := computeSettlement(tx, driverId, from, to, true)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if settlement.Driver.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El conductor especificado no existe o no es un conductor")
+		return
+	}
+	if len(settlement.Trips) == 0 && len(settlement.Advances) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No existen viajes ni adelantos por liquidar en el periodo")
+		return
+	}
+	for _, trip := range settlement.Trips {
+		if trip.Rule.Id == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "El viaje con el id %v no tiene una regla de pago", trip.Id)
+			return
+		}
+	}
+	for _, total := range settlement.Totals {
+		if total.Balance.Sign() < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Los adelantos en %v superan lo devengado por el conductor", total.Currency)
+			return
+		}
+	}
+
+	// the payouts are paid from the accounts listed in the accounts parameter,
+	// one per currency
+	payoutAccounts := map[string]int{}
+	for _, requestedAccount := range strings.Split(r.URL.Query().Get("accounts"), ",") {
+		if requestedAccount == "" {
+			continue
+		}
+		accountId, err := strconv.Atoi(requestedAccount)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "El parametro accounts debe ser una lista de ids separados por coma")
+			return
+		}
+		currency, err := ledger.AccountCurrency(tx, accountId)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		if currency == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "La cuenta con el id %v no existe", accountId)
+			return
+		}
+		payoutAccounts[currency] = accountId
+	}
+	for _, total := range settlement.Totals {
+		if total.Balance.Sign() > 0 && payoutAccounts[total.Currency] == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Debe especificar una cuenta en %v para pagar la liquidación", total.Currency)
+			return
+		}
+	}
+
+	for i := range settlement.Totals {
+		total := &settlement.Totals[i]
+		insertSettlementQuery := fmt.Sprintf("INSERT INTO settlements (driver, date_from, date_to, currency, earned, advances, balance) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", driverId, from, to, total.Currency, total.Earned, total.Advances, total.Balance)
+		err = tx.QueryRow(insertSettlementQuery).Scan(&total.Id)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+
+		for _, trip := range settlement.Trips {
+			if trip.Currency != total.Currency {
+				continue
+			}
+			_, err = tx.Exec(fmt.Sprintf("UPDATE trips SET settlement='%v' WHERE id='%v';", total.Id, trip.Id))
+			if err != nil {
+				utils.SendInternalServerError(err, w)
+				return
+			}
+		}
+		for _, advance := range settlement.Advances {
+			if advance.Currency != total.Currency {
+				continue
+			}
+			_, err = tx.Exec(fmt.Sprintf("UPDATE transactions_with_balances SET settlement='%v' WHERE id='%v';", total.Id, advance.Id))
+			if err != nil {
+				utils.SendInternalServerError(err, w)
+				return
+			}
+		}
+
+		if total.Balance.Sign() > 0 {
+			description := fmt.Sprintf("Liquidación de %v del %v al %v", settlement.Driver.Name, from, to)
+			insertPendingQuery := fmt.Sprintf("INSERT INTO pending_transactions (type, currency, amount, description, account, actor, settlement) VALUES ('output', '%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", total.Currency, total.Balance, description, payoutAccounts[total.Currency], driverId, total.Id)
+			err = tx.QueryRow(insertPendingQuery).Scan(&total.PendingTransaction)
+			if err != nil {
+				utils.SendInternalServerError(err, w)
+				return
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	response, err := json.Marshal(settlement)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -0,0 +1,246 @@
+package settlements
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"testing"
+	"time"
+
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestGetPayRules(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/pay_rules", GetPayRules)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/pay_rules", nil)
+
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing for an array of pay rules")
+	rules := []types.PayRule{}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	err = json.Unmarshal(body, &rules)
+	if err != nil {
+		t.Error("Response body does not contain an array of type PayRule")
+	}
+}
+
+func TestCreatePayRule(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pay_rules", CreatePayRule)
+
+	newRule := types.PayRule{Type: "per_trip", Currency: "USD", Rate: money.FromInt(50)}
+	newRule.Driver.Id = 3
+	rr := testutils.MakeRequest(t, router, "POST", "/pay_rules", newRule)
+
+	t.Log("testing Ok status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	createdRule := types.PayRule{}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	err = json.Unmarshal(body, &createdRule)
+	if err != nil {
+		t.Error("Response body does not contain an object of type PayRule")
+	}
+
+	t.Log("testing the created pay rule")
+	if createdRule.Id == 0 {
+		t.Error("created pay rule should have an id")
+	}
+	if createdRule.Driver.Id != newRule.Driver.Id {
+		t.Errorf("driver = %v, want %v", createdRule.Driver.Id, newRule.Driver.Id)
+	}
+	if !createdRule.Rate.Equal(newRule.Rate) {
+		t.Errorf("rate = %v, want %v", createdRule.Rate, newRule.Rate)
+	}
+}
+
+func TestCreatePayRuleWithHalfRoute(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pay_rules", CreatePayRule)
+
+	newRule := types.PayRule{Type: "per_trip", Currency: "USD", Rate: money.FromInt(50)}
+	newRule.Driver.Id = 3
+	newRule.Origin.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/pay_rules", newRule)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	expected := "La ruta de la regla debe poseer origen y destino"
+	if string(body) != expected {
+		t.Errorf("response = %v, want %v", string(body), expected)
+	}
+}
+
+func TestCreatePayRuleWithBillPercentageOverHundred(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pay_rules", CreatePayRule)
+
+	newRule := types.PayRule{Type: "per_trip", Currency: "USD", Rate: money.FromInt(50)}
+	newRule.Driver.Id = 3
+	newRule.Type = "bill_percentage"
+	newRule.Rate = money.MustParse("100.01")
+	rr := testutils.MakeRequest(t, router, "POST", "/pay_rules", newRule)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "El porcentaje de la regla no puede ser mayor a cien (100)"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestPatchPayRuleNonExistingId(t *testing.T) {
+	router := httprouter.New()
+	router.PATCH("/pay_rules/:id", PatchPayRule)
+
+	newRule := types.PayRule{Type: "per_trip", Currency: "USD", Rate: money.FromInt(50)}
+	newRule.Driver.Id = 3
+	rr := testutils.MakeRequest(t, router, "PATCH", "/pay_rules/10000000", newRule)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	expected := "La regla con el id 10000000 no existe"
+	if string(body) != expected {
+		t.Errorf("response = %v, want %v", string(body), expected)
+	}
+}
+
+func TestGetSettlementBadDates(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/drivers/:id/settlement", GetSettlement)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/drivers/3/settlement?from=2022-02-01&to=2022-01-01", nil)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	expected := "La fecha de fin de la liquidación es anterior a la fecha de inicio"
+	if string(body) != expected {
+		t.Errorf("response = %v, want %v", string(body), expected)
+	}
+}
+
+func TestConfirmSettlement(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/pay_rules", CreatePayRule)
+	router.DELETE("/pay_rules/:id", DeletePayRule)
+	router.GET("/drivers/:id/settlement", GetSettlement)
+	router.POST("/drivers/:id/settlement", ConfirmSettlement)
+
+	newRule := types.PayRule{Type: "per_trip", Currency: "USD", Rate: money.FromInt(50)}
+	newRule.Driver.Id = 3
+	rr := testutils.MakeRequest(t, router, "POST", "/pay_rules", newRule)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("could not create pay rule: %v", rr.Body.String())
+	}
+	rule := types.PayRule{}
+	json.Unmarshal(rr.Body.Bytes(), &rule)
+	defer testutils.MakeRequest(t, router, "DELETE", fmt.Sprintf("/pay_rules/%v", rule.Id), nil)
+
+	today := time.Now().Local().Format(types.DateFormat)
+	url := fmt.Sprintf("/drivers/3/settlement?from=%v&to=%v", today, today)
+
+	t.Log("testing the settlement preview")
+	rr = testutils.MakeRequest(t, router, "GET", url, nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	preview := types.Settlement{}
+	err := json.Unmarshal(rr.Body.Bytes(), &preview)
+	if err != nil {
+		t.Fatal("Response body does not contain an object of type Settlement")
+	}
+	for _, trip := range preview.Trips {
+		if trip.Rule.Id == 0 {
+			t.Errorf("trip %v should be paid by a rule", trip.Id)
+		}
+	}
+
+	t.Log("testing the settlement confirmation")
+	rr = testutils.MakeRequest(t, router, "POST", url+"&accounts=1,2", nil)
+	if len(preview.Trips) == 0 && len(preview.Advances) == 0 {
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+		}
+		return
+	}
+	negative := false
+	for _, total := range preview.Totals {
+		if total.Balance.Sign() < 0 {
+			negative = true
+		}
+	}
+	if negative {
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+		}
+		return
+	}
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	confirmed := types.Settlement{}
+	err = json.Unmarshal(rr.Body.Bytes(), &confirmed)
+	if err != nil {
+		t.Fatal("Response body does not contain an object of type Settlement")
+	}
+	for _, total := range confirmed.Totals {
+		if total.Id == 0 {
+			t.Error("confirmed settlement totals should have an id")
+		}
+		if total.Balance.Sign() > 0 && total.PendingTransaction == 0 {
+			t.Error("a positive balance should create a pending transaction")
+		}
+	}
+
+	t.Log("testing that settled trips are not listed again")
+	rr = testutils.MakeRequest(t, router, "GET", url, nil)
+	after := types.Settlement{}
+	json.Unmarshal(rr.Body.Bytes(), &after)
+	if len(after.Trips) != 0 || len(after.Advances) != 0 {
+		t.Error("settled trips and advances should not be listed again")
+	}
+}
@@ -0,0 +1,361 @@
+package statements
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/backend_gandola_soft/bills"
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/pdf"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// transactionTypes are the names of the transaction types in the exports
+var transactionTypes = map[string]string{
+	"input":  "Ingreso",
+	"output": "Egreso",
+}
+
+// parseStatementRequest reads the actor id, the from/to dates and the export
+// format, it returns a non empty message when the request is not valid
+func parseStatementRequest(r *http.Request, ps httprouter.Params) (int, string, string, string, string) {
+	actorId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil || actorId <= 0 {
+		return 0, "", "", "", "Id de actor no válido"
+	}
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	fromDate, err := time.Parse(types.DateFormat, from)
+	if err != nil {
+		return 0, "", "", "", "La fecha de inicio del estado de cuenta no tiene un formato válido"
+	}
+	toDate, err := time.Parse(types.DateFormat, to)
+	if err != nil {
+		return 0, "", "", "", "La fecha de fin del estado de cuenta no tiene un formato válido"
+	}
+	if toDate.Before(fromDate) {
+		return 0, "", "", "", "La fecha de fin del estado de cuenta es anterior a la fecha de inicio"
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" && format != "pdf" {
+		return 0, "", "", "", "El formato del estado de cuenta solo puede ser 'json', 'csv' o 'pdf'"
+	}
+	return actorId, from, to, format, ""
+}
+
+// computeStatement lists the executed transactions of an actor between from
+// and to with the running balance of each currency, its pending transactions
+// up to the end of the statement and the bills issued to it in the period.
+// Actor.Id is zero when the actor does not exist. Transfers between accounts
+// are not part of any statement.
+func computeStatement(q querier, actorId int, from string, to string) (types.Statement, error) {
+	statement := types.Statement{
+		From:     from,
+		To:       to,
+		Balances: []types.StatementBalance{},
+		Entries:  []types.StatementEntry{},
+		Pending:  []types.PendingTransaction{},
+		Bills:    []types.Bill{},
+	}
+
+	actorRows, err := q.Query(fmt.Sprintf("SELECT id, type, name, COALESCE(national_id, '') FROM actors WHERE id='%v';", actorId))
+	if err != nil {
+		return statement, err
+	}
+	for actorRows.Next() {
+		if err := actorRows.Scan(&statement.Actor.Id, &statement.Actor.Type, &statement.Actor.Name, &statement.Actor.NationalId); err != nil {
+			actorRows.Close()
+			return statement, err
+		}
+	}
+	actorRows.Close()
+	if statement.Actor.Id == 0 {
+		return statement, nil
+	}
+
+	balances := map[string]*types.StatementBalance{}
+	balanceOf := func(currency string) *types.StatementBalance {
+		if balances[currency] == nil {
+			balances[currency] = &types.StatementBalance{Currency: currency}
+		}
+		return balances[currency]
+	}
+
+	openingQuery := fmt.Sprintf("SELECT currency, COALESCE(SUM(amount) FILTER (WHERE type = 'input'), 0), COALESCE(SUM(amount) FILTER (WHERE type = 'output'), 0) FROM transactions_with_balances WHERE actor='%v' AND transfer IS NULL AND executed::date < '%v' GROUP BY currency;", actorId, from)
+	openingRows, err := q.Query(openingQuery)
+	if err != nil {
+		return statement, err
+	}
+	for openingRows.Next() {
+		var currency string
+		var input, output money.Money
+		if err := openingRows.Scan(&currency, &input, &output); err != nil {
+			openingRows.Close()
+			return statement, err
+		}
+		balanceOf(currency).Opening = input.Sub(output)
+		balanceOf(currency).Closing = input.Sub(output)
+	}
+	openingRows.Close()
+
+	entriesQuery := fmt.Sprintf("%v WHERE transactions_with_balances.actor='%v' AND transactions_with_balances.transfer IS NULL AND transactions_with_balances.executed::date BETWEEN '%v' AND '%v' ORDER BY transactions_with_balances.id;", ledger.SelectTransactionsQuery, actorId, from, to)
+	entryRows, err := q.Query(entriesQuery)
+	if err != nil {
+		return statement, err
+	}
+	for entryRows.Next() {
+		transaction, err := ledger.ScanTransaction(entryRows)
+		if err != nil {
+			entryRows.Close()
+			return statement, err
+		}
+		balance := balanceOf(transaction.Currency)
+		balance.Closing = ledger.Apply(balance.Closing, transaction.Type, transaction.Amount)
+		statement.Entries = append(statement.Entries, types.StatementEntry{
+			Id:          transaction.Id,
+			Date:        strings.Split(transaction.Executed, "T")[0],
+			Type:        transaction.Type,
+			Currency:    transaction.Currency,
+			Amount:      transaction.Amount,
+			Description: transaction.Description,
+			Balance:     balance.Closing,
+		})
+	}
+	entryRows.Close()
+
+	pendingQuery := fmt.Sprintf("%v WHERE pending_transactions.actor='%v' AND pending_transactions.created_at::date <= '%v' ORDER BY pending_transactions.id;", ledger.SelectPendingTransactionsQuery, actorId, to)
+	pendingRows, err := q.Query(pendingQuery)
+	if err != nil {
+		return statement, err
+	}
+	for pendingRows.Next() {
+		transaction, err := ledger.ScanPendingTransaction(pendingRows)
+		if err != nil {
+			pendingRows.Close()
+			return statement, err
+		}
+		balance := balanceOf(transaction.Currency)
+		balance.Pending = ledger.Apply(balance.Pending, transaction.Type, transaction.Amount)
+		statement.Pending = append(statement.Pending, transaction)
+	}
+	pendingRows.Close()
+	err = ledger.AttachSteps(q, statement.Pending)
+	if err != nil {
+		return statement, err
+	}
+
+	billsQuery := fmt.Sprintf("%v WHERE bills.company='%v' AND bills.date BETWEEN '%v' AND '%v' ORDER BY bills.date, bills.id;", bills.SelectBillsQuery, actorId, from, to)
+	billRows, err := q.Query(billsQuery)
+	if err != nil {
+		return statement, err
+	}
+	for billRows.Next() {
+		bill, err := bills.ScanBill(billRows)
+		if err != nil {
+			billRows.Close()
+			return statement, err
+		}
+		bill.Trips = []types.Trip{}
+		statement.Bills = append(statement.Bills, bill)
+	}
+	billRows.Close()
+
+	for _, balance := range balances {
+		statement.Balances = append(statement.Balances, *balance)
+	}
+	sort.Slice(statement.Balances, func(i, j int) bool {
+		return statement.Balances[i].Currency < statement.Balances[j].Currency
+	})
+	return statement, nil
+}
+
+// GetStatement returns the statement of account of an actor, with format=csv
+// or format=pdf it is returned as a file ready to be sent to the actor
+func GetStatement(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	actorId, from, to, format, message := parseStatementRequest(r, ps)
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	statement, err := computeStatement(db, actorId, from, to)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if statement.Actor.Id == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El actor con el id %v no existe", actorId)
+		return
+	}
+
+	filename := fmt.Sprintf("estado_de_cuenta_%v_%v_%v", actorId, from, to)
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%v.csv", filename))
+		err = writeCSV(w, statement)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+		}
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%v.pdf", filename))
+		err = statementPDF(statement).Write(w)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+		}
+	default:
+		response, err := json.Marshal(statement)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	}
+}
+
+// writeCSV writes the statement as sections separated by empty rows: the
+// actor, the balances, the transactions, the pending transactions and the
+// bills
+func writeCSV(w io.Writer, statement types.Statement) error {
+	records := [][]string{
+		{"Estado de cuenta", statement.Actor.Name, statement.Actor.NationalId},
+		{"Desde", statement.From, "Hasta", statement.To},
+		{},
+		{"Moneda", "Saldo inicial", "Saldo final", "Pendiente"},
+	}
+	for _, balance := range statement.Balances {
+		records = append(records, []string{balance.Currency, balance.Opening.String(), balance.Closing.String(), balance.Pending.String()})
+	}
+	records = append(records, []string{}, []string{"Fecha", "Transacción", "Tipo", "Moneda", "Monto", "Descripción", "Saldo"})
+	for _, entry := range statement.Entries {
+		records = append(records, []string{entry.Date, strconv.Itoa(entry.Id), transactionTypes[entry.Type], entry.Currency, entry.Amount.String(), entry.Description, entry.Balance.String()})
+	}
+	records = append(records, []string{}, []string{"Fecha", "Pendiente", "Tipo", "Moneda", "Monto", "Descripción"})
+	for _, pending := range statement.Pending {
+		records = append(records, []string{strings.Split(pending.CreatedAt, "T")[0], strconv.Itoa(pending.Id), transactionTypes[pending.Type], pending.Currency, pending.Amount.String(), pending.Description})
+	}
+	records = append(records, []string{}, []string{"Fecha", "Factura", "Moneda", "Total", "Por cobrar", "Cobrada"})
+	for _, bill := range statement.Bills {
+		charged := "No"
+		if bill.Charged {
+			charged = "Sí"
+		}
+		records = append(records, []string{bill.Date, bill.Code, bill.Currency, bill.Total.String(), bill.Outstanding.String(), charged})
+	}
+	writer := csv.NewWriter(w)
+	return writer.WriteAll(records)
+}
+
+// layout of the statement pages, in points from the top left corner
+const (
+	marginLeft   = 40.0
+	marginRight  = pdf.PageWidth - 40.0
+	marginTop    = 50.0
+	marginBottom = pdf.PageHeight - 50.0
+	lineHeight   = 14.0
+	fontSize     = 9.0
+)
+
+// statementWriter lays out lines on the pages of a document, starting a new
+// page when the current one is full
+type statementWriter struct {
+	document *pdf.Document
+	y        float64
+}
+
+func (s *statementWriter) next(height float64) {
+	s.y += height
+	if s.y > marginBottom {
+		s.document.AddPage()
+		s.y = marginTop
+	}
+}
+
+// row writes the cells at the given column positions, a negative position
+// aligns the cell to the right of its absolute value
+func (s *statementWriter) row(bold bool, columns []float64, cells ...string) {
+	s.next(lineHeight)
+	for i, cell := range cells {
+		if columns[i] < 0 {
+			s.document.TextRight(-columns[i], s.y, fontSize, bold, cell)
+		} else {
+			s.document.Text(columns[i], s.y, fontSize, bold, pdf.Truncate(cell, 48))
+		}
+	}
+}
+
+func (s *statementWriter) title(text string) {
+	s.next(lineHeight)
+	s.row(true, []float64{marginLeft}, text)
+	s.document.Line(marginLeft, s.y+4, marginRight, s.y+4)
+}
+
+// statementPDF lays out the same sections as the CSV export
+func statementPDF(statement types.Statement) *pdf.Document {
+	document := pdf.New()
+	document.AddPage()
+	s := &statementWriter{document: document, y: marginTop}
+	document.Text(marginLeft, s.y, 16, true, "Estado de cuenta")
+	s.next(22)
+	document.Text(marginLeft, s.y, 11, true, statement.Actor.Name)
+	document.TextRight(marginRight, s.y, 10, false, fmt.Sprintf("Desde %v hasta %v", statement.From, statement.To))
+	if statement.Actor.NationalId != "" {
+		s.row(false, []float64{marginLeft}, statement.Actor.NationalId)
+	}
+
+	balanceColumns := []float64{marginLeft, -300, -420, -marginRight}
+	s.title("Saldos")
+	s.row(true, balanceColumns, "Moneda", "Saldo inicial", "Saldo final", "Pendiente")
+	for _, balance := range statement.Balances {
+		s.row(false, balanceColumns, balance.Currency, balance.Opening.String(), balance.Closing.String(), balance.Pending.String())
+	}
+
+	entryColumns := []float64{marginLeft, 100, 140, 190, -300, 310, -marginRight}
+	s.title("Transacciones")
+	s.row(true, entryColumns, "Fecha", "Id", "Tipo", "Moneda", "Monto", "Descripción", "Saldo")
+	for _, entry := range statement.Entries {
+		s.row(false, entryColumns, entry.Date, strconv.Itoa(entry.Id), transactionTypes[entry.Type], entry.Currency, entry.Amount.String(), entry.Description, entry.Balance.String())
+	}
+
+	pendingColumns := []float64{marginLeft, 100, 140, 190, -300, 310}
+	s.title("Transacciones pendientes")
+	s.row(true, pendingColumns, "Fecha", "Id", "Tipo", "Moneda", "Monto", "Descripción")
+	for _, pending := range statement.Pending {
+		s.row(false, pendingColumns, strings.Split(pending.CreatedAt, "T")[0], strconv.Itoa(pending.Id), transactionTypes[pending.Type], pending.Currency, pending.Amount.String(), pending.Description)
+	}
+
+	billColumns := []float64{marginLeft, 100, 310, -420, -500, 520}
+	s.title("Facturas")
+	s.row(true, billColumns, "Fecha", "Factura", "Moneda", "Total", "Por cobrar", "Cobrada")
+	for _, bill := range statement.Bills {
+		charged := "No"
+		if bill.Charged {
+			charged = "Sí"
+		}
+		s.row(false, billColumns, bill.Date, bill.Code, bill.Currency, bill.Total.String(), bill.Outstanding.String(), charged)
+	}
+	return document
+}
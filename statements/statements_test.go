@@ -0,0 +1,122 @@
+package statements
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/transactions"
+	"example.com/backend_gandola_soft/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestGetStatement(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/transactions", transactions.CreateTransaction)
+	router.GET("/actors/:id/statement", GetStatement)
+
+	t.Log("registering a payment of the company zero")
+	transaction := types.TransactionWithBalance{}
+	transaction.Type = "input"
+	transaction.Currency = "USD"
+	transaction.Amount = money.MustParse("42")
+	transaction.Description = "statement payment"
+	transaction.Actor.Id = 2
+	transaction.Account.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/transactions", transaction)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	created := types.TransactionWithBalance{}
+	err := json.Unmarshal(rr.Body.Bytes(), &created)
+	if err != nil {
+		t.Fatal("Response body does not contain a TransactionWithBalance type")
+	}
+
+	today := time.Now().Format(types.DateFormat)
+	rr = testutils.MakeRequest(t, router, "GET", "/actors/2/statement?from=2000-01-01&to="+today, nil)
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	statement := types.Statement{}
+	err = json.Unmarshal(rr.Body.Bytes(), &statement)
+	if err != nil {
+		t.Fatal("Response body does not contain a Statement type")
+	}
+
+	t.Log("testing that the closing balance follows the last entry")
+	var last types.StatementEntry
+	for _, entry := range statement.Entries {
+		if entry.Currency == "USD" {
+			last = entry
+		}
+	}
+	if last.Id != created.Id {
+		t.Fatalf("last USD entry = %v, want %v", last.Id, created.Id)
+	}
+	for _, balance := range statement.Balances {
+		if balance.Currency == "USD" && !balance.Closing.Equal(last.Balance) {
+			t.Errorf("closing balance = %v, want %v", balance.Closing, last.Balance)
+		}
+	}
+}
+
+func TestGetStatementCSV(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/actors/:id/statement", GetStatement)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/actors/2/statement?from=2000-01-01&to=2000-12-31&format=csv", nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/csv; charset=utf-8" {
+		t.Errorf("content type = %v, want text/csv", contentType)
+	}
+	if !strings.HasPrefix(rr.Body.String(), "Estado de cuenta,") {
+		t.Errorf("csv should start with the statement title")
+	}
+}
+
+func TestGetStatementWithBadDates(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/actors/:id/statement", GetStatement)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/actors/2/statement?from=2022-02-01&to=2022-01-01", nil)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La fecha de fin del estado de cuenta es anterior a la fecha de inicio"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestStatementPDF(t *testing.T) {
+	statement := types.Statement{From: "2022-01-01", To: "2022-01-31"}
+	statement.Actor.Name = "Compañía cero"
+	statement.Balances = []types.StatementBalance{{Currency: "USD", Closing: money.MustParse("100")}}
+	for i := 0; i < 80; i++ {
+		statement.Entries = append(statement.Entries, types.StatementEntry{Id: i + 1, Date: "2022-01-15", Type: "input", Currency: "USD", Amount: money.MustParse("1.25"), Description: "pago"})
+	}
+
+	document := statementPDF(statement)
+	t.Log("testing that the entries overflow to a second page")
+	if document.Pages() < 2 {
+		t.Errorf("pages = %v, want at least 2", document.Pages())
+	}
+	out := &bytes.Buffer{}
+	if err := document.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out.Bytes(), []byte("%PDF-")) {
+		t.Error("output is not a PDF document")
+	}
+}
@@ -0,0 +1,32 @@
+package testutils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// MakeRequest sends the payload encoded as JSON to the router and returns
+// the recorded response, a nil payload sends an empty body
+func MakeRequest(t *testing.T, router *httprouter.Router, method string, url string, payload interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body := ""
+	if payload != nil {
+		jsonPayload, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("Could not marshal payload into json: %v", err)
+		}
+		body = string(jsonPayload)
+	}
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Could not make a %v request to %v: %v", method, url, err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
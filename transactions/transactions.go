@@ -1,13 +1,19 @@
 package transactions
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/rates"
 	"example.com/backend_gandola_soft/types"
 	"example.com/backend_gandola_soft/utils"
 	"github.com/julienschmidt/httprouter"
@@ -18,31 +24,232 @@ func Index(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	fmt.Fprintf(w, "Server working")
 }
 
+const defaultPageSize = 50
+const maxPageSize = 500
+
+// transactionsFilter turns the query params of GetTransactions into SQL
+// conditions, it returns a message for the client when a param is not valid
+func transactionsFilter(r *http.Request) ([]string, string) {
+	query := r.URL.Query()
+	// a transfer is listed once, through its input entry
+	conditions := []string{"NOT (transactions_with_balances.transfer IS NOT NULL AND transactions_with_balances.type = 'output')"}
+
+	from := query.Get("from")
+	if from != "" {
+		if _, err := time.Parse(types.DateFormat, from); err != nil {
+			return nil, "La fecha de inicio no tiene un formato válido"
+		}
+		conditions = append(conditions, fmt.Sprintf("transactions_with_balances.executed::date >= '%v'", from))
+	}
+	to := query.Get("to")
+	if to != "" {
+		if _, err := time.Parse(types.DateFormat, to); err != nil {
+			return nil, "La fecha de fin no tiene un formato válido"
+		}
+		conditions = append(conditions, fmt.Sprintf("transactions_with_balances.executed::date <= '%v'", to))
+	}
+	if from != "" && to != "" && to < from {
+		return nil, "La fecha de fin es anterior a la fecha de inicio"
+	}
+
+	if actor := query.Get("actor"); actor != "" {
+		actorId, err := strconv.Atoi(actor)
+		if err != nil || actorId <= 0 {
+			return nil, "Id de actor no válido"
+		}
+		conditions = append(conditions, fmt.Sprintf("transactions_with_balances.actor = '%v'", actorId))
+	}
+
+	switch transactionType := query.Get("type"); transactionType {
+	case "":
+	case "input", "output":
+		conditions = append(conditions, fmt.Sprintf("transactions_with_balances.type = '%v' AND transactions_with_balances.transfer IS NULL", transactionType))
+	case "transfer":
+		conditions = append(conditions, "transactions_with_balances.transfer IS NOT NULL")
+	default:
+		return nil, "El tipo de transacción solo puede ser 'input', 'output' o 'transfer'"
+	}
+
+	// a transfer matches the currency of any of its two entries
+	if currency := query.Get("currency"); currency != "" {
+		if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return nil, "El código de la moneda debe poseer tres letras"
+		}
+		conditions = append(conditions, fmt.Sprintf("(transactions_with_balances.currency = '%v' OR transactions_with_balances.transfer IN (SELECT transfers.id FROM transfers INNER JOIN accounts ON transfers.from_account = accounts.id WHERE accounts.currency = '%v'))", currency, currency))
+	}
+
+	// a category also matches the transactions of its subcategories
+	if category := query.Get("category"); category != "" {
+		categoryId, err := strconv.Atoi(category)
+		if err != nil || categoryId <= 0 {
+			return nil, "Id de categoría no válido"
+		}
+		conditions = append(conditions, fmt.Sprintf("transactions_with_balances.category IN (WITH RECURSIVE tree AS (SELECT id FROM categories WHERE id = '%v' UNION ALL SELECT categories.id FROM categories INNER JOIN tree ON categories.parent = tree.id) SELECT id FROM tree)", categoryId))
+	}
+
+	if description := query.Get("description"); description != "" {
+		description = strings.NewReplacer("'", "''", "\\", "\\\\", "%", "\\%", "_", "\\_").Replace(description)
+		conditions = append(conditions, fmt.Sprintf("transactions_with_balances.description ILIKE '%%%v%%'", description))
+	}
+
+	var minAmount money.Money
+	if min := query.Get("min_amount"); min != "" {
+		amount, err := money.Parse(min)
+		if err != nil {
+			return nil, "El monto mínimo no es válido"
+		}
+		minAmount = amount
+		conditions = append(conditions, fmt.Sprintf("transactions_with_balances.amount >= '%v'", amount))
+	}
+	if max := query.Get("max_amount"); max != "" {
+		amount, err := money.Parse(max)
+		if err != nil {
+			return nil, "El monto máximo no es válido"
+		}
+		if amount.Cmp(minAmount) < 0 {
+			return nil, "El monto máximo es menor al monto mínimo"
+		}
+		conditions = append(conditions, fmt.Sprintf("transactions_with_balances.amount <= '%v'", amount))
+	}
+	return conditions, ""
+}
+
+// windowBalances returns the balances at the start and the end of the date
+// range requested to GetTransactions, without dates the window is the whole
+// ledger
+func windowBalances(db *sql.DB, from string, to string) ([]types.CurrencyBalance, []types.CurrencyBalance, error) {
+	var lastId int
+	if from != "" {
+		err := db.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(id), 0) FROM transactions_with_balances WHERE executed::date < '%v';", from)).Scan(&lastId)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	startBalances, err := ledger.BalancesAt(db, lastId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if to == "" {
+		endBalances, err := ledger.CurrentBalances(db)
+		return startBalances, endBalances, err
+	}
+	err = db.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(id), 0) FROM transactions_with_balances WHERE executed::date <= '%v';", to)).Scan(&lastId)
+	if err != nil {
+		return nil, nil, err
+	}
+	endBalances, err := ledger.BalancesAt(db, lastId)
+	return startBalances, endBalances, err
+}
+
+func onlyCurrency(balances []types.CurrencyBalance, currency string) []types.CurrencyBalance {
+	if currency == "" {
+		return balances
+	}
+	filtered := []types.CurrencyBalance{}
+	for _, balance := range balances {
+		if balance.Currency == currency {
+			filtered = append(filtered, balance)
+		}
+	}
+	return filtered
+}
+
+// GetTransactions lists the ledger from the newest entry backwards. It can be
+// filtered by from and to dates, actor, type, currency, category, description
+// and min_amount and max_amount, and is paginated with limit and the cursor
+// returned by the previous page. With valuation=USD every entry also carries
+// its amount and balance in USD at the rate of its execution day.
 func GetTransactions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	transactions := []types.TransactionWithBalance{}
+	valuation, message := rates.ParseValuation(r)
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+	conditions, message := transactionsFilter(r)
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+	limit := defaultPageSize
+	if requestedLimit := r.URL.Query().Get("limit"); requestedLimit != "" {
+		parsedLimit, err := strconv.Atoi(requestedLimit)
+		if err != nil || parsedLimit <= 0 || parsedLimit > maxPageSize {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "El limite debe ser un número entre 1 y %v", maxPageSize)
+			return
+		}
+		limit = parsedLimit
+	}
+	cursorCondition := ""
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		cursorId, err := strconv.Atoi(cursor)
+		if err != nil || cursorId <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "El cursor no es válido")
+			return
+		}
+		cursorCondition = fmt.Sprintf(" AND transactions_with_balances.id < '%v'", cursorId)
+	}
+
+	page := types.TransactionsPage{Transactions: []types.TransactionWithBalance{}}
 	db := database.ConnectDB()
 	defer db.Close()
-	rows, err := db.Query("SELECT transactions_with_balances.id, transactions_with_balances.type, transactions_with_balances.currency, transactions_with_balances.amount, transactions_with_balances.description, transactions_with_balances.USD_balance, transactions_with_balances.VES_balance, transactions_with_balances.executed, transactions_with_balances.created_at, actors.id, actors.name FROM transactions_with_balances, actors WHERE transactions_with_balances.actor = actors.id ORDER BY transactions_with_balances.id DESC;")
+
+	err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM transactions_with_balances WHERE %v;", strings.Join(conditions, " AND "))).Scan(&page.Total)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	// one more entry than requested tells whether there is a next page
+	rows, err := db.Query(fmt.Sprintf("%v WHERE %v%v ORDER BY transactions_with_balances.id DESC LIMIT %v;", ledger.SelectTransactionsQuery, strings.Join(conditions, " AND "), cursorCondition, limit+1))
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
-		transaction := types.TransactionWithBalance{}
-		if err := rows.Scan(&transaction.Id, &transaction.Type, &transaction.Currency, &transaction.Amount, &transaction.Description, &transaction.USDBalance, &transaction.VESBalance, &transaction.Executed, &transaction.CreatedAt, &transaction.Actor.Id, &transaction.Actor.Name); err != nil {
+		transaction, err := ledger.ScanTransaction(rows)
+		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
-		transactions = append(transactions, transaction)
+		page.Transactions = append(page.Transactions, transaction)
+	}
+	if len(page.Transactions) > limit {
+		page.Transactions = page.Transactions[:limit]
+		page.NextCursor = page.Transactions[limit-1].Id
 	}
-	json_transactions, err := json.Marshal(transactions)
+	page.Transactions, err = ledger.CollapseTransfers(db, page.Transactions)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if valuation {
+		err = rates.ValueTransactions(db, page.Transactions)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	startBalances, endBalances, err := windowBalances(db, r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	page.StartBalances = onlyCurrency(startBalances, r.URL.Query().Get("currency"))
+	page.EndBalances = onlyCurrency(endBalances, r.URL.Query().Get("currency"))
+
+	json_page, err := json.Marshal(page)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(json_transactions)
+	w.Write(json_page)
 }
 
 // TODO: check sql injection issue
@@ -70,17 +277,12 @@ func CreateTransaction(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		fmt.Fprintf(w, "El tipo de transacción solo puede ser del tipo 'input' o 'output'")
 		return
 	}
-	if transaction.Currency != "USD" && transaction.Currency != "VES" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Solo se aceptan monedas de tipo VES y USD")
-		return
-	}
-	if transaction.Amount <= 0 {
+	if transaction.Amount.Sign() <= 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "El monto de la transacción es menor a cero (0)")
 		return
 	}
-	if transaction.Amount > float32(types.MaxTransactionAmount) {
+	if transaction.Amount.Cmp(types.MaxTransactionAmount) > 0 {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "El monto de la transacción exede el máximo permitido")
 		return
@@ -95,10 +297,36 @@ func CreateTransaction(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		fmt.Fprintf(w, "La transacción debe poseer un actor")
 		return
 	}
+	if transaction.Account.Id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción debe poseer una cuenta")
+		return
+	}
 
 	db := database.ConnectDB()
 	defer db.Close()
 
+	message, err := ledger.CheckCurrency(db, transaction.Currency, transaction.Amount)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+	message, err = ledger.CheckCategory(db, transaction.Category.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
 	var actorId int
 	getActorIdQuery := fmt.Sprintf("SELECT id FROM actors WHERE id=%v", transaction.Actor.Id)
 	actorIdRow, err := db.Query(getActorIdQuery)
@@ -120,83 +348,75 @@ func CreateTransaction(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		return
 	}
 
-	var lastUSDBalance float32
-	var lastVESBalance float32
-	
-	getLastBalanceQuery := "SELECT USD_balance, VES_balance FROM transactions_with_balances ORDER BY id desc LIMIT 1;"
-	lastTransactionRow, err := db.Query(getLastBalanceQuery)
+	accountCurrency, err := ledger.AccountCurrency(db, transaction.Account.Id)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer lastTransactionRow.Close()
-	for lastTransactionRow.Next() {
-		if err := lastTransactionRow.Scan(&lastUSDBalance, &lastVESBalance); err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
+	if accountCurrency == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta especificada no existe")
+		return
+	}
+	if accountCurrency != transaction.Currency {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La moneda de la transacción no coincide con la moneda de la cuenta")
+		return
 	}
 
-	newUSDBalance := lastUSDBalance
-	newVESBalance := lastVESBalance
+	tx, err := ledger.Begin(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
 
-	if transaction.Currency == "USD" {
-		if transaction.Type == "input" {
-			newUSDBalance = lastUSDBalance + transaction.Amount
-		} else if transaction.Type == "output" {
-			newUSDBalance = lastUSDBalance - transaction.Amount
-		}
-		if newUSDBalance < 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Su transacción no pudo ser ejecutada porque genera un balance menor a cero (0)")
-			return
-		}
-		if newUSDBalance > float32(types.MaxBalanceAmount) {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Su transacción no pudo ser ejecutada porque excede el balance máximo permitido")
-			return
-		}
+	lastCurrencyBalance, err := ledger.LastCurrencyBalance(tx, transaction.Currency)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
 
-	} else if transaction.Currency == "VES" {
-		if transaction.Type == "input" {
-			newVESBalance = lastVESBalance + transaction.Amount
-		} else if transaction.Type == "output" {
-			newVESBalance = lastVESBalance - transaction.Amount
-		}
-		if newVESBalance < 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Su transacción no pudo ser ejecutada porque genera un balance menor a cero (0)")
-			return
-		}
-		if newVESBalance > float32(types.MaxBalanceAmount) {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Su transacción no pudo ser ejecutada porque excede el balance máximo permitido")
-			return
-		} 
-	} else {
+	lastAccountBalance, err := ledger.LastAccountBalance(tx, transaction.Account.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	newAccountBalance := ledger.Apply(lastAccountBalance, transaction.Type, transaction.Amount)
+	if newAccountBalance.Sign() < 0 {
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Tipo de moneda no aceptada")
+		fmt.Fprintf(w, "Su transacción no pudo ser ejecutada porque genera un balance menor a cero (0) en la cuenta")
 		return
 	}
 
-	var insertedId int
-	insertTransactionQuery := fmt.Sprintf("INSERT INTO transactions_with_balances(type, currency, amount, description, USD_balance, VES_balance, actor) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", transaction.Type, transaction.Currency, transaction.Amount, transaction.Description, newUSDBalance, newVESBalance, transaction.Actor.Id)
+	newCurrencyBalance := ledger.Apply(lastCurrencyBalance, transaction.Type, transaction.Amount)
+	if newCurrencyBalance.Sign() < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Su transacción no pudo ser ejecutada porque genera un balance menor a cero (0)")
+		return
+	}
+	if newCurrencyBalance.Cmp(types.MaxBalanceAmount) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Su transacción no pudo ser ejecutada porque excede el balance máximo permitido")
+		return
+	}
 
-	rowsInsertedId, err := db.Query(insertTransactionQuery)
+	var insertedId int
+	insertTransactionQuery := fmt.Sprintf("INSERT INTO transactions_with_balances(type, currency, amount, description, currency_balance, account, balance, actor, category) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', %v) RETURNING id;", transaction.Type, transaction.Currency, transaction.Amount, transaction.Description, newCurrencyBalance, transaction.Account.Id, newAccountBalance, transaction.Actor.Id, ledger.Nullable(transaction.Category.Id))
+	err = tx.QueryRow(insertTransactionQuery).Scan(&insertedId)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rowsInsertedId.Close()
-	for rowsInsertedId.Next() {
-		if err := rowsInsertedId.Scan(&insertedId); err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
+
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
 	}
 
 	insertedTransaction := types.TransactionWithBalance{}
-	retrieveTransactionQuery := fmt.Sprintf("SELECT transactions_with_balances.id, transactions_with_balances.type, transactions_with_balances.currency, transactions_with_balances.amount, transactions_with_balances.description, transactions_with_balances.USD_balance, transactions_with_balances.VES_balance, transactions_with_balances.executed, transactions_with_balances.created_at, actors.id, actors.name FROM transactions_with_balances, actors WHERE transactions_with_balances.actor = actors.id AND transactions_with_balances.id = '%v';", insertedId)
+	retrieveTransactionQuery := fmt.Sprintf("%v WHERE transactions_with_balances.id = '%v';", ledger.SelectTransactionsQuery, insertedId)
 	rowsRetrievedTransaction, err := db.Query(retrieveTransactionQuery)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -204,7 +424,7 @@ func CreateTransaction(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 	}
 	defer rowsRetrievedTransaction.Close()
 	for rowsRetrievedTransaction.Next() {
-		err = rowsRetrievedTransaction.Scan(&insertedTransaction.Id, &insertedTransaction.Type, &insertedTransaction.Currency, &insertedTransaction.Amount, &insertedTransaction.Description, &insertedTransaction.USDBalance, &insertedTransaction.VESBalance, &insertedTransaction.Executed, &insertedTransaction.CreatedAt, &insertedTransaction.Actor.Id, &insertedTransaction.Actor.Name)
+		insertedTransaction, err = ledger.ScanTransaction(rowsRetrievedTransaction)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
@@ -250,11 +470,32 @@ func PatchTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 		fmt.Fprintf(w, "La transacción debe poseer una descripión")
 		return
 	}
-	var updatedId int
-	updateQuery := fmt.Sprintf("UPDATE transactions_with_balances SET description='%v' WHERE id='%v' RETURNING id;", partialTransaction.Description, transactionId)
-
 	db := database.ConnectDB()
 	defer db.Close()
+
+	// the category only changes when the body has one, clients that send
+	// just the description keep the category of the transaction
+	presentFields := struct {
+		Category *struct{ Id int }
+	}{}
+	json.Unmarshal(body, &presentFields)
+	setCategory := ""
+	if presentFields.Category != nil {
+		message, err := ledger.CheckCategory(db, partialTransaction.Category.Id)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		if message != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, message)
+			return
+		}
+		setCategory = fmt.Sprintf(", category=%v", ledger.Nullable(partialTransaction.Category.Id))
+	}
+
+	var updatedId int
+	updateQuery := fmt.Sprintf("UPDATE transactions_with_balances SET description='%v'%v WHERE id='%v' RETURNING id;", partialTransaction.Description, setCategory, transactionId)
 	rowsId, err := db.Query(updateQuery)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -275,7 +516,7 @@ func PatchTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	}
 
 	modifiedTransaction := types.TransactionWithBalance{}
-	retrieveTransactionQuery := fmt.Sprintf("SELECT transactions_with_balances.id, transactions_with_balances.type, transactions_with_balances.currency, transactions_with_balances.amount, transactions_with_balances.description, transactions_with_balances.USD_balance, transactions_with_balances.VES_balance, transactions_with_balances.executed, transactions_with_balances.created_at, actors.id, actors.name FROM transactions_with_balances, actors WHERE transactions_with_balances.actor = actors.id AND transactions_with_balances.id = '%v';", updatedId)
+	retrieveTransactionQuery := fmt.Sprintf("%v WHERE transactions_with_balances.id = '%v';", ledger.SelectTransactionsQuery, updatedId)
 	rowsRetrieveTransactionQuery, err := db.Query(retrieveTransactionQuery)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
@@ -283,7 +524,7 @@ func PatchTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	}
 	defer rowsRetrieveTransactionQuery.Close()
 	for rowsRetrieveTransactionQuery.Next() {
-		err = rowsRetrieveTransactionQuery.Scan(&modifiedTransaction.Id, &modifiedTransaction.Type, &modifiedTransaction.Currency, &modifiedTransaction.Amount, &modifiedTransaction.Description, &modifiedTransaction.USDBalance, &modifiedTransaction.VESBalance, &modifiedTransaction.Executed, &modifiedTransaction.CreatedAt, &modifiedTransaction.Actor.Id, &modifiedTransaction.Actor.Name)
+		modifiedTransaction, err = ledger.ScanTransaction(rowsRetrieveTransactionQuery)
 		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
@@ -299,157 +540,217 @@ func PatchTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	w.Write(response)
 }
 
-func DeleteLastTransaction(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	deletedTransactionId := types.IdResponse{
-		Id: -1,
+// GetTransactionSteps returns the approval history of the pending transaction
+// the ledger entry was executed from, it is empty for entries created directly
+func GetTransactionSteps(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	transactionId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
 	}
+
 	db := database.ConnectDB()
 	defer db.Close()
-	query := "DELETE FROM transactions_with_balances WHERE id != 1 AND id in (SELECT id FROM transactions_with_balances ORDER BY id desc LIMIT 1) RETURNING id;"
-	rows, err := db.Query(query)
+
+	var exists bool
+	err = db.QueryRow(fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM transactions_with_balances WHERE id='%v');", transactionId)).Scan(&exists)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción con el id %v no existe", transactionId)
+		return
+	}
+
+	rows, err := db.Query(fmt.Sprintf("%v WHERE pending_transaction_steps.transaction='%v' ORDER BY pending_transaction_steps.id;", ledger.SelectStepsQuery, transactionId))
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
 	defer rows.Close()
+
+	steps := []types.PendingStep{}
 	for rows.Next() {
-		if err := rows.Scan(&deletedTransactionId.Id); err != nil {
+		step, _, err := ledger.ScanStep(rows)
+		if err != nil {
 			utils.SendInternalServerError(err, w)
 			return
 		}
+		steps = append(steps, step)
 	}
-
-	if deletedTransactionId.Id <= 1 {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "No quedan más transacciones por eliminar")
-		return
-	}
-
-	rollBackIdQuery := "SELECT setval('transactions_with_balances_id_seq', (SELECT last_value from transactions_with_balances_id_seq) - 1);"
-	_, err = db.Query(rollBackIdQuery)
-	if err != nil {
+	if err := rows.Err(); err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	response, err := json.Marshal(deletedTransactionId)
+	response, err := json.Marshal(steps)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(response)
 }
 
-func GetLastTransactionId(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	lastTransactionId := types.IdResponse{
-		Id: -1,
+// ReverseTransaction undoes a ledger entry with an offsetting one, it is the
+// only way to undo an entry since the ledger never deletes its history
+func ReverseTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	transactionId, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
 	}
+	if transactionId <= 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se puede revertir la transacción cero")
+		return
+	}
+
 	db := database.ConnectDB()
 	defer db.Close()
-	query := "SELECT id FROM transactions_with_balances ORDER BY id desc LIMIT 1;"
-	rows, err := db.Query(query)
+
+	tx, err := ledger.Begin(db)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		if err := rows.Scan(&lastTransactionId.Id); err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
+	defer tx.Rollback()
+
+	original := types.TransactionWithBalance{}
+	var settlementId int
+	var transferId int
+	originalQuery := fmt.Sprintf("SELECT id, type, currency, amount, description, account, actor, COALESCE(settlement, 0), COALESCE(reverses, 0), reversed, COALESCE(transfer, 0), COALESCE(category, 0) FROM transactions_with_balances WHERE id='%v';", transactionId)
+	err = tx.QueryRow(originalQuery).Scan(&original.Id, &original.Type, &original.Currency, &original.Amount, &original.Description, &original.Account.Id, &original.Actor.Id, &settlementId, &original.Reverses, &original.Reversed, &transferId, &original.Category.Id)
+	if err != nil && err != sql.ErrNoRows {
+		utils.SendInternalServerError(err, w)
+		return
 	}
 
-	if lastTransactionId.Id == -1 {
+	if original.Id == 0 {
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "No existen más transacciones")
+		fmt.Fprintf(w, "La transacción con el id %v no existe", transactionId)
+		return
+	}
+	if original.Reversed {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción con el id %v ya fue revertida", transactionId)
+		return
+	}
+	if original.Reverses != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción con el id %v es un reverso y no puede revertirse", transactionId)
+		return
+	}
+	if settlementId != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción con el id %v pertenece a una liquidación y no puede revertirse", transactionId)
+		return
+	}
+	if transferId != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción con el id %v pertenece a una transferencia y no puede revertirse", transactionId)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	response, err := json.Marshal(lastTransactionId)
+	reversalType := "output"
+	if original.Type == "output" {
+		reversalType = "input"
+	}
+
+	lastCurrencyBalance, err := ledger.LastCurrencyBalance(tx, original.Currency)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	w.Write(response)
-}
-
-func UnexecuteLastTransaction(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	lastTransaction := types.TransactionWithBalance{}
-	db := database.ConnectDB()
-	defer db.Close()
-	query := "SELECT * FROM transactions_with_balances ORDER BY id DESC LIMIT 1;"
-	rows, err := db.Query(query)
+	newCurrencyBalance := ledger.Apply(lastCurrencyBalance, reversalType, original.Amount)
+	lastAccountBalance, err := ledger.LastAccountBalance(tx, original.Account.Id)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		if err := rows.Scan(&lastTransaction.Id, &lastTransaction.Type, &lastTransaction.Currency, &lastTransaction.Amount, &lastTransaction.Description, &lastTransaction.USDBalance, &lastTransaction.VESBalance, &lastTransaction.Actor.Id, &lastTransaction.Executed, &lastTransaction.CreatedAt); err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
+	newAccountBalance := ledger.Apply(lastAccountBalance, reversalType, original.Amount)
+	if newCurrencyBalance.Sign() < 0 || newAccountBalance.Sign() < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transacción con el id %v no pudo ser revertida porque genera un balance menor a cero (0)", transactionId)
+		return
 	}
-
-	if lastTransaction.Id == 1 {
+	if newCurrencyBalance.Cmp(types.MaxBalanceAmount) > 0 {
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "No se puede desejecutar la transacción cero")
+		fmt.Fprintf(w, "La transacción con el id %v no pudo ser revertida porque excede el balance máximo permitido", transactionId)
 		return
 	}
 
-	var insertedPendingTransactionId int
-	insertPendingTransactionQuery := fmt.Sprintf("INSERT INTO pending_transactions(type, currency, amount, description, actor, created_at) VALUES ('%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", lastTransaction.Type, lastTransaction.Currency, lastTransaction.Amount, lastTransaction.Description, lastTransaction.Actor.Id, lastTransaction.CreatedAt)
-	rowsId, err := db.Query(insertPendingTransactionQuery)
+	var insertedId int
+	description := fmt.Sprintf("Reverso de la transacción %v: %v", original.Id, original.Description)
+	insertReversalQuery := fmt.Sprintf("INSERT INTO transactions_with_balances(type, currency, amount, description, currency_balance, account, balance, actor, reverses, category) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v', %v) RETURNING id;", reversalType, original.Currency, original.Amount, description, newCurrencyBalance, original.Account.Id, newAccountBalance, original.Actor.Id, original.Id, ledger.Nullable(original.Category.Id))
+	err = tx.QueryRow(insertReversalQuery).Scan(&insertedId)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rowsId.Close()
-	for rowsId.Next() {
-		if err := rowsId.Scan(&insertedPendingTransactionId); err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
-	}
 
-	newPendingTransaction := types.PendingTransaction{}
-	retrievePendingTransactionQuery := fmt.Sprintf("SELECT pending_transactions.id, pending_transactions.type, pending_transactions.currency, pending_transactions.amount, pending_transactions.description, pending_transactions.created_at, actors.id, actors.name FROM pending_transactions, actors WHERE pending_transactions.actor = actors.id AND pending_transactions.id = '%v';", insertedPendingTransactionId)
-	rowsRetrievedTransaction, err := db.Query(retrievePendingTransactionQuery)
+	_, err = tx.Exec(fmt.Sprintf("UPDATE transactions_with_balances SET reversed=TRUE WHERE id='%v';", original.Id))
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
-	defer rowsRetrievedTransaction.Close()
-	for rowsRetrievedTransaction.Next() {
-		err = rowsRetrievedTransaction.Scan(&newPendingTransaction.Id, &newPendingTransaction.Type, &newPendingTransaction.Currency, &newPendingTransaction.Amount, &newPendingTransaction.Description, &newPendingTransaction.CreatedAt, &newPendingTransaction.Actor.Id, &newPendingTransaction.Actor.Name)
-		if err != nil {
-			utils.SendInternalServerError(err, w)
-			return
-		}
+
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
 	}
 
-	deleteQuery := "DELETE FROM transactions_with_balances WHERE id != 1 AND id in (SELECT id FROM transactions_with_balances ORDER BY id desc LIMIT 1) RETURNING id;"
-	_, err = db.Query(deleteQuery)
+	reversal, err := ledger.ScanTransaction(db.QueryRow(fmt.Sprintf("%v WHERE transactions_with_balances.id = '%v';", ledger.SelectTransactionsQuery, insertedId)))
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
 
-	rollBackIdQuery := "SELECT setval('transactions_with_balances_id_seq', (SELECT last_value from transactions_with_balances_id_seq) - 1);"
-	_, err = db.Query(rollBackIdQuery)
+	response, err := json.Marshal(reversal)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
 
-	response, err := json.Marshal(newPendingTransaction)
+func GetLastTransactionId(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	lastTransactionId := types.IdResponse{
+		Id: -1,
+	}
+	db := database.ConnectDB()
+	defer db.Close()
+	query := "SELECT id FROM transactions_with_balances ORDER BY id desc LIMIT 1;"
+	rows, err := db.Query(query)
 	if err != nil {
 		utils.SendInternalServerError(err, w)
 		return
 	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&lastTransactionId.Id); err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	if lastTransactionId.Id == -1 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No existen más transacciones")
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	response, err := json.Marshal(lastTransactionId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
 	w.Write(response)
 }
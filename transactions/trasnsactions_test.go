@@ -8,9 +8,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
 	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -45,7 +49,7 @@ func TestGetTransactions(t *testing.T) {
 	router := httprouter.New()
 	router.GET("/transactions", GetTransactions)
 
-	req, err := http.NewRequest("GET", "/transactions", nil)
+	req, err := http.NewRequest("GET", "/transactions?cursor=2&limit=1", nil)
 	if err != nil {
 		log.Fatal(err)
 		t.Error("Could not make a get request to /transactions")
@@ -61,19 +65,23 @@ func TestGetTransactions(t *testing.T) {
 	t.Log("testing body for transaction zero")
 	id := 1
 	transaction_type := "input"
-	amount := float32(0)
+	amount := money.MustParse("0")
 	description := "transaction zero"
 
-	transactions := []types.TransactionWithBalance{}
+	page := types.TransactionsPage{}
 	body, err := ioutil.ReadAll(rr.Body)
 	if err != nil {
 		log.Fatal(err)
 		t.Error("Could not read body of response")
 	}
 
-	err = json.Unmarshal(body, &transactions)
+	err = json.Unmarshal(body, &page)
 	if err != nil {
-		t.Error("Reponse body does not contain an array of type TransactionWithBalances")
+		t.Error("Reponse body does not contain a TransactionsPage type")
+	}
+	transactions := page.Transactions
+	if len(transactions) != 1 {
+		t.Fatalf("transactions in page = %v, want 1", len(transactions))
 	}
 
 	lastIndex := len(transactions) - 1
@@ -83,13 +91,80 @@ func TestGetTransactions(t *testing.T) {
 	if transaction_type != transactions[lastIndex].Type {
 		t.Errorf("Type = %v, want %v", transaction_type, transactions[lastIndex].Type)
 	}
-	if amount != transactions[lastIndex].Amount {
+	if !amount.Equal(transactions[lastIndex].Amount) {
 		t.Errorf("Amount = %v, want %v", amount, transactions[lastIndex].Amount)
 	}
 	if description != transactions[lastIndex].Description {
 		t.Errorf("Description = %v, want %v", description, transactions[lastIndex].Description)
 	}
+	if page.NextCursor != 0 {
+		t.Errorf("NextCursor = %v, want 0", page.NextCursor)
+	}
+
+}
+
+func TestGetTransactionsPagination(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/transactions", CreateTransaction)
+	router.GET("/transactions", GetTransactions)
+
+	description := utils.RandStringBytes(12)
+	for i := 0; i < 3; i++ {
+		rr := postTransaction(t, router, "input", "USD", money.MustParse("1"), description)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("status = %v, want %v", status, http.StatusOK)
+		}
+	}
 
+	t.Log("testing the pages of a filtered listing")
+	ids := []int{}
+	cursor := ""
+	for pages := 0; pages < 3; pages++ {
+		url := fmt.Sprintf("/transactions?description=%v&type=input&currency=USD&limit=2%v", description, cursor)
+		rr := testutils.MakeRequest(t, router, "GET", url, nil)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("status = %v, want %v", status, http.StatusOK)
+		}
+		page := types.TransactionsPage{}
+		err := json.Unmarshal(rr.Body.Bytes(), &page)
+		if err != nil {
+			t.Fatal("Reponse body does not contain a TransactionsPage type")
+		}
+		if page.Total != 3 {
+			t.Errorf("Total = %v, want 3", page.Total)
+		}
+		for _, transaction := range page.Transactions {
+			ids = append(ids, transaction.Id)
+		}
+		if page.NextCursor == 0 {
+			break
+		}
+		cursor = fmt.Sprintf("&cursor=%v", page.NextCursor)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("listed %v transactions, want 3", len(ids))
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] >= ids[i-1] {
+			t.Errorf("ids %v are not in descending order", ids)
+		}
+	}
+}
+
+func TestGetTransactionsWithBadFilter(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/transactions", GetTransactions)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/transactions?from=2022-02-01&to=2022-01-01", nil)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "La fecha de fin es anterior a la fecha de inicio"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
 }
 
 func TestCreateTransaction(t *testing.T) {
@@ -98,7 +173,7 @@ func TestCreateTransaction(t *testing.T) {
 
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(3)
+	transactionAmount := money.MustParse("3")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -106,6 +181,7 @@ func TestCreateTransaction(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -139,7 +215,7 @@ func TestCreateTransaction(t *testing.T) {
 	if transactionResponse.Type != "input" {
 		t.Errorf("transactionResponse.Type = %v, want %v", transactionResponse.Type, transactionType)
 	}
-	if transactionResponse.Amount != 3 {
+	if !transactionResponse.Amount.Equal(transactionAmount) {
 		t.Errorf("transactionResponse.Amount = %v, want %v", transactionResponse.Amount, transactionAmount)
 	}
 	if transactionResponse.Description != "abc" {
@@ -152,7 +228,7 @@ func TestCreateTransactionWithoutType(t *testing.T) {
 	router.POST("/transactions", CreateTransaction)
 	transactionType := ""
 	transactionCurrency := "USD"
-	transactionAmount := float32(3)
+	transactionAmount := money.MustParse("3")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -160,6 +236,7 @@ func TestCreateTransactionWithoutType(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -197,7 +274,7 @@ func TestCreateTransactionWithWrongType(t *testing.T) {
 	router.POST("/transactions", CreateTransaction)
 	transactionType := "wrongtype"
 	transactionCurrency := "USD"
-	transactionAmount := float32(3)
+	transactionAmount := money.MustParse("3")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -205,6 +282,7 @@ func TestCreateTransactionWithWrongType(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -242,7 +320,7 @@ func TestCreateTransactionWithoutAmount(t *testing.T) {
 	router.POST("/transactions", CreateTransaction)
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(0)
+	transactionAmount := money.MustParse("0")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -250,6 +328,7 @@ func TestCreateTransactionWithoutAmount(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -287,7 +366,7 @@ func TestCreateTransactionWithoutDescription(t *testing.T) {
 	router.POST("/transactions", CreateTransaction)
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(3)
+	transactionAmount := money.MustParse("3")
 	transactionDescription := ""
 	bodyString := fmt.Sprintf(`
 	{
@@ -295,6 +374,7 @@ func TestCreateTransactionWithoutDescription(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -332,7 +412,7 @@ func TestCreateTransactionWithBadJson(t *testing.T) {
 	router.POST("/transactions", CreateTransaction)
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(3)
+	transactionAmount := money.MustParse("3")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -340,6 +420,7 @@ func TestCreateTransactionWithBadJson(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		},
@@ -377,7 +458,7 @@ func TestCreateTransactionWithNonExistingActor(t *testing.T) {
 	router.POST("/transactions", CreateTransaction)
 	transactionType := "input"
 	transactionCurrency := "VES"
-	transactionAmount := float32(3)
+	transactionAmount := money.MustParse("3")
 	transactionDescription := "abc"
 	bodyString := fmt.Sprintf(`
 	{
@@ -385,6 +466,7 @@ func TestCreateTransactionWithNonExistingActor(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 9999
 		}
@@ -422,7 +504,7 @@ func TestCreateTransactionWithBalanceLessThanZero(t *testing.T) {
 	router.POST("/transactions", CreateTransaction)
 	transactionType := "output"
 	transactionCurrency := "USD"
-	transactionAmount := float32(999999999999)
+	transactionAmount := money.MustParse("999999999999")
 	transactionDescription := "balance zero"
 	bodyString := fmt.Sprintf(`
 	{
@@ -430,6 +512,7 @@ func TestCreateTransactionWithBalanceLessThanZero(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -467,7 +550,7 @@ func TestCreateTransactionMoreThanMaximum(t *testing.T) {
 	router.POST("/transactions", CreateTransaction)
 	transactionType := "input"
 	transactionCurrency := "USD"
-	transactionAmount := float32(1e15)
+	transactionAmount := money.MustParse("1000000000000000")
 	transactionDescription := "balance zero"
 	bodyString := fmt.Sprintf(`
 	{
@@ -475,6 +558,7 @@ func TestCreateTransactionMoreThanMaximum(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -512,7 +596,7 @@ func TestCreateTransactionWrongCurrency(t *testing.T) {
 	router.POST("/transactions", CreateTransaction)
 	transactionType := "input"
 	transactionCurrency := "wrong"
-	transactionAmount := float32(5)
+	transactionAmount := money.MustParse("5")
 	transactionDescription := "balance zero"
 	bodyString := fmt.Sprintf(`
 	{
@@ -520,6 +604,7 @@ func TestCreateTransactionWrongCurrency(t *testing.T) {
 		"Currency": "%v",
     "Amount": %v,
     "Description": "%v",
+		"Account": {"Id": 1},
 		"Actor": {
 			"Id": 1
 		}
@@ -546,12 +631,49 @@ func TestCreateTransactionWrongCurrency(t *testing.T) {
 		log.Fatal(err)
 		t.Error("Could not read body of response")
 	}
-	errMessage := "Solo se aceptan monedas de tipo VES y USD"
+	errMessage := "La moneda wrong no está registrada"
 	if string(body) != errMessage {
 		t.Errorf("response = %v, want %v", string(body), errMessage)
 	}
 }
 
+func TestCreateTransactionQuotedCurrency(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/transactions", CreateTransaction)
+	rr := postTransaction(t, router, "input", "USD' OR 'a'='a", money.MustParse("5"), "quoted currency")
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+
+	t.Log("testing error message")
+	errMessage := "La moneda USD' OR 'a'='a no está registrada"
+	if body := rr.Body.String(); body != errMessage {
+		t.Errorf("response = %v, want %v", body, errMessage)
+	}
+}
+
+func TestCreateTransactionWithNonExistingCategory(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/transactions", CreateTransaction)
+
+	transaction := types.TransactionWithBalance{Type: "input", Currency: "USD", Amount: money.MustParse("5"), Description: "non existing category"}
+	transaction.Account.Id = 1
+	transaction.Actor.Id = 1
+	transaction.Category.Id = 2147483647
+	rr := testutils.MakeRequest(t, router, "POST", "/transactions", transaction)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	errMessage := "La categoría especificada no existe"
+	if rr.Body.String() != errMessage {
+		t.Errorf("response = %v, want %v", rr.Body.String(), errMessage)
+	}
+}
+
 func TestPatchTransaction(t *testing.T) {
 	router := httprouter.New()
 	router.GET("/lasttransactionid", GetLastTransactionId)
@@ -811,203 +933,156 @@ func TestPatchTransactionNonExistingId(t *testing.T) {
 	}
 }
 
-var lastIdBeforeDeletion types.IdResponse
+// postTransaction uses the petty cash account of the currency, 1 for USD and
+// 2 for VES
+func postTransaction(t *testing.T, router *httprouter.Router, transactionType string, currency string, amount money.Money, description string) *httptest.ResponseRecorder {
+	transaction := types.TransactionWithBalance{Type: transactionType, Currency: currency, Amount: amount, Description: description}
+	transaction.Account.Id = 1
+	if currency == "VES" {
+		transaction.Account.Id = 2
+	}
+	transaction.Actor.Id = 1
+	return testutils.MakeRequest(t, router, "POST", "/transactions", transaction)
+}
 
-func TestDeleteLastTransaction(t *testing.T) {
+func TestConcurrentCreateTransactions(t *testing.T) {
 	router := httprouter.New()
-	router.GET("/lasttransactionid", GetLastTransactionId)
-
-	var lastId types.IdResponse
-	var deletedId types.IdResponse
-
-	req, err := http.NewRequest("GET", "/lasttransactionid", nil)
-	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not make a get request to /lasttransactionid")
-	}
-	rr := httptest.NewRecorder()
-	router.ServeHTTP(rr, req)
+	router.POST("/transactions", CreateTransaction)
+	router.GET("/transactions", GetTransactions)
 
-	t.Log("testing OK request status code for getting last id")
+	t.Log("seeding a balance for the concurrent outputs")
+	rr := postTransaction(t, router, "input", "VES", money.MustParse("20"), "concurrency seed")
 	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("status = %v, want %v", status, http.StatusOK)
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
 	}
-
-	body, err := ioutil.ReadAll(rr.Body)
+	seed := types.TransactionWithBalance{}
+	err := json.Unmarshal(rr.Body.Bytes(), &seed)
 	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not read body of response")
+		t.Fatal("Reponse body does not contain a TransactionWithBalances type")
 	}
 
-	err = json.Unmarshal(body, &lastId)
-	if err != nil {
-		t.Error("Could not read last id from response")
+	t.Log("creating inputs and outputs at the same time")
+	requests := 20
+	statuses := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		transactionType := "input"
+		if i%2 == 0 {
+			transactionType = "output"
+		}
+		wg.Add(1)
+		go func(transactionType string, i int) {
+			defer wg.Done()
+			rr := postTransaction(t, router, transactionType, "VES", money.MustParse("1.10"), fmt.Sprintf("concurrent transaction %v", i))
+			statuses <- rr.Code
+		}(transactionType, i)
+	}
+	wg.Wait()
+	close(statuses)
+	for status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("status = %v, want %v", status, http.StatusOK)
+		}
 	}
 
-	router.DELETE("/transactions", DeleteLastTransaction)
-	req, err = http.NewRequest("DELETE", "/transactions", nil)
+	t.Log("testing that every running balance follows the previous one")
+	rr = testutils.MakeRequest(t, router, "GET", "/transactions?limit=500", nil)
+	page := types.TransactionsPage{}
+	err = json.Unmarshal(rr.Body.Bytes(), &page)
 	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not make a delete request to /transactions")
-	}
-	router.ServeHTTP(rr, req)
-	t.Log("testing OK request status code for deleting last id")
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("status = %v, want %v", status, http.StatusOK)
-	}
-	body, err = ioutil.ReadAll(rr.Body)
-	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not read body of response")
-	}
-	err = json.Unmarshal(body, &deletedId)
-	if err != nil {
-		t.Error("Could not read deleted id from response")
-	}
-	lastIdBeforeDeletion.Id = deletedId.Id
-	t.Log("Testing last id equals deleted id")
-	if lastId.Id != deletedId.Id {
-		t.Errorf("deleted id = %v, want %v", deletedId.Id, lastId.Id)
+		t.Fatal("Reponse body does not contain a TransactionsPage type")
+	}
+	transactions := page.Transactions
+	accountBalances := map[int]money.Money{}
+	currencyBalances := map[string]money.Money{}
+	for i := len(transactions) - 1; i >= 0; i-- {
+		current := transactions[i]
+		// a transfer from another test is listed as one operation, the balances
+		// of its source account and currency are not known from the listing
+		if current.Transfer != nil {
+			delete(accountBalances, current.Transfer.From.Id)
+			delete(currencyBalances, current.Transfer.From.Currency)
+		}
+		lastAccountBalance, seenAccount := accountBalances[current.Account.Id]
+		lastCurrencyBalance, seenCurrency := currencyBalances[current.Currency]
+		accountBalances[current.Account.Id] = current.Balance
+		currencyBalances[current.Currency] = current.CurrencyBalance
+		if current.Transfer != nil || current.Id <= seed.Id {
+			continue
+		}
+		change := current.Amount
+		if current.Type == "output" {
+			change = change.Neg()
+		}
+		if seenCurrency && !current.CurrencyBalance.Equal(lastCurrencyBalance.Add(change)) {
+			t.Errorf("transaction %v %v balance = %v, want %v", current.Id, current.Currency, current.CurrencyBalance, lastCurrencyBalance.Add(change))
+		}
+		if seenAccount && !current.Balance.Equal(lastAccountBalance.Add(change)) {
+			t.Errorf("transaction %v account balance = %v, want %v", current.Id, current.Balance, lastAccountBalance.Add(change))
+		}
 	}
 }
 
-func TestRollbackIdOnDelete(t *testing.T) {
+func TestReverseTransaction(t *testing.T) {
 	router := httprouter.New()
-	router.GET("/lasttransactionid", GetLastTransactionId)
-
-	var lastId types.IdResponse
-
-	req, err := http.NewRequest("GET", "/lasttransactionid", nil)
-	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not make a get request to /lasttransactionid")
-	}
-	rr := httptest.NewRecorder()
-	router.ServeHTTP(rr, req)
+	router.POST("/transactions", CreateTransaction)
+	router.POST("/transactions/:id/reverse", ReverseTransaction)
+	router.GET("/transactions", GetTransactions)
 
-	t.Log("testing OK request status code for getting last id")
+	rr := postTransaction(t, router, "input", "USD", money.MustParse("7.25"), "transaction to reverse")
 	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("status = %v, want %v", status, http.StatusOK)
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
 	}
-
-	body, err := ioutil.ReadAll(rr.Body)
+	original := types.TransactionWithBalance{}
+	err := json.Unmarshal(rr.Body.Bytes(), &original)
 	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not read body of response")
+		t.Fatal("Reponse body does not contain a TransactionWithBalances type")
 	}
 
-	err = json.Unmarshal(body, &lastId)
-	if err != nil {
-		t.Error("Could not read last id from response")
-	}
-	wantedId := lastIdBeforeDeletion.Id - 1 // because we deleted one transaction
-
-	t.Log("testing if last id rolledb back on deletion")
-	if lastId.Id != wantedId {
-		t.Errorf("last id = %v, want %v", lastId.Id, wantedId)
-	}
-}
-
-func TestUnexecuteLastTransaction(t *testing.T) {
-	router := httprouter.New()
-	router.GET("/lasttransactionid", GetLastTransactionId)
-	router.POST("/transactions", CreateTransaction)
-
-	transactionType := "input"
-	transactionCurrency := "USD"
-	transactionAmount := float32(42)
-	transactionDescription := "transaction to test unexecution"
-	bodyString := fmt.Sprintf(`
-	{
-    "Type": "%v",
-		"Currency": "%v",
-    "Amount": %v,
-    "Description": "%v",
-		"Actor": {
-			"Id": 1
-		}
-  }
-	`, transactionType, transactionCurrency, transactionAmount, transactionDescription)
-	transactionBody := strings.NewReader(bodyString)
-	req, err := http.NewRequest("POST", "/transactions", transactionBody)
-	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not make a post request to /transactions")
-	}
-	rr := httptest.NewRecorder()
-	router.ServeHTTP(rr, req)
+	reverseUrl := fmt.Sprintf("/transactions/%v/reverse", original.Id)
+	rr = testutils.MakeRequest(t, router, "POST", reverseUrl, nil)
 
 	t.Log("testing successful status code")
 	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("status = %v, want %v", status, http.StatusOK)
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
 	}
 
-	t.Log("testing create transaction success")
-	transactionResponse := types.TransactionWithBalance{}
-	body, err := ioutil.ReadAll(rr.Body)
+	t.Log("testing the offsetting entry")
+	reversal := types.TransactionWithBalance{}
+	err = json.Unmarshal(rr.Body.Bytes(), &reversal)
 	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not read body of response")
-	}
-	err = json.Unmarshal(body, &transactionResponse)
-	if err != nil {
-		t.Error("Reponse body does not contain a TransactionWithBalances type")
+		t.Fatal("Reponse body does not contain a TransactionWithBalances type")
 	}
-
-	router.PUT("/transactions", UnexecuteLastTransaction)
-	req2, err := http.NewRequest("PUT", "/transactions", nil)
-	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not make a put request to /transactions")
-	}
-	rr2 := httptest.NewRecorder()
-	router.ServeHTTP(rr2, req2)
-	t.Log("Testing Ok status request for unexecuting last transaction")
-	if status := rr2.Code; status != http.StatusOK {
-		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	if reversal.Type != "output" {
+		t.Errorf("reversal.Type = %v, want output", reversal.Type)
 	}
-
-	t.Log("Testing pending transaction generated")
-	body2, err := ioutil.ReadAll(rr2.Body)
-	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not read body of second response")
+	if !reversal.Amount.Equal(original.Amount) {
+		t.Errorf("reversal.Amount = %v, want %v", reversal.Amount, original.Amount)
 	}
-	newPendingTransaction := types.PendingTransaction{}
-	err = json.Unmarshal(body2, &newPendingTransaction)
-	if err != nil {
-		t.Error("Could not read a pending transaction from response")
+	if reversal.Reverses != original.Id {
+		t.Errorf("reversal.Reverses = %v, want %v", reversal.Reverses, original.Id)
 	}
 
-	var lastIdAfterUnexecution types.IdResponse
-
-	req3, err := http.NewRequest("GET", "/lasttransactionid", nil)
+	t.Log("testing the original transaction is flagged as reversed")
+	rr = testutils.MakeRequest(t, router, "GET", fmt.Sprintf("/transactions?cursor=%v&limit=1", original.Id+1), nil)
+	page := types.TransactionsPage{}
+	err = json.Unmarshal(rr.Body.Bytes(), &page)
 	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not make a get request to /lasttransactionid")
+		t.Fatal("Reponse body does not contain a TransactionsPage type")
 	}
-	rr3 := httptest.NewRecorder()
-	router.ServeHTTP(rr3, req3)
-
-	t.Log("testing OK request status code for getting last id after unexecution")
-	if status := rr3.Code; status != http.StatusOK {
-		t.Errorf("status = %v, want %v", status, http.StatusOK)
-	}
-
-	t.Log("testing IdResponse after unexecuting last transaction")
-	body3, err := ioutil.ReadAll(rr3.Body)
-	if err != nil {
-		log.Fatal(err)
-		t.Error("Could not read body of response")
+	for _, transaction := range page.Transactions {
+		if transaction.Id == original.Id && !transaction.Reversed {
+			t.Error("original transaction should be flagged as reversed")
+		}
 	}
 
-	err = json.Unmarshal(body3, &lastIdAfterUnexecution)
-	if err != nil {
-		t.Error("Could not read last id from response")
+	t.Log("testing a transaction can only be reversed once")
+	rr = testutils.MakeRequest(t, router, "POST", reverseUrl, nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
 	}
-
-	t.Log("testing second IdResponse.Id is less than last IdResponse by one")
-	if transactionResponse.Id-1 != lastIdAfterUnexecution.Id {
-		t.Errorf("lastIdBeforeUnexecution.Id = %v, lastIdAfterUnexecution.Id = %v", transactionResponse.Id, lastIdAfterUnexecution.Id)
+	wanted := fmt.Sprintf("La transacción con el id %v ya fue revertida", original.Id)
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
 	}
 }
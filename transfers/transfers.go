@@ -0,0 +1,275 @@
+package transfers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/ledger"
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+// transfers without an actor are registered to the default actor "Externo"
+const defaultActorId = 1
+
+func GetTransfers(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	transfers := []types.Transfer{}
+	db := database.ConnectDB()
+	defer db.Close()
+	rows, err := db.Query(ledger.SelectTransfersQuery + " ORDER BY transfers.id DESC;")
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		transfer, err := ledger.ScanTransfer(rows)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		transfers = append(transfers, transfer)
+	}
+	json_transfers, err := json.Marshal(transfers)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json_transfers)
+}
+
+// CreateTransfer writes an output on the source account and an input on the
+// destination account in the same ledger transaction. Between currencies the
+// received amount is taken from ToAmount or, when it is missing, computed
+// with the given Rate and rounded to the precision of the destination.
+func CreateTransfer(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	transfer := types.Transfer{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &transfer)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con una transferencia")
+		return
+	}
+	if transfer.From.Id <= 0 || transfer.To.Id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transferencia debe poseer una cuenta de origen y una de destino")
+		return
+	}
+	if transfer.From.Id == transfer.To.Id {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta de origen y la de destino deben ser distintas")
+		return
+	}
+	if transfer.Amount.Sign() <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El monto de la transferencia es menor a cero (0)")
+		return
+	}
+	if transfer.Amount.Cmp(types.MaxTransactionAmount) > 0 || transfer.ToAmount.Cmp(types.MaxTransactionAmount) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El monto de la transferencia exede el máximo permitido")
+		return
+	}
+	if transfer.ToAmount.Sign() < 0 || transfer.Rate.Sign() < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El monto recibido y la tasa de cambio no pueden ser negativos")
+		return
+	}
+	if transfer.Description == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transferencia debe poseer una descripción")
+		return
+	}
+	if transfer.Actor.Id <= 0 {
+		transfer.Actor.Id = defaultActorId
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	var actorId int
+	err = db.QueryRow(fmt.Sprintf("SELECT id FROM actors WHERE id='%v';", transfer.Actor.Id)).Scan(&actorId)
+	if err != nil && err != sql.ErrNoRows {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if actorId == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El actor especificado no existe")
+		return
+	}
+
+	fromCurrency, err := ledger.AccountCurrency(db, transfer.From.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	toCurrency, err := ledger.AccountCurrency(db, transfer.To.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if fromCurrency == "" || toCurrency == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La cuenta especificada no existe")
+		return
+	}
+	destination, err := ledger.LookupCurrency(db, toCurrency)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	if fromCurrency == toCurrency {
+		if !transfer.ToAmount.IsZero() && !transfer.ToAmount.Equal(transfer.Amount) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "En una transferencia entre cuentas de la misma moneda el monto recibido debe ser igual al enviado")
+			return
+		}
+		transfer.ToAmount = transfer.Amount
+		transfer.Rate = money.MustParseRate("1")
+	} else {
+		if transfer.ToAmount.IsZero() {
+			if transfer.Rate.Sign() == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Debe especificar el monto recibido o la tasa de cambio")
+				return
+			}
+			if toCurrency == "USD" {
+				transfer.ToAmount = transfer.Amount.DivRate(transfer.Rate)
+			} else {
+				transfer.ToAmount = transfer.Amount.MulRate(transfer.Rate)
+			}
+			transfer.ToAmount = transfer.ToAmount.Round(destination.Precision)
+		}
+		if toCurrency == "USD" {
+			transfer.Rate = money.RateOf(transfer.Amount, transfer.ToAmount)
+		} else {
+			transfer.Rate = money.RateOf(transfer.ToAmount, transfer.Amount)
+		}
+		if transfer.ToAmount.Sign() <= 0 || transfer.Rate.Sign() <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "El monto recibido es menor a cero (0)")
+			return
+		}
+		if transfer.ToAmount.Cmp(types.MaxTransactionAmount) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "El monto de la transferencia exede el máximo permitido")
+			return
+		}
+	}
+	for _, leg := range []struct {
+		currency string
+		amount   money.Money
+	}{{fromCurrency, transfer.Amount}, {toCurrency, transfer.ToAmount}} {
+		message, err := ledger.CheckCurrency(db, leg.currency, leg.amount)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		if message != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, message)
+			return
+		}
+	}
+
+	tx, err := ledger.Begin(db)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer tx.Rollback()
+
+	fromCurrencyBalance, err := ledger.LastCurrencyBalance(tx, fromCurrency)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	fromBalance, err := ledger.LastAccountBalance(tx, transfer.From.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	fromCurrencyBalance = ledger.Apply(fromCurrencyBalance, "output", transfer.Amount)
+	fromBalance = ledger.Apply(fromBalance, "output", transfer.Amount)
+	if fromCurrencyBalance.Sign() < 0 || fromBalance.Sign() < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transferencia genera un balance menor a cero (0) en la cuenta de origen")
+		return
+	}
+
+	// between accounts of the same currency the input follows the output
+	toCurrencyBalance := fromCurrencyBalance
+	if toCurrency != fromCurrency {
+		toCurrencyBalance, err = ledger.LastCurrencyBalance(tx, toCurrency)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+	toBalance, err := ledger.LastAccountBalance(tx, transfer.To.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	toCurrencyBalance = ledger.Apply(toCurrencyBalance, "input", transfer.ToAmount)
+	toBalance = ledger.Apply(toBalance, "input", transfer.ToAmount)
+	if toCurrencyBalance.Cmp(types.MaxBalanceAmount) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La transferencia excede el balance máximo permitido")
+		return
+	}
+
+	insertTransferQuery := fmt.Sprintf("INSERT INTO transfers(from_account, to_account, amount, to_amount, rate, description, actor) VALUES ('%v', '%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", transfer.From.Id, transfer.To.Id, transfer.Amount, transfer.ToAmount, transfer.Rate, transfer.Description, transfer.Actor.Id)
+	err = tx.QueryRow(insertTransferQuery).Scan(&transfer.Id)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	insertOutputQuery := fmt.Sprintf("INSERT INTO transactions_with_balances(type, currency, amount, description, currency_balance, account, balance, actor, transfer) VALUES ('output', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v');", fromCurrency, transfer.Amount, transfer.Description, fromCurrencyBalance, transfer.From.Id, fromBalance, transfer.Actor.Id, transfer.Id)
+	_, err = tx.Exec(insertOutputQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	insertInputQuery := fmt.Sprintf("INSERT INTO transactions_with_balances(type, currency, amount, description, currency_balance, account, balance, actor, transfer) VALUES ('input', '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v');", toCurrency, transfer.ToAmount, transfer.Description, toCurrencyBalance, transfer.To.Id, toBalance, transfer.Actor.Id, transfer.Id)
+	_, err = tx.Exec(insertInputQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+
+	createdTransfer, err := ledger.ScanTransfer(db.QueryRow(fmt.Sprintf("%v WHERE transfers.id = '%v';", ledger.SelectTransfersQuery, transfer.Id)))
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	response, err := json.Marshal(createdTransfer)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
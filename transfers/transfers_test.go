@@ -0,0 +1,143 @@
+package transfers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"testing"
+
+	"example.com/backend_gandola_soft/money"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/transactions"
+	"example.com/backend_gandola_soft/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestGetTransfers(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/transfers", GetTransfers)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/transfers", nil)
+
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing for an array of transfers")
+	transfers := []types.Transfer{}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		log.Fatal(err)
+		t.Error("Could not read body of response")
+	}
+	err = json.Unmarshal(body, &transfers)
+	if err != nil {
+		t.Error("Response body does not contain an array of type Transfer")
+	}
+}
+
+func TestCreateTransferToSameAccount(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/transfers", CreateTransfer)
+
+	newTransfer := types.Transfer{Amount: money.MustParse("10"), Rate: money.MustParseRate("36.5"), Description: "compra de bolívares"}
+	newTransfer.From.Id = 1
+	newTransfer.To.Id = 2
+	newTransfer.To.Id = newTransfer.From.Id
+	rr := testutils.MakeRequest(t, router, "POST", "/transfers", newTransfer)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "La cuenta de origen y la de destino deben ser distintas"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestCreateExchangeWithoutRate(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/transfers", CreateTransfer)
+
+	newTransfer := types.Transfer{Amount: money.MustParse("10"), Rate: money.MustParseRate("36.5"), Description: "compra de bolívares"}
+	newTransfer.From.Id = 1
+	newTransfer.To.Id = 2
+	newTransfer.Rate = money.Rate{}
+	rr := testutils.MakeRequest(t, router, "POST", "/transfers", newTransfer)
+
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	expected := "Debe especificar el monto recibido o la tasa de cambio"
+	if rr.Body.String() != expected {
+		t.Errorf("response = %v, want %v", rr.Body.String(), expected)
+	}
+}
+
+func TestCreateExchange(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/transactions", transactions.CreateTransaction)
+	router.GET("/transactions", transactions.GetTransactions)
+	router.POST("/transfers", CreateTransfer)
+
+	t.Log("seeding the source account")
+	seed := types.TransactionWithBalance{}
+	seed.Type = "input"
+	seed.Currency = "USD"
+	seed.Amount = money.MustParse("10")
+	seed.Description = "exchange seed"
+	seed.Actor.Id = 1
+	seed.Account.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/transactions", seed)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	newTransfer := types.Transfer{Amount: money.MustParse("10"), Rate: money.MustParseRate("36.5"), Description: "compra de bolívares"}
+	newTransfer.From.Id = 1
+	newTransfer.To.Id = 2
+	rr = testutils.MakeRequest(t, router, "POST", "/transfers", newTransfer)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+	createdTransfer := types.Transfer{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdTransfer)
+	if err != nil {
+		t.Fatal("Response body does not contain an object of type Transfer")
+	}
+
+	t.Log("testing the received amount and the rate")
+	if !createdTransfer.ToAmount.Equal(money.MustParse("365")) {
+		t.Errorf("to amount = %v, want 365.00", createdTransfer.ToAmount)
+	}
+	if createdTransfer.Rate.Cmp(money.MustParseRate("36.5")) != 0 {
+		t.Errorf("rate = %v, want 36.500000", createdTransfer.Rate)
+	}
+
+	t.Log("testing that the transfer is listed as one operation")
+	rr = testutils.MakeRequest(t, router, "GET", "/transactions?type=transfer&limit=500", nil)
+	page := types.TransactionsPage{}
+	err = json.Unmarshal(rr.Body.Bytes(), &page)
+	if err != nil {
+		t.Fatal("Reponse body does not contain a TransactionsPage type")
+	}
+	found := 0
+	for _, transaction := range page.Transactions {
+		if transaction.Transfer != nil && transaction.Transfer.Id == createdTransfer.Id {
+			found++
+			if transaction.Type != "transfer" {
+				t.Errorf("type = %v, want transfer", transaction.Type)
+			}
+			if !transaction.Transfer.Amount.Equal(createdTransfer.Amount) {
+				t.Errorf("transfer amount = %v, want %v", transaction.Transfer.Amount, createdTransfer.Amount)
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("transfer listed %v times, want 1", found)
+	}
+}
@@ -1 +1,539 @@
-package trips
\ No newline at end of file
+package trips
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/handle_uploads"
+	"example.com/backend_gandola_soft/types"
+	"example.com/backend_gandola_soft/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+const selectTripsQuery = "SELECT trips.id, trips.date, origin.id, origin.name, COALESCE(origin.national_id, ''), COALESCE(origin.address, ''), destination.id, destination.name, COALESCE(destination.national_id, ''), COALESCE(destination.address, ''), trips.cargo, trips.amount, trips.unit, driver.id, driver.name, trucks.id, trucks.name, COALESCE(bills.id, 0), COALESCE(bills.code, ''), COALESCE(bills.charged, FALSE), COALESCE(bills.charged, FALSE), COALESCE(trips.voucher_url, ''), trips.status, trips.status IN ('delivered', 'billed'), trips.loading_at, trips.started_at, trips.delivered_at, trips.billed_at, COALESCE(trips.notes, ''), trips.created_at FROM trips INNER JOIN actors AS origin ON trips.origin = origin.id INNER JOIN actors AS destination ON trips.destination = destination.id INNER JOIN actors AS driver ON trips.driver = driver.id INNER JOIN trucks ON trips.truck = trucks.id LEFT JOIN bills_with_balances AS bills ON trips.bill = bills.id"
+
+func scanTrip(rows *sql.Rows) (types.Trip, error) {
+	trip := types.Trip{}
+	var loadingAt, startedAt, deliveredAt, billedAt sql.NullString
+	err := rows.Scan(&trip.Id, &trip.Date, &trip.Origin.Id, &trip.Origin.Name, &trip.Origin.NationalId, &trip.Origin.Address, &trip.Destination.Id, &trip.Destination.Name, &trip.Destination.NationalId, &trip.Destination.Address, &trip.Cargo, &trip.Amount, &trip.Unit, &trip.Driver.Id, &trip.Driver.Name, &trip.Truck.Id, &trip.Truck.Name, &trip.Bill.Id, &trip.Bill.Code, &trip.Bill.Charged, &trip.Paid, &trip.Voucher, &trip.Status, &trip.Completed, &loadingAt, &startedAt, &deliveredAt, &billedAt, &trip.Notes, &trip.CreatedAt)
+	trip.Date = strings.Split(trip.Date, "T")[0]
+	trip.LoadingAt = loadingAt.String
+	trip.StartedAt = startedAt.String
+	trip.DeliveredAt = deliveredAt.String
+	trip.BilledAt = billedAt.String
+	return trip, err
+}
+
+// previousTripStatus maps every status reachable through the trip endpoints
+// to the only status a trip can be moved from
+var previousTripStatus = map[string]string{
+	"loading":    "planned",
+	"in_transit": "loading",
+	"delivered":  "in_transit",
+}
+
+var tripStatusTimestamp = map[string]string{
+	"loading":    "loading_at",
+	"in_transit": "started_at",
+	"delivered":  "delivered_at",
+}
+
+var tripStatusNames = map[string]string{
+	"planned":    "planificado",
+	"loading":    "cargando",
+	"in_transit": "en tránsito",
+	"delivered":  "entregado",
+	"billed":     "facturado",
+}
+
+// lockedTripMessage explains why a trip was left untouched by a change, it
+// either does not exist or it was already billed or settled
+func lockedTripMessage(db *sql.DB, tripId int) (string, error) {
+	var status string
+	var settled bool
+	err := db.QueryRow(fmt.Sprintf("SELECT status, settlement IS NOT NULL FROM trips WHERE id='%v';", tripId)).Scan(&status, &settled)
+	if err == sql.ErrNoRows {
+		return fmt.Sprintf("El viaje con el id %v no existe", tripId), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if settled {
+		return "El viaje ya fue liquidado y no puede modificarse ni eliminarse", nil
+	}
+	return "El viaje ya fue facturado y no puede modificarse ni eliminarse", nil
+}
+
+// validateTrip checks the trip references against the database, it returns a
+// non empty message when the trip should be rejected as a bad request
+func validateTrip(db *sql.DB, trip types.Trip) (string, error) {
+	if trip.Origin.Id <= 0 {
+		return "Debe especificar el origen del viaje", nil
+	}
+	if trip.Destination.Id <= 0 {
+		return "Debe especificar el destino del viaje", nil
+	}
+	if trip.Driver.Id <= 0 {
+		return "Debe especificar el conductor del viaje", nil
+	}
+	if trip.Truck.Id <= 0 {
+		return "Debe especificar el camión del viaje", nil
+	}
+	if trip.Cargo == "" {
+		return "Debe especificar la carga del viaje", nil
+	}
+	if trip.Amount <= 0 {
+		return "La cantidad de carga del viaje debe ser mayor a cero (0)", nil
+	}
+	if trip.Unit == "" {
+		return "Debe especificar la unidad de la carga del viaje", nil
+	}
+	if trip.Date != "" {
+		_, err := time.Parse(types.DateFormat, trip.Date)
+		if err != nil {
+			return "La fecha del viaje no tiene un formato válido", nil
+		}
+	}
+
+	exists, err := rowExists(db, fmt.Sprintf("SELECT id FROM actors WHERE id='%v';", trip.Origin.Id))
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "El origen especificado no existe", nil
+	}
+
+	exists, err = rowExists(db, fmt.Sprintf("SELECT id FROM actors WHERE id='%v';", trip.Destination.Id))
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "El destino especificado no existe", nil
+	}
+
+	exists, err = rowExists(db, fmt.Sprintf("SELECT id FROM actors WHERE id='%v';", trip.Driver.Id))
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "El conductor especificado no existe", nil
+	}
+
+	exists, err = rowExists(db, fmt.Sprintf("SELECT id FROM actors WHERE id='%v' AND type='driver';", trip.Driver.Id))
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "El actor especificado como conductor no es un conductor", nil
+	}
+
+	exists, err = rowExists(db, fmt.Sprintf("SELECT id FROM trucks WHERE id='%v';", trip.Truck.Id))
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "El camión especificado no existe", nil
+	}
+	return "", nil
+}
+
+func rowExists(db *sql.DB, query string) (bool, error) {
+	var id int
+	rows, err := db.Query(query)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return false, err
+		}
+	}
+	return id != 0, nil
+}
+
+// GetTripsByBill returns the trips invoiced by the given bill
+func GetTripsByBill(db *sql.DB, billId int) ([]types.Trip, error) {
+	trips := []types.Trip{}
+	query := fmt.Sprintf("%v WHERE trips.bill='%v' ORDER BY trips.id;", selectTripsQuery, billId)
+	rows, err := db.Query(query)
+	if err != nil {
+		return trips, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		trip, err := scanTrip(rows)
+		if err != nil {
+			return trips, err
+		}
+		trips = append(trips, trip)
+	}
+	return trips, nil
+}
+
+func GetTrips(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	trips := []types.Trip{}
+	db := database.ConnectDB()
+	defer db.Close()
+	rows, err := db.Query(selectTripsQuery + " ORDER BY trips.id;")
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		trip, err := scanTrip(rows)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		trips = append(trips, trip)
+	}
+	json_trips, err := json.Marshal(trips)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json_trips)
+}
+
+func CreateTrip(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	trip := types.Trip{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+
+	err = json.Unmarshal(body, &trip)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data recibida no corresponde con un viaje")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := validateTrip(db, trip)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	date := "CURRENT_DATE"
+	if trip.Date != "" {
+		date = fmt.Sprintf("'%v'", trip.Date)
+	}
+
+	var insertedId int
+	insertTripQuery := fmt.Sprintf("INSERT INTO trips (date, origin, destination, cargo, amount, unit, driver, truck, notes) VALUES (%v, '%v', '%v', '%v', '%v', '%v', '%v', '%v', '%v') RETURNING id;", date, trip.Origin.Id, trip.Destination.Id, trip.Cargo, trip.Amount, trip.Unit, trip.Driver.Id, trip.Truck.Id, trip.Notes)
+	rowsInsertedId, err := db.Query(insertTripQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsInsertedId.Close()
+	for rowsInsertedId.Next() {
+		err = rowsInsertedId.Scan(&insertedId)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	insertedTrip := types.Trip{}
+	retrieveTripQuery := fmt.Sprintf("%v WHERE trips.id='%v';", selectTripsQuery, insertedId)
+	rowsRetrievedTrip, err := db.Query(retrieveTripQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsRetrievedTrip.Close()
+	for rowsRetrievedTrip.Next() {
+		insertedTrip, err = scanTrip(rowsRetrievedTrip)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	response, err := json.Marshal(insertedTrip)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// PatchTrip replaces the data of the trip, the voucher is only set by
+// /uploadTripVoucher/:id so a patch never changes it. Billed or settled trips
+// can no longer be patched nor deleted
+func PatchTrip(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestedId := ps.ByName("id")
+	tripId, err := strconv.Atoi(requestedId)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if tripId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id del viaje debe ser mayor a cero")
+		return
+	}
+
+	newTrip := types.Trip{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "No se pudo leer el cuerpo de la petición")
+		return
+	}
+	err = json.Unmarshal(body, &newTrip)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "La data enviada no corresponde con un viaje")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	message, err := validateTrip(db, newTrip)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	date := "date"
+	if newTrip.Date != "" {
+		date = fmt.Sprintf("'%v'", newTrip.Date)
+	}
+
+	var updatedId int
+	updateTripQuery := fmt.Sprintf("UPDATE trips SET date=%v, origin='%v', destination='%v', cargo='%v', amount='%v', unit='%v', driver='%v', truck='%v', notes='%v' WHERE id='%v' AND status <> 'billed' AND settlement IS NULL RETURNING id;", date, newTrip.Origin.Id, newTrip.Destination.Id, newTrip.Cargo, newTrip.Amount, newTrip.Unit, newTrip.Driver.Id, newTrip.Truck.Id, newTrip.Notes, tripId)
+	rowsUpdatedId, err := db.Query(updateTripQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsUpdatedId.Close()
+	for rowsUpdatedId.Next() {
+		err = rowsUpdatedId.Scan(&updatedId)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	if updatedId == 0 {
+		message, err := lockedTripMessage(db, tripId)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+
+	updatedTrip := types.Trip{}
+	retrieveTripQuery := fmt.Sprintf("%v WHERE trips.id='%v';", selectTripsQuery, updatedId)
+	rowsRetrievedTrip, err := db.Query(retrieveTripQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsRetrievedTrip.Close()
+	for rowsRetrievedTrip.Next() {
+		updatedTrip, err = scanTrip(rowsRetrievedTrip)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	response, err := json.Marshal(updatedTrip)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func LoadTrip(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	changeTripStatus(w, ps, "loading")
+}
+
+func StartTrip(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	changeTripStatus(w, ps, "in_transit")
+}
+
+func DeliverTrip(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	changeTripStatus(w, ps, "delivered")
+}
+
+func changeTripStatus(w http.ResponseWriter, ps httprouter.Params, status string) {
+	requestedId := ps.ByName("id")
+	tripId, err := strconv.Atoi(requestedId)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+	if tripId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id del viaje debe ser mayor a cero")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	var updatedId int
+	updateStatusQuery := fmt.Sprintf("UPDATE trips SET status='%v', %v=CURRENT_TIMESTAMP WHERE id='%v' AND status='%v' RETURNING id;", status, tripStatusTimestamp[status], tripId, previousTripStatus[status])
+	rowsUpdatedId, err := db.Query(updateStatusQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsUpdatedId.Close()
+	for rowsUpdatedId.Next() {
+		if err := rowsUpdatedId.Scan(&updatedId); err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	if updatedId == 0 {
+		var currentStatus string
+		currentStatusQuery := fmt.Sprintf("SELECT status FROM trips WHERE id='%v';", tripId)
+		currentStatusRow, err := db.Query(currentStatusQuery)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		defer currentStatusRow.Close()
+		for currentStatusRow.Next() {
+			if err := currentStatusRow.Scan(&currentStatus); err != nil {
+				utils.SendInternalServerError(err, w)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		if currentStatus == "" {
+			fmt.Fprintf(w, "El viaje con el id %v no existe", tripId)
+			return
+		}
+		fmt.Fprintf(w, "El viaje no puede pasar a %v porque está %v", tripStatusNames[status], tripStatusNames[currentStatus])
+		return
+	}
+
+	updatedTrip := types.Trip{}
+	retrieveTripQuery := fmt.Sprintf("%v WHERE trips.id='%v';", selectTripsQuery, updatedId)
+	rowsRetrievedTrip, err := db.Query(retrieveTripQuery)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rowsRetrievedTrip.Close()
+	for rowsRetrievedTrip.Next() {
+		updatedTrip, err = scanTrip(rowsRetrievedTrip)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	response, err := json.Marshal(updatedTrip)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func DeleteTrip(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	requestedId := ps.ByName("id")
+	if requestedId == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Debe especificar el parametro id en la petición de borrado")
+		return
+	}
+
+	id, err := strconv.Atoi(requestedId)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El parametro id debe ser un número")
+		return
+	}
+
+	if id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "El id del viaje debe ser mayor a cero")
+		return
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+	query := fmt.Sprintf("DELETE FROM trips WHERE id='%v' AND status <> 'billed' AND settlement IS NULL RETURNING id, COALESCE(voucher_url, '');", id)
+	rows, err := db.Query(query)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	defer rows.Close()
+	deletedId := types.IdResponse{}
+	var voucher string
+	for rows.Next() {
+		err = rows.Scan(&deletedId.Id, &voucher)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+	}
+
+	if deletedId.Id == 0 {
+		message, err := lockedTripMessage(db, id)
+		if err != nil {
+			utils.SendInternalServerError(err, w)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, message)
+		return
+	}
+	handle_uploads.RemoveUpload(voucher, "public/trips")
+
+	w.Header().Set("Content-Type", "application/json")
+	response, err := json.Marshal(deletedId)
+	if err != nil {
+		utils.SendInternalServerError(err, w)
+		return
+	}
+	w.Write(response)
+}
@@ -0,0 +1,417 @@
+package trips
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/backend_gandola_soft/database"
+	"example.com/backend_gandola_soft/testutils"
+	"example.com/backend_gandola_soft/types"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestGetTrips(t *testing.T) {
+	router := httprouter.New()
+	router.GET("/trips", GetTrips)
+
+	rr := testutils.MakeRequest(t, router, "GET", "/trips", nil)
+	t.Log("testing OK status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	t.Log("testing for an array of trips")
+	trips := []types.Trip{}
+	err := json.Unmarshal(rr.Body.Bytes(), &trips)
+	if err != nil {
+		t.Error("Response body does not contain an array of type Trip")
+	}
+}
+
+func TestCreateTrip(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+
+	newTrip := types.Trip{Date: time.Now().Local().Format(types.DateFormat), Cargo: "arena", Amount: 30, Unit: "metros"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 3
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/trips", newTrip)
+	t.Log("testing Ok status code")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+
+	t.Log("testing create trip success")
+	requestResponse := types.Trip{}
+	err := json.Unmarshal(rr.Body.Bytes(), &requestResponse)
+	if err != nil {
+		t.Fatal("Response body does not contain a Trip type")
+	}
+	if requestResponse.Driver.Id != newTrip.Driver.Id {
+		t.Errorf("requestResponse.Driver.Id = %v, want %v", requestResponse.Driver.Id, newTrip.Driver.Id)
+	}
+	if requestResponse.Cargo != newTrip.Cargo {
+		t.Errorf("requestResponse.Cargo = %v, want %v", requestResponse.Cargo, newTrip.Cargo)
+	}
+	if requestResponse.Bill.Id != 0 {
+		t.Errorf("requestResponse.Bill.Id = %v, want %v", requestResponse.Bill.Id, 0)
+	}
+}
+
+func TestCreateTripWithoutCargo(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+
+	newTrip := types.Trip{Date: time.Now().Local().Format(types.DateFormat), Amount: 30, Unit: "metros"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 3
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/trips", newTrip)
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "Debe especificar la carga del viaje"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
+}
+
+func TestCreateTripNonExistingDriver(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+
+	newTrip := types.Trip{Date: time.Now().Local().Format(types.DateFormat), Cargo: "arena", Amount: 30, Unit: "metros"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 9999
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/trips", newTrip)
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "El conductor especificado no existe"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
+}
+
+func TestCreateTripWithNonDriver(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+
+	newTrip := types.Trip{Date: time.Now().Local().Format(types.DateFormat), Cargo: "arena", Amount: 30, Unit: "metros"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 2
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/trips", newTrip)
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "El actor especificado como conductor no es un conductor"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
+}
+
+func TestCreateTripBadDate(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+
+	newTrip := types.Trip{Date: "18/10/2021", Cargo: "arena", Amount: 30, Unit: "metros"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 3
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/trips", newTrip)
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "La fecha del viaje no tiene un formato válido"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
+}
+
+func TestPatchTrip(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+	router.PATCH("/trips/:id", PatchTrip)
+	createdTrip := createTestTrip(t, router)
+
+	newTrip := types.Trip{Date: time.Now().Local().Format(types.DateFormat), Cargo: "granzón", Amount: 30, Unit: "metros"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 3
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/trips/%v", createdTrip.Id), newTrip)
+	t.Log("testing OK request status code for patching last trip")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+
+	t.Log("testing getting back a trip from patch request")
+	responseTrip := types.Trip{}
+	err := json.Unmarshal(rr.Body.Bytes(), &responseTrip)
+	if err != nil {
+		t.Fatal("Response body does not contain a Trip type")
+	}
+	if responseTrip.Cargo != newTrip.Cargo {
+		t.Errorf("responseTrip.Cargo = %v, want %v", responseTrip.Cargo, newTrip.Cargo)
+	}
+}
+
+func TestPatchTripKeepsVoucher(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+	router.PATCH("/trips/:id", PatchTrip)
+	createdTrip := createTestTrip(t, router)
+
+	db := database.ConnectDB()
+	defer db.Close()
+	voucher := fmt.Sprintf("trip-%v.pdf", createdTrip.Id)
+	_, err := db.Exec(fmt.Sprintf("UPDATE trips SET voucher_url='%v' WHERE id='%v';", voucher, createdTrip.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("testing a patch without the voucher keeps the uploaded one")
+	newTrip := types.Trip{Date: createdTrip.Date, Cargo: "arena", Amount: 30, Unit: "metros", Voucher: "other.pdf"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 3
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/trips/%v", createdTrip.Id), newTrip)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+	responseTrip := types.Trip{}
+	err = json.Unmarshal(rr.Body.Bytes(), &responseTrip)
+	if err != nil {
+		t.Fatal("Response body does not contain a Trip type")
+	}
+	if responseTrip.Voucher != voucher {
+		t.Errorf("responseTrip.Voucher = %v, want %v", responseTrip.Voucher, voucher)
+	}
+}
+
+func TestPatchTripNonExistingId(t *testing.T) {
+	router := httprouter.New()
+	router.PATCH("/trips/:id", PatchTrip)
+
+	newTrip := types.Trip{Date: time.Now().Local().Format(types.DateFormat), Cargo: "arena", Amount: 30, Unit: "metros"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 3
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "PATCH", "/trips/9999", newTrip)
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "El viaje con el id 9999 no existe"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', wanted='%v'", rr.Body.String(), wanted)
+	}
+}
+
+func TestDeleteTrip(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+	router.DELETE("/trips/:id", DeleteTrip)
+	createdTrip := createTestTrip(t, router)
+
+	rr := testutils.MakeRequest(t, router, "DELETE", fmt.Sprintf("/trips/%v", createdTrip.Id), nil)
+	t.Log("testing OK request status code for deleting last trip")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+
+	t.Log("testing getting back an IdResponse from delete request")
+	response := types.IdResponse{}
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal("Response body does not contain an IdResponse type")
+	}
+
+	t.Log("testing sent and received Id are identicals")
+	if response.Id != createdTrip.Id {
+		t.Errorf("response.Id = '%v', createdTrip.Id = '%v', they are different", response.Id, createdTrip.Id)
+	}
+}
+
+func TestDeleteTripZeroId(t *testing.T) {
+	router := httprouter.New()
+	router.DELETE("/trips/:id", DeleteTrip)
+
+	rr := testutils.MakeRequest(t, router, "DELETE", "/trips/0", nil)
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "El id del viaje debe ser mayor a cero"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', want = '%v'", rr.Body.String(), wanted)
+	}
+}
+
+func TestDeleteTripRemovesVoucher(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+	router.DELETE("/trips/:id", DeleteTrip)
+	createdTrip := createTestTrip(t, router)
+
+	err := os.MkdirAll("public/trips", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voucher := fmt.Sprintf("public/trips/guia_%v.png", createdTrip.Id)
+	err = ioutil.WriteFile(voucher, []byte("guia"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := database.ConnectDB()
+	defer db.Close()
+	_, err = db.Exec(fmt.Sprintf("UPDATE trips SET voucher_url='%v' WHERE id='%v';", voucher, createdTrip.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := testutils.MakeRequest(t, router, "DELETE", fmt.Sprintf("/trips/%v", createdTrip.Id), nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+
+	t.Log("testing the voucher is removed from disk")
+	if _, err := os.Stat(voucher); !os.IsNotExist(err) {
+		t.Errorf("voucher %v is still on disk", voucher)
+	}
+}
+
+func TestBilledTripIsLocked(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+	router.PATCH("/trips/:id", PatchTrip)
+	router.DELETE("/trips/:id", DeleteTrip)
+	createdTrip := createTestTrip(t, router)
+
+	db := database.ConnectDB()
+	defer db.Close()
+	_, err := db.Exec(fmt.Sprintf("UPDATE trips SET status='billed', billed_at=CURRENT_TIMESTAMP WHERE id='%v';", createdTrip.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := "El viaje ya fue facturado y no puede modificarse ni eliminarse"
+
+	t.Log("testing a billed trip can not be patched")
+	newTrip := types.Trip{Date: createdTrip.Date, Cargo: "granzón", Amount: 30, Unit: "metros"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 3
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "PATCH", fmt.Sprintf("/trips/%v", createdTrip.Id), newTrip)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
+
+	t.Log("testing a billed trip can not be deleted")
+	rr = testutils.MakeRequest(t, router, "DELETE", fmt.Sprintf("/trips/%v", createdTrip.Id), nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	if rr.Body.String() != wanted {
+		t.Errorf("response = %v, want %v", rr.Body.String(), wanted)
+	}
+}
+
+func createTestTrip(t *testing.T, router *httprouter.Router) types.Trip {
+	newTrip := types.Trip{Date: time.Now().Local().Format(types.DateFormat), Cargo: "arena", Amount: 30, Unit: "metros", Notes: "viaje de prueba"}
+	newTrip.Origin.Id = 1
+	newTrip.Destination.Id = 2
+	newTrip.Driver.Id = 3
+	newTrip.Truck.Id = 1
+	rr := testutils.MakeRequest(t, router, "POST", "/trips", newTrip)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("status = %v, want %v: %v", status, http.StatusOK, rr.Body.String())
+	}
+
+	createdTrip := types.Trip{}
+	err := json.Unmarshal(rr.Body.Bytes(), &createdTrip)
+	if err != nil {
+		t.Fatal("Response body does not contain a Trip type")
+	}
+	return createdTrip
+}
+
+func TestTripLifecycle(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+	router.PUT("/trips/:id/load", LoadTrip)
+	router.PUT("/trips/:id/start", StartTrip)
+	router.PUT("/trips/:id/deliver", DeliverTrip)
+
+	createdTrip := createTestTrip(t, router)
+	t.Log("testing new trips are planned")
+	if createdTrip.Status != "planned" {
+		t.Errorf("createdTrip.Status = %v, want %v", createdTrip.Status, "planned")
+	}
+
+	steps := []struct {
+		action string
+		status string
+	}{
+		{"load", "loading"},
+		{"start", "in_transit"},
+		{"deliver", "delivered"},
+	}
+	for _, step := range steps {
+		requestUrl := fmt.Sprintf("/trips/%v/%v", createdTrip.Id, step.action)
+		rr := testutils.MakeRequest(t, router, "PUT", requestUrl, nil)
+		t.Logf("testing OK status code for %v", requestUrl)
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("status = %v, want %v", status, http.StatusOK)
+		}
+
+		updatedTrip := types.Trip{}
+		err := json.Unmarshal(rr.Body.Bytes(), &updatedTrip)
+		if err != nil {
+			t.Error("Response body does not contain a Trip type")
+		}
+		if updatedTrip.Status != step.status {
+			t.Errorf("updatedTrip.Status = %v, want %v", updatedTrip.Status, step.status)
+		}
+	}
+}
+
+func TestDeliverTripNotStarted(t *testing.T) {
+	router := httprouter.New()
+	router.POST("/trips", CreateTrip)
+	router.PUT("/trips/:id/deliver", DeliverTrip)
+
+	createdTrip := createTestTrip(t, router)
+
+	rr := testutils.MakeRequest(t, router, "PUT", fmt.Sprintf("/trips/%v/deliver", createdTrip.Id), nil)
+	t.Log("testing bad request status code")
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", status, http.StatusBadRequest)
+	}
+	wanted := "El viaje no puede pasar a entregado porque está planificado"
+	if rr.Body.String() != wanted {
+		t.Errorf("response = '%v', want = '%v'", rr.Body.String(), wanted)
+	}
+}
@@ -1,42 +1,277 @@
 package types
 
+import "example.com/backend_gandola_soft/money"
+
 type TransactionWithBalance struct {
+	Id              int
+	Type            string
+	Currency        string
+	Amount          money.Money
+	Description     string
+	CurrencyBalance money.Money
+	Account         struct {
+		Id   int
+		Name string
+	}
+	Balance money.Money
+	Actor   struct {
+		Id   int
+		Name string
+	}
+	Category struct {
+		Id   int
+		Name string
+	}
+	Reverses  int
+	Reversed  bool
+	Transfer  *Transfer
+	Valuation *Valuation
+	Executed  string
+	CreatedAt string
+}
+
+// Currency is a currency accepted by the ledger, Precision is the number of
+// decimals its amounts can have
+type Currency struct {
+	Code      string
+	Name      string
+	Symbol    string
+	Precision int
+	CreatedAt string
+}
+
+// CurrencyBalance is the running balance of a currency across every account
+type CurrencyBalance struct {
+	Currency string
+	Symbol   string
+	Balance  money.Money
+}
+
+// TransactionsPage is a page of the filtered ledger, NextCursor is the cursor
+// of the following page or zero on the last one. The balances are those at
+// the start and the end of the requested date range.
+type TransactionsPage struct {
+	Transactions  []TransactionWithBalance
+	Total         int
+	NextCursor    int
+	StartBalances []CurrencyBalance
+	EndBalances   []CurrencyBalance
+}
+
+// ExchangeRate is the amount of Currency paid for each USD from Date on
+type ExchangeRate struct {
+	Id        int
+	Date      string
+	Currency  string
+	Rate      money.Rate
+	Source    string
+	CreatedAt string
+}
+
+// Valuation expresses an amount and a balance in Currency using the exchange
+// rate in force on the given date
+type Valuation struct {
+	Currency string
+	Date     string
+	Rate     money.Rate
+	Amount   money.Money
+	Balance  money.Money
+}
+
+// Transfer moves money between two accounts, when the accounts hold different
+// currencies the Rate is the amount of the other currency paid for each USD,
+// or the amount received for each unit sent when neither of them is USD
+type Transfer struct {
+	Id   int
+	From struct {
+		Id       int
+		Name     string
+		Currency string
+	}
+	To struct {
+		Id       int
+		Name     string
+		Currency string
+	}
+	Amount      money.Money
+	ToAmount    money.Money
+	Rate        money.Rate
+	Description string
+	Actor       struct {
+		Id   int
+		Name string
+	}
+	CreatedAt string
+}
+
+type PendingTransaction struct {
 	Id          int
 	Type        string
 	Currency    string
-	Amount      float32
+	Amount      money.Money
 	Description string
-	USDBalance  float32
-	VESBalance  float32
-	Actor       struct {
+	Account     struct {
 		Id   int
 		Name string
 	}
-	Executed  string
+	Actor struct {
+		Id   int
+		Name string
+	}
+	Category struct {
+		Id   int
+		Name string
+	}
+	Payable   int
+	DueDate   string
+	Status    string
+	Steps     []PendingStep
 	CreatedAt string
 }
 
-type PendingTransaction struct {
+// RecurringTransaction is a template the server turns into a pending
+// transaction due on every occurrence of its Frequency from StartDate to
+// EndDate, which is empty when it does not end. LastDate is the last
+// occurrence already created.
+type RecurringTransaction struct {
 	Id          int
 	Type        string
 	Currency    string
-	Amount      float32
+	Amount      money.Money
 	Description string
-	Actor       struct {
+	Account     struct {
+		Id   int
+		Name string
+	}
+	Actor struct {
+		Id   int
+		Name string
+	}
+	Category struct {
+		Id   int
+		Name string
+	}
+	Frequency string
+	StartDate string
+	EndDate   string
+	LastDate  string
+	CreatedAt string
+}
+
+// PendingStep records who moved a pending transaction to Status and when,
+// Transaction is the ledger entry of an executed one and Actor is empty on
+// the steps nobody signed
+type PendingStep struct {
+	Id     int
+	Status string
+	Actor  struct {
+		Id   int
+		Name string
+	}
+	Notes       string
+	Transaction int
+	CreatedAt   string
+}
+
+// BatchExecution lists the pending transactions to execute in order, a
+// DryRun returns the result without committing it and Actor is the required
+// employee who executes them
+type BatchExecution struct {
+	Ids    []int
+	DryRun bool
+	Actor  struct {
+		Id   int
+		Name string
+	}
+}
+
+// BatchResult holds the ledger entries created by a batch execution and the
+// balances of every currency after them
+type BatchResult struct {
+	DryRun       bool
+	Transactions []TransactionWithBalance
+	Balances     []CurrencyBalance
+}
+
+// CalendarDay holds the pending transactions due on Date, Date is empty for
+// the ones without a due date
+type CalendarDay struct {
+	Date         string
+	Transactions []PendingTransaction
+}
+
+// ProjectedDay is the balance of every currency once the pending
+// transactions due on Date are executed
+type ProjectedDay struct {
+	Date         string
+	Transactions []PendingTransaction
+	Balances     []CurrencyBalance
+}
+
+// Shortfall is the first date the balance of a currency goes below zero
+type Shortfall struct {
+	Currency string
+	Date     string
+	Balance  money.Money
+}
+
+// Projection walks the dated pending transactions on top of the Current
+// balances of the ledger, a currency is listed in Shortfalls when it would
+// go negative
+type Projection struct {
+	Current    []CurrencyBalance
+	Days       []ProjectedDay
+	Shortfalls []Shortfall
+}
+
+// Category groups transactions by what they were for, Parent is zero on the
+// top level categories and Children holds the subcategories
+type Category struct {
+	Id        int
+	Name      string
+	Parent    int
+	Children  []Category
+	CreatedAt string
+}
+
+// CategoryTotal is what was received and spent in Currency under a category
+// and all of its subcategories during Period
+type CategoryTotal struct {
+	Category struct {
 		Id   int
 		Name string
 	}
+	Parent   int
+	Period   string
+	Currency string
+	Input    money.Money
+	Output   money.Money
+	Net      money.Money
+}
+
+type Account struct {
+	Id        int
+	Name      string
+	Currency  string
+	Balance   money.Money
+	Valuation *Valuation
 	CreatedAt string
 }
 
 type Actor struct {
-	Id         int
-	Type       string
-	Name       string
-	NationalId string
-	Address    string
-	Notes      string
-	CreatedAt  string
+	Id            int
+	Type          string
+	Name          string
+	NationalId    string
+	Address       string
+	Notes         string
+	LicenseNumber string
+	LicenseExpiry string
+	Phone         string
+	// SpecialTaxpayer marks the companies that withhold IVA and ISLR from
+	// the bills they pay
+	SpecialTaxpayer bool
+	CreatedAt       string
 }
 
 type Note struct {
@@ -58,15 +293,104 @@ type Bill struct {
 		Name       string
 		NationalId string
 	}
-	Charged   bool
-	CreatedAt string
+	Items               []BillItem
+	Subtotal            money.Money
+	IvaRate             money.Money
+	IvaWithholdingRate  money.Money
+	IslrWithholdingRate money.Money
+	Iva                 money.Money
+	IvaWithholding      money.Money
+	IslrWithholding     money.Money
+	Total               money.Money
+	Net                 money.Money
+	Currency            string
+	Paid                money.Money
+	Outstanding         money.Money
+	Charged             bool
+	Trips               []Trip
+	Payments            []TransactionWithBalance
+	CreatedAt           string
+}
+
+// BillItem is a line of a bill, Amount is Quantity times UnitPrice and Trip
+// is the optional trip it charges for
+type BillItem struct {
+	Id          int
+	Description string
+	Quantity    money.Quantity
+	Unit        string
+	UnitPrice   money.Money
+	Amount      money.Money
+	Trip        int
+}
+
+// Payable is an invoice received from a third actor. Paid comes from the
+// executed payments linked to it, Scheduled from the pending ones and
+// Outstanding is what is left to pay
+type Payable struct {
+	Id       int
+	Code     string
+	Supplier struct {
+		Id         int
+		Name       string
+		NationalId string
+	}
+	Description     string
+	Amount          money.Money
+	Currency        string
+	Date            string
+	DueDate         string
+	Url             string
+	Paid            money.Money
+	Scheduled       money.Money
+	Outstanding     money.Money
+	PaidOff         bool
+	Payments        []TransactionWithBalance
+	PendingPayments []PendingTransaction
+	CreatedAt       string
+}
+
+// Settings holds the configuration of the company, the company data heads
+// the invoices, the rates are percentages and pending transactions worth
+// more than ApprovalThreshold USD need two approvals
+type Settings struct {
+	CompanyName         string
+	CompanyNationalId   string
+	CompanyAddress      string
+	CompanyPhone        string
+	IvaRate             money.Money
+	IvaWithholdingRate  money.Money
+	IslrWithholdingRate money.Money
+	ApprovalThreshold   money.Money
+	UpdatedAt           string
+}
+
+// AgingBucket is what is owed on the bills whose age falls in Range, Bills
+// lists them when the report is drilled down into a company
+type AgingBucket struct {
+	Range       string
+	Outstanding money.Money
+	Bills       []Bill
+}
+
+// AgingBalance is what a company owes in Currency split by the age of the
+// bills
+type AgingBalance struct {
+	Company struct {
+		Id         int
+		Name       string
+		NationalId string
+	}
+	Currency string
+	Buckets  []AgingBucket
+	Total    money.Money
 }
 
 type Truck struct {
 	Id         int
 	Name       string
 	Data       string
-	Photos       []string
+	Photos     []string
 	Created_At string
 }
 
@@ -93,22 +417,133 @@ type Trip struct {
 		Address    string
 	}
 	Cargo  string
-	Driver string
-	Truck  string
-	Bill   struct {
+	Amount int
+	Unit   string
+	Driver struct {
+		Id   int
+		Name string
+	}
+	Truck struct {
+		Id   int
+		Name string
+	}
+	Bill struct {
 		Id      int
+		Code    string
 		Charged bool
 	}
-	Voucher   string
-	Completed bool
-	Notes     string
+	Paid        bool
+	Voucher     string
+	Status      string
+	Completed   bool
+	LoadingAt   string
+	StartedAt   string
+	DeliveredAt string
+	BilledAt    string
+	Notes       string
+	CreatedAt   string
+}
+
+type PayRule struct {
+	Id     int
+	Driver struct {
+		Id   int
+		Name string
+	}
+	Origin struct {
+		Id   int
+		Name string
+	}
+	Destination struct {
+		Id   int
+		Name string
+	}
+	Type      string
+	Currency  string
+	Rate      money.Money
+	CreatedAt string
+}
+
+type SettlementTrip struct {
+	Id          int
+	Date        string
+	Origin      string
+	Destination string
+	Cargo       string
+	Amount      int
+	Unit        string
+	Rule        struct {
+		Id   int
+		Type string
+		Rate money.Money
+	}
+	Currency string
+	Pay      money.Money
+}
+
+type SettlementTotal struct {
+	Id                 int
+	Currency           string
+	Earned             money.Money
+	Advances           money.Money
+	Balance            money.Money
+	PendingTransaction int
+}
+
+type Settlement struct {
+	Driver struct {
+		Id   int
+		Name string
+	}
+	From     string
+	To       string
+	Trips    []SettlementTrip
+	Advances []TransactionWithBalance
+	Totals   []SettlementTotal
+}
+
+// StatementEntry is an executed transaction of an actor, Balance is the
+// running balance of its currency within the statement
+type StatementEntry struct {
+	Id          int
+	Date        string
+	Type        string
+	Currency    string
+	Amount      money.Money
+	Description string
+	Balance     money.Money
+}
+
+// StatementBalance sums up a currency in a statement, Pending is the net
+// amount of the pending transactions of the actor
+type StatementBalance struct {
+	Currency string
+	Opening  money.Money
+	Closing  money.Money
+	Pending  money.Money
+}
+
+// Statement is the statement of account of an actor between From and To
+type Statement struct {
+	Actor struct {
+		Id         int
+		Type       string
+		Name       string
+		NationalId string
+	}
+	From     string
+	To       string
+	Balances []StatementBalance
+	Entries  []StatementEntry
+	Pending  []PendingTransaction
+	Bills    []Bill
 }
 
 type IdResponse struct {
 	Id int
 }
 
-var MaxTransactionAmount = 1e14
-var MaxBalanceAmount = 1e19
+var MaxTransactionAmount = money.FromInt(1e14)
+var MaxBalanceAmount = money.MustParse("10000000000000000000")
 var DateFormat = "2006-01-02"
 var ImageTypes = []string{".webp", ".svg", ".png", ".apng", ".avif", ".gif", ".jpg", ".jpeg", ".jfif", ".pjpeg", ".pjp"}